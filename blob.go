@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"time"
 
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/blob"
@@ -11,10 +12,37 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// blobCBFreq is the minimum interval between active progress callbacks
+const blobCBFreq = time.Millisecond * 100
+
+type blobOpt struct {
+	callback func(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64)
+}
+
+// BlobOpts define options for the Blob* commands
+type BlobOpts func(*blobOpt)
+
+// BlobWithCallback provides progress data to a callback function.
+// The callback may be called concurrently and should return quickly.
+func BlobWithCallback(callback func(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64)) BlobOpts {
+	return func(opts *blobOpt) {
+		opts.callback = callback
+	}
+}
+
 // BlobCopy copies a blob between two locations
 // If the blob already exists in the target, the copy is skipped
 // A server side cross repository blob mount is attempted
-func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opts ...BlobOpts) error {
+	var opt blobOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	cb := func(state types.CallbackState, cur int64) {
+		if opt.callback != nil {
+			opt.callback(types.CallbackBlob, d.Digest.String(), state, cur, d.Size)
+		}
+	}
 	tDesc := d
 	tDesc.URLs = []string{} // ignore URLs when pushing to target
 	// for the same repository, there's nothing to copy
@@ -24,6 +52,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt":    refTgt.Reference,
 			"digest": d.Digest,
 		}).Debug("Blob copy skipped, same repo")
+		cb(types.CallbackSkipped, d.Size)
 		return nil
 	}
 	// check if layer already exists
@@ -32,6 +61,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt":    refTgt.Reference,
 			"digest": d,
 		}).Debug("Blob copy skipped, already exists")
+		cb(types.CallbackSkipped, d.Size)
 		return nil
 	}
 	// try mounting blob from the source repo is the registry is the same
@@ -43,6 +73,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 				"tgt":    refTgt.Reference,
 				"digest": d,
 			}).Debug("Blob copy performed server side with registry mount")
+			cb(types.CallbackMounted, d.Size)
 			return nil
 		}
 		rc.log.WithFields(logrus.Fields{
@@ -52,6 +83,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 		}).Warn("Failed to mount blob")
 	}
 	// fast options failed, download layer from source and push to target
+	cb(types.CallbackStarted, 0)
 	blobIO, err := rc.BlobGet(ctx, refSrc, d)
 	if err != nil {
 		rc.log.WithFields(logrus.Fields{
@@ -59,17 +91,24 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"src":    refSrc.Reference,
 			"digest": d,
 		}).Warn("Failed to retrieve blob")
+		cb(types.CallbackFailed, 0)
 		return err
 	}
 	defer blobIO.Close()
-	if _, err := rc.BlobPut(ctx, refTgt, blobIO.GetDescriptor(), blobIO); err != nil {
+	var rdr io.Reader = blobIO
+	if opt.callback != nil {
+		rdr = &blobProgressReader{r: blobIO, cb: func(cur int64) { cb(types.CallbackActive, cur) }}
+	}
+	if _, err := rc.BlobPut(ctx, refTgt, blobIO.GetDescriptor(), rdr); err != nil {
 		rc.log.WithFields(logrus.Fields{
 			"err": err,
 			"src": refSrc.Reference,
 			"tgt": refTgt.Reference,
 		}).Warn("Failed to push blob")
+		cb(types.CallbackFailed, 0)
 		return err
 	}
+	cb(types.CallbackFinished, d.Size)
 	return nil
 }
 
@@ -90,11 +129,35 @@ func (rc *RegClient) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor)
 	if err == nil {
 		return blob.NewReader(blob.WithDesc(d), blob.WithRef(r), blob.WithReader(bytes.NewReader(data))), nil
 	}
+	// registry pulls are served from the local cache when available
+	useCache := rc.blobCache != nil && r.Scheme == "reg" && d.Digest != ""
+	if useCache {
+		rdr, size, err := rc.blobCache.Get(d.Digest)
+		if err == nil {
+			rc.log.WithFields(logrus.Fields{
+				"ref":    r.CommonName(),
+				"digest": d.Digest.String(),
+			}).Debug("Blob cache hit")
+			dc := d
+			dc.Size = size
+			return blob.NewReader(blob.WithDesc(dc), blob.WithRef(r), blob.WithReader(rdr)), nil
+		}
+	}
 	schemeAPI, err := rc.schemeGet(r.Scheme)
 	if err != nil {
 		return nil, err
 	}
-	return schemeAPI.BlobGet(ctx, r, d)
+	b, err := schemeAPI.BlobGet(ctx, r, d)
+	if err != nil || !useCache {
+		return b, err
+	}
+	return blob.NewReader(
+		blob.WithDesc(b.GetDescriptor()),
+		blob.WithRef(r),
+		blob.WithHeader(b.RawHeaders()),
+		blob.WithResp(b.Response()),
+		blob.WithReader(rc.blobCache.Tee(d.Digest, b)),
+	), nil
 }
 
 // BlobGetOCIConfig retrieves an OCI config from a blob, automatically extracting the JSON
@@ -135,3 +198,21 @@ func (rc *RegClient) BlobPut(ctx context.Context, ref ref.Ref, d types.Descripto
 	}
 	return schemeAPI.BlobPut(ctx, ref, d, rdr)
 }
+
+// blobProgressReader reports the number of bytes read to a callback
+type blobProgressReader struct {
+	r    io.Reader
+	cb   func(int64)
+	cur  int64
+	last time.Time
+}
+
+func (bpr *blobProgressReader) Read(p []byte) (int, error) {
+	n, err := bpr.r.Read(p)
+	bpr.cur += int64(n)
+	if now := time.Now(); err != nil || now.Sub(bpr.last) >= blobCBFreq {
+		bpr.last = now
+		bpr.cb(bpr.cur)
+	}
+	return n, err
+}
@@ -25,17 +25,34 @@ type ConfigDefaults struct {
 	Schedule       string        `yaml:"schedule" json:"schedule"`
 	Parallel       int           `yaml:"parallel" json:"parallel"`
 	SkipDockerConf bool          `yaml:"skipDockerConfig" json:"skipDockerConfig"`
+	State          string        `yaml:"state" json:"state"`
 	Timeout        time.Duration `yaml:"timeout" json:"timeout"`
 	UserAgent      string        `yaml:"userAgent" json:"userAgent"`
 }
 
 // ConfigScript defines a source/target repository to sync
 type ConfigScript struct {
-	Name     string        `yaml:"name" json:"name"`
-	Script   string        `yaml:"script" json:"script"`
-	Interval time.Duration `yaml:"interval" json:"interval"`
-	Schedule string        `yaml:"schedule" json:"schedule"`
-	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
+	Name     string         `yaml:"name" json:"name"`
+	Script   string         `yaml:"script" json:"script"`
+	Interval time.Duration  `yaml:"interval" json:"interval"`
+	Schedule string         `yaml:"schedule" json:"schedule"`
+	Timeout  time.Duration  `yaml:"timeout" json:"timeout"`
+	Trigger  *ConfigTrigger `yaml:"trigger" json:"trigger"`
+}
+
+// ConfigTrigger runs a script when a tag in a watched repository changes
+type ConfigTrigger struct {
+	Repos     []string        `yaml:"repos" json:"repos"`
+	Allow     []string        `yaml:"allow" json:"allow"`
+	Deny      []string        `yaml:"deny" json:"deny"`
+	Interval  time.Duration   `yaml:"interval" json:"interval"`
+	CheckMax  int             `yaml:"checkMax" json:"checkMax"`
+	RateLimit ConfigRateLimit `yaml:"ratelimit" json:"ratelimit"`
+}
+
+// ConfigRateLimit stops checking tags when the remaining requests reported by the registry are below the minimum
+type ConfigRateLimit struct {
+	Min int `yaml:"min" json:"min"`
 }
 
 // ConfigNew creates an empty configuration
@@ -117,13 +134,20 @@ func configExpandTemplates(c *Config) error {
 
 // updates script entry with defaults
 func scriptSetDefaults(s *ConfigScript, d ConfigDefaults) {
-	if s.Schedule == "" && d.Schedule != "" {
+	// scripts with a trigger only run on a schedule when it is set in the script
+	if s.Schedule == "" && d.Schedule != "" && s.Trigger == nil {
 		s.Schedule = d.Schedule
 	}
-	if s.Interval == 0 && s.Schedule == "" && d.Interval != 0 {
+	if s.Interval == 0 && s.Schedule == "" && d.Interval != 0 && s.Trigger == nil {
 		s.Interval = d.Interval
 	}
 	if s.Timeout == 0 && d.Timeout != 0 {
 		s.Timeout = d.Timeout
 	}
+	if s.Trigger != nil && s.Trigger.Interval == 0 {
+		s.Trigger.Interval = triggerInterval
+	}
+	if s.Trigger != nil && s.Trigger.CheckMax == 0 {
+		s.Trigger.CheckMax = triggerCheckMax
+	}
 }
@@ -15,6 +15,8 @@ var (
 	ErrNotFound = errors.New("not found")
 	// ErrScriptFailed when the script fails to run
 	ErrScriptFailed = errors.New("failure in user script")
+	// ErrTestFailed when the test results do not match the expected results
+	ErrTestFailed = errors.New("test failed")
 	// ErrUnsupportedConfigVersion happens when config file version is greater than this command supports
 	ErrUnsupportedConfigVersion = errors.New("unsupported config version")
 )
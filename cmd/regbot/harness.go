@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// testResult is the outcome of running a script against the fixture
+type testResult struct {
+	Script  string           `yaml:"script" json:"script"`
+	Actions []sandbox.Action `yaml:"actions" json:"actions"`
+	Error   string           `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+func runTest(cmd *cobra.Command, args []string) error {
+	err := loadConf()
+	if err != nil {
+		return err
+	}
+	fsMem := rwfs.MemNew()
+	if testOpts.fixture != "" {
+		err = rwfs.CopyRecursive(rwfs.OSNew(""), testOpts.fixture, fsMem, ".")
+		if err != nil {
+			return fmt.Errorf("failed to load fixture %s: %w", testOpts.fixture, err)
+		}
+	}
+	rc = regclient.New(regclient.WithFS(fsMem), regclient.WithLog(log))
+	// changes to the state are kept in memory
+	state.filename = ""
+	assert := ""
+	if testOpts.assert != "" {
+		b, err := os.ReadFile(testOpts.assert)
+		if err != nil {
+			return err
+		}
+		assert = string(b)
+	}
+	results, err := testScripts(cmd.Context(), testOpts.scripts, assert)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if testOpts.golden != "" && testOpts.update {
+		return os.WriteFile(testOpts.golden, out, 0644)
+	}
+	os.Stdout.Write(out)
+	if testOpts.golden != "" {
+		return testGolden(out, testOpts.golden)
+	}
+	if assert == "" {
+		for _, tr := range results {
+			if tr.Error != "" {
+				return ErrScriptFailed
+			}
+		}
+	}
+	return nil
+}
+
+// testScripts runs each script with the actions recorded, followed by the optional assertion script
+func testScripts(ctx context.Context, names []string, assert string) ([]testResult, error) {
+	var mainErr error
+	results := []testResult{}
+	for _, s := range conf.Scripts {
+		if len(names) > 0 && !testInList(s.Name, names) {
+			continue
+		}
+		tr := testResult{Script: s.Name, Actions: []sandbox.Action{}}
+		err := s.process(ctx,
+			sandbox.WithRefMap(testRefMap),
+			sandbox.WithActions(func(a sandbox.Action) {
+				tr.Actions = append(tr.Actions, a)
+			}),
+		)
+		if err != nil {
+			tr.Error = err.Error()
+		}
+		results = append(results, tr)
+		if assert == "" {
+			continue
+		}
+		sa := ConfigScript{Name: s.Name + " (assert)", Script: assert, Timeout: s.Timeout}
+		err = sa.process(ctx,
+			sandbox.WithRefMap(testRefMap),
+			sandbox.WithGlobal("script", s.Name),
+			sandbox.WithGlobal("actions", tr.Actions),
+			sandbox.WithGlobal("scriptError", tr.Error),
+		)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"script": s.Name,
+			}).Error("Assertion failed")
+			if mainErr == nil {
+				mainErr = fmt.Errorf("assertion failed for script %s: %w", s.Name, ErrTestFailed)
+			}
+		}
+	}
+	return results, mainErr
+}
+
+// testGolden compares the results to the golden file
+func testGolden(out []byte, file string) error {
+	expect, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bytes.TrimSpace(expect), bytes.TrimSpace(out)) {
+		log.WithFields(logrus.Fields{
+			"golden": file,
+		}).Error("Results do not match the golden file")
+		return fmt.Errorf("results do not match %s: %w", file, ErrTestFailed)
+	}
+	return nil
+}
+
+// testRefMap rewrites registry references to an OCI Layout in the fixture
+func testRefMap(r ref.Ref) ref.Ref {
+	if r.Scheme != "reg" {
+		return r
+	}
+	str := "ocidir://" + r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		str += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		str += "@" + r.Digest
+	}
+	rNew, err := ref.New(str)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"ref":   r.CommonName(),
+			"error": err,
+		}).Warn("Failed to map reference to fixture")
+		return r
+	}
+	return rNew
+}
+
+func testInList(name string, list []string) bool {
+	for _, entry := range list {
+		if name == entry {
+			return true
+		}
+	}
+	return false
+}
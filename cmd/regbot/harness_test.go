@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+	"gopkg.in/yaml.v2"
+)
+
+func TestHarness(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.MkdirAll(fsMem, "registry.example.com", 0755)
+	if err != nil {
+		t.Errorf("failed to setup memfs dir: %v", err)
+		return
+	}
+	err = rwfs.CopyRecursive(fsOS, "testdata/testrepo", fsMem, "registry.example.com/app")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	sem = semaphore.NewWeighted(1)
+	rc = regclient.New(regclient.WithFS(fsMem))
+	confBytes := `
+  version: 1
+  defaults:
+    parallel: 1
+  scripts:
+  - name: cleanup
+    script: |
+      for _, t in ipairs(tag.ls("registry.example.com/app")) do
+        if t == "v1" then
+          tag.delete("registry.example.com/app:" .. t)
+        end
+      end
+  - name: promote
+    script: |
+      image.copy("registry.example.com/app:v3", "registry.example.com/app:stable")
+  - name: broken
+    script: |
+      image.copy("registry.example.com/app:missing", "registry.example.com/app:stable")
+  - name: repos
+    script: |
+      repo.ls("registry.example.com")
+  `
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(confBytes)))
+	if err != nil {
+		t.Errorf("failed parsing config: %v", err)
+		return
+	}
+	rootOpts.dryRun = false
+
+	t.Run("RefMap", func(t *testing.T) {
+		tests := []struct {
+			in, expect string
+		}{
+			{in: "registry.example.com/app:v1", expect: "ocidir://registry.example.com/app:v1"},
+			{in: "busybox", expect: "ocidir://docker.io/library/busybox:latest"},
+			{in: "ocidir://testrepo:v1", expect: "ocidir://testrepo:v1"},
+		}
+		for _, tt := range tests {
+			r, err := ref.New(tt.in)
+			if err != nil {
+				t.Errorf("failed to parse %s: %v", tt.in, err)
+				continue
+			}
+			out := testRefMap(r).CommonName()
+			if out != tt.expect {
+				t.Errorf("unexpected ref for %s: %s, expected %s", tt.in, out, tt.expect)
+			}
+		}
+	})
+
+	var results []testResult
+	t.Run("Actions", func(t *testing.T) {
+		results, err = testScripts(ctx, []string{"cleanup", "promote", "broken", "repos"}, "")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		expect := []testResult{
+			{Script: "cleanup", Actions: []sandbox.Action{
+				{Action: "tag.delete", Ref: "registry.example.com/app:v1"},
+			}},
+			{Script: "promote", Actions: []sandbox.Action{
+				{Action: "image.copy", Ref: "registry.example.com/app:v3", Target: "registry.example.com/app:stable"},
+			}},
+			{Script: "broken", Actions: []sandbox.Action{
+				{Action: "image.copy", Ref: "registry.example.com/app:missing", Target: "registry.example.com/app:stable"},
+			}, Error: ErrScriptFailed.Error()},
+			{Script: "repos", Actions: []sandbox.Action{}, Error: ErrScriptFailed.Error()},
+		}
+		if len(results) != len(expect) {
+			t.Fatalf("unexpected results: %v", results)
+		}
+		for i := range expect {
+			if results[i].Script != expect[i].Script || results[i].Error != expect[i].Error || len(results[i].Actions) != len(expect[i].Actions) {
+				t.Errorf("unexpected result %d: %v, expected %v", i, results[i], expect[i])
+				continue
+			}
+			for j := range expect[i].Actions {
+				if results[i].Actions[j] != expect[i].Actions[j] {
+					t.Errorf("unexpected action %d/%d: %v, expected %v", i, j, results[i].Actions[j], expect[i].Actions[j])
+				}
+			}
+		}
+		_, err = rc.ManifestHead(ctx, ref.Ref{Scheme: "ocidir", Path: "registry.example.com/app", Tag: "stable"})
+		if err != nil {
+			t.Errorf("promoted tag missing: %v", err)
+		}
+	})
+
+	t.Run("Assert", func(t *testing.T) {
+		_, err := testScripts(ctx, []string{"promote"}, `
+			if script ~= "promote" or #actions ~= 1 or actions[1].action ~= "image.copy" or scriptError ~= "" then
+				error "unexpected globals"
+			end
+			tag.ls("registry.example.com/app")
+		`)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		_, err = testScripts(ctx, []string{"promote"}, `
+			for _, a in ipairs(actions) do
+				if a.action == "image.copy" then
+					error("copied " .. a.ref)
+				end
+			end
+		`)
+		if !errors.Is(err, ErrTestFailed) {
+			t.Errorf("unexpected error: %v, expected %v", err, ErrTestFailed)
+		}
+	})
+
+	t.Run("Golden", func(t *testing.T) {
+		out, err := yaml.Marshal(results)
+		if err != nil {
+			t.Fatalf("failed to marshal results: %v", err)
+		}
+		file := filepath.Join(t.TempDir(), "golden.yml")
+		err = os.WriteFile(file, out, 0644)
+		if err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		err = testGolden(out, file)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		err = testGolden(out[:len(out)/2], file)
+		if !errors.Is(err, ErrTestFailed) {
+			t.Errorf("unexpected error: %v, expected %v", err, ErrTestFailed)
+		}
+	})
+}
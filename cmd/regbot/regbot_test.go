@@ -38,6 +38,11 @@ func TestRegbot(t *testing.T) {
 		t.Errorf("failed parsing config: %v", err)
 		return
 	}
+	state, err = stateLoad("")
+	if err != nil {
+		t.Errorf("failed to setup state: %v", err)
+		return
+	}
 	shortTime, err := time.ParseDuration("10ms")
 	if err != nil {
 		t.Errorf("failed to setup shortTime: %v", err)
@@ -137,6 +142,266 @@ func TestRegbot(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name: "Artifact",
+			script: ConfigScript{
+				Name: "Artifact",
+				Script: `
+				image.copy("ocidir://testrepo:v1", "ocidir://testartifact:v1")
+				dig = artifact.put("ocidir://testartifact", {
+					artifactType = "application/example.sbom",
+					annotations = {type = "sbom"},
+					layers = {{mediaType = "application/json", content = "{\"sbom\":true}"}},
+					subject = "ocidir://testartifact:v1",
+					byDigest = true,
+				})
+				rl = referrer.list("ocidir://testartifact:v1")
+				if #rl ~= 1 or rl[1].digest ~= dig then
+					error "referrer not found"
+				end
+				rl = referrer.list("ocidir://testartifact:v1", {artifactType = "application/example.sig"})
+				if #rl ~= 0 then
+					error "referrer filter failed"
+				end
+				a = artifact.get("ocidir://testartifact@" .. dig)
+				if a.artifactType ~= "application/example.sbom" or a.annotations["type"] ~= "sbom" or a.layers[1].content ~= "{\"sbom\":true}" then
+					error "artifact content mismatch"
+				end
+				`,
+			},
+			exists: []string{"ocidir://testartifact:v1"},
+			expErr: nil,
+		},
+		{
+			name: "ReferrerCopyDelete",
+			script: ConfigScript{
+				Name: "ReferrerCopyDelete",
+				Script: `
+				image.copy("ocidir://testartifact:v1", "ocidir://testrefcopy:v1")
+				if referrer.copy("ocidir://testartifact:v1", "ocidir://testrefcopy:v1") ~= 1 then
+					error "referrer copy count mismatch"
+				end
+				if #referrer.list("ocidir://testrefcopy:v1") ~= 1 then
+					error "referrer not copied"
+				end
+				if referrer.delete("ocidir://testrefcopy:v1", {annotations = {type = "sbom"}}) ~= 1 then
+					error "referrer delete count mismatch"
+				end
+				if #referrer.list("ocidir://testrefcopy:v1") ~= 0 then
+					error "referrer not deleted"
+				end
+				`,
+			},
+			exists: []string{"ocidir://testrefcopy:v1"},
+			expErr: nil,
+		},
+		{
+			name:   "ArtifactDryRun",
+			dryrun: true,
+			script: ConfigScript{
+				Name: "ArtifactDryRun",
+				Script: `
+				artifact.put("ocidir://testartdryrun:sbom", {
+					layers = {{content = "hello"}},
+				})
+				if referrer.delete("ocidir://testartifact:v1") ~= 1 then
+					error "referrer not found"
+				end
+				`,
+			},
+			exists:  []string{"ocidir://testartifact:v1"},
+			missing: []string{"ocidir://testartdryrun:sbom"},
+			undesired: []string{
+				"testartdryrun/index.json",
+			},
+			expErr: nil,
+		},
+		{
+			name: "Index",
+			script: ConfigScript{
+				Name: "Index",
+				Script: `
+				idx = index.create("ocidir://testindex:multi")
+				idx = index.add(idx, "ocidir://testrepo@sha256:aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832")
+				idx = index.add(idx, "ocidir://testrepo@sha256:2ea09753fab80a36c32fc7a959537a38a7bcbf09eddba48671c51c29b2c943ac", {platform = "linux/arm64"})
+				idx = index.add(idx, "ocidir://testrepo@sha256:77993787a145f3363ed424e13088a2a8c2aa382ef08a1c151bdf9785453a4c21", {platform = "linux/arm/v7"})
+				if #idx.manifests ~= 3 or idx.manifests[1].platform.architecture ~= "amd64" then
+					error "index add failed"
+				end
+				idx = index.remove(idx, "linux/arm/v7")
+				idx = index.remove(idx, "sha256:2ea09753fab80a36c32fc7a959537a38a7bcbf09eddba48671c51c29b2c943ac")
+				if #idx.manifests ~= 1 then
+					error "index remove failed"
+				end
+				index.put(idx)
+				`,
+			},
+			exists: []string{"ocidir://testindex:multi"},
+			desired: []string{
+				"testindex/blobs/sha256/aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832",
+			},
+			expErr: nil,
+		},
+		{
+			name: "IndexPutOther",
+			script: ConfigScript{
+				Name: "IndexPutOther",
+				Script: `
+				idx = index.create("ocidir://testindexsrc:multi")
+				idx = index.add(idx, "ocidir://testrepo@sha256:aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832")
+				index.put(idx, "ocidir://testindexother:multi")
+				`,
+			},
+			exists: []string{
+				"ocidir://testindexother:multi",
+				"ocidir://testindexother@sha256:aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832",
+			},
+			desired: []string{
+				"testindexother/blobs/sha256/aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832",
+			},
+			expErr: nil,
+		},
+		{
+			name:   "IndexDryRun",
+			dryrun: true,
+			script: ConfigScript{
+				Name: "IndexDryRun",
+				Script: `
+				idx = index.create("ocidir://testindexdryrun:multi")
+				idx = index.add(idx, "ocidir://testrepo@sha256:aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832")
+				index.put(idx)
+				`,
+			},
+			missing: []string{"ocidir://testindexdryrun:multi"},
+			undesired: []string{
+				"testindexdryrun/index.json",
+				"testindexdryrun/blobs/sha256/aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832",
+			},
+			expErr: nil,
+		},
+		{
+			name: "ImageMod",
+			script: ConfigScript{
+				Name: "ImageMod",
+				Script: `
+				image.copy("ocidir://testrepo:v1", "ocidir://testmod:v1")
+				r = image.mod("ocidir://testmod:v1", {
+					labels = {compliance = "checked"},
+					annotations = {["org.example.scan"] = "passed"},
+					timeMax = "2020-01-01T00:00:00Z",
+					replace = true,
+				})
+				if tostring(r) ~= "ocidir://testmod:v1" then
+					error("unexpected reference " .. tostring(r))
+				end
+				ic = image.config("ocidir://testmod:v1")
+				if ic.Config.Labels["compliance"] ~= "checked" then
+					error "label missing"
+				end
+				r = image.mod("ocidir://testmod:v1", {toOCI = true, create = "v1-oci"})
+				if tostring(r) ~= "ocidir://testmod:v1-oci" then
+					error("unexpected reference " .. tostring(r))
+				end
+				`,
+			},
+			exists: []string{"ocidir://testmod:v1", "ocidir://testmod:v1-oci"},
+			expErr: nil,
+		},
+		{
+			name:   "ImageModDryRun",
+			dryrun: true,
+			script: ConfigScript{
+				Name: "ImageModDryRun",
+				Script: `
+				r = image.mod("ocidir://testrepo:v1", {labels = {compliance = "checked"}, create = "modified"})
+				if tostring(r) ~= "ocidir://testrepo:modified" then
+					error("unexpected reference " .. tostring(r))
+				end
+				ic = image.config("ocidir://testrepo:v1")
+				if ic.Config.Labels["compliance"] ~= nil then
+					error "image modified in dry-run"
+				end
+				`,
+			},
+			missing: []string{"ocidir://testrepo:modified"},
+			expErr:  nil,
+		},
+		{
+			name: "ImageModInvalid",
+			script: ConfigScript{
+				Name: "ImageModInvalid",
+				Script: `
+				image.mod("ocidir://testrepo:v1", {timeMax = "yesterday"})
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
+		{
+			name: "State",
+			script: ConfigScript{
+				Name: "State",
+				Script: `
+				state.set("seen/testrepo:v1", {first = 1600000000, tags = {"v1", "latest"}, keep = true})
+				state.set("seen/testrepo:v2", 1600000100)
+				state.set("other", "value")
+				v = state.get("seen/testrepo:v1")
+				if v.first ~= 1600000000 or v.tags[2] ~= "latest" or v.keep ~= true then
+					error "unexpected table value"
+				end
+				keys = state.list("seen/")
+				if #keys ~= 2 or keys[1] ~= "seen/testrepo:v1" then
+					error "unexpected key list"
+				end
+				state.delete("seen/testrepo:v2")
+				if state.get("seen/testrepo:v2") ~= nil or state.get("missing") ~= nil then
+					error "deleted key found"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "StateInvalid",
+			script: ConfigScript{
+				Name: "StateInvalid",
+				Script: `
+				state.set("func", function() end)
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
+		{
+			name: "StateRecursive",
+			script: ConfigScript{
+				Name: "StateRecursive",
+				Script: `
+				t = {name = "loop", list = {}}
+				t.list[1] = t
+				state.set("loop", t)
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
+		{
+			name: "StateNaN",
+			script: ConfigScript{
+				Name: "StateNaN",
+				Script: `
+				state.set("nan", 0/0)
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
+		{
+			name: "StateInf",
+			script: ConfigScript{
+				Name: "StateInf",
+				Script: `
+				state.set("inf", {count = 1, limit = -1/0})
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
 		{
 			name: "Timeout",
 			script: ConfigScript{
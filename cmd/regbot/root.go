@@ -36,6 +36,14 @@ var rootOpts struct {
 	format    string // for Go template formatting of various commands
 }
 
+var testOpts struct {
+	fixture string
+	scripts []string
+	assert  string
+	golden  string
+	update  bool
+}
+
 //go:embed embed/*
 var embedFS embed.FS
 
@@ -48,6 +56,7 @@ var (
 	log    *logrus.Logger
 	rc     *regclient.RegClient
 	sem    *semaphore.Weighted
+	state  *stateStore
 )
 
 var rootCmd = &cobra.Command{
@@ -60,7 +69,7 @@ var rootCmd = &cobra.Command{
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "run the regbot server",
-	Long:  `Runs the various scripts according to their schedule.`,
+	Long:  `Runs the various scripts according to their schedule or trigger.`,
 	Args:  cobra.RangeArgs(0, 0),
 	RunE:  runServer,
 }
@@ -72,6 +81,18 @@ returns after the last script completes.`,
 	Args: cobra.RangeArgs(0, 0),
 	RunE: runOnce,
 }
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "test scripts against a fixture",
+	Long: `Runs each script once against a fixture of OCI Layouts loaded into memory.
+References to a registry are rewritten to the OCI Layout in the fixture named
+"<registry>/<repository>". The changes requested by each script are output
+as yaml, and may be compared to a golden file or checked with a Lua script.
+The assertion script is run after each script with the globals "script",
+"actions", and "scriptError".`,
+	Args: cobra.RangeArgs(0, 0),
+	RunE: runTest,
+}
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
@@ -93,14 +114,24 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&rootOpts.dryRun, "dry-run", "", false, "Dry Run, skip all external actions")
 	rootCmd.PersistentFlags().StringVarP(&rootOpts.verbosity, "verbosity", "v", logrus.InfoLevel.String(), "Log level (debug, info, warn, error, fatal, panic)")
 	rootCmd.PersistentFlags().StringArrayVar(&rootOpts.logopts, "logopt", []string{}, "Log options")
+	testCmd.Flags().StringVarP(&testOpts.fixture, "fixture", "", "", "Directory of OCI Layouts to load as the fixture")
+	testCmd.Flags().StringArrayVarP(&testOpts.scripts, "script", "", []string{}, "Name of a script to test, defaults to all scripts")
+	testCmd.Flags().StringVarP(&testOpts.assert, "assert", "", "", "Lua script to run after each script")
+	testCmd.Flags().StringVarP(&testOpts.golden, "golden", "", "", "Yaml file with the expected results")
+	testCmd.Flags().BoolVarP(&testOpts.update, "update", "", false, "Update the golden file with the results")
 	versionCmd.Flags().StringVarP(&rootOpts.format, "format", "", "{{jsonPretty .}}", "Format output with go template syntax")
 
 	rootCmd.MarkPersistentFlagFilename("config")
 	serverCmd.MarkPersistentFlagRequired("config")
 	onceCmd.MarkPersistentFlagRequired("config")
+	testCmd.MarkPersistentFlagRequired("config")
+	testCmd.MarkFlagDirname("fixture")
+	testCmd.MarkFlagFilename("assert")
+	testCmd.MarkFlagFilename("golden")
 
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(onceCmd)
+	rootCmd.AddCommand(testCmd)
 	rootCmd.AddCommand(versionCmd)
 
 	rootCmd.PersistentPreRunE = rootPreRun
@@ -211,10 +242,31 @@ func runServer(cmd *cobra.Command, args []string) error {
 					mainErr = err
 				}
 			})
-		} else {
+		}
+		if s.Trigger != nil {
+			tw, err := triggerNew(s)
+			if err != nil {
+				cancel()
+				return err
+			}
+			log.WithFields(logrus.Fields{
+				"name":     s.Name,
+				"repos":    s.Trigger.Repos,
+				"interval": s.Trigger.Interval.String(),
+			}).Debug("Watching for tag changes")
+			c.AddFunc("@every "+s.Trigger.Interval.String(), func() {
+				wg.Add(1)
+				defer wg.Done()
+				err := tw.run(ctx)
+				if mainErr == nil {
+					mainErr = err
+				}
+			})
+		}
+		if sched == "" && s.Trigger == nil {
 			log.WithFields(logrus.Fields{
 				"name": s.Name,
-			}).Error("No schedule or interval found, ignoring")
+			}).Error("No schedule, interval, or trigger found, ignoring")
 		}
 	}
 	c.Start()
@@ -260,6 +312,14 @@ func loadConf() error {
 		"concurrent": concurrent,
 	}).Debug("Configuring parallel settings")
 	sem = semaphore.NewWeighted(concurrent)
+	state, err = stateLoad(conf.Defaults.State)
+	if err != nil {
+		return err
+	}
+	if rootOpts.dryRun {
+		// changes to the state are kept in memory
+		state.filename = ""
+	}
 	// set the regclient, loading docker creds unless disabled, and inject logins from config file
 	rcOpts := []regclient.Opt{
 		regclient.WithLog(log),
@@ -293,7 +353,7 @@ func loadConf() error {
 }
 
 // process a sync step
-func (s ConfigScript) process(ctx context.Context) error {
+func (s ConfigScript) process(ctx context.Context, opts ...sandbox.Opt) error {
 	log.WithFields(logrus.Fields{
 		"script": s.Name,
 	}).Debug("Starting script")
@@ -309,11 +369,27 @@ func (s ConfigScript) process(ctx context.Context) error {
 		sandbox.WithLog(log),
 		sandbox.WithSemaphore(sem),
 	}
+	if state != nil {
+		sbOpts = append(sbOpts, sandbox.WithState(state))
+	}
 	if rootOpts.dryRun {
 		sbOpts = append(sbOpts, sandbox.WithDryRun())
 	}
+	sbOpts = append(sbOpts, opts...)
 	sb := sandbox.New(s.Name, sbOpts...)
 	defer sb.Close()
+	if state != nil {
+		// state changes are saved once when the script finishes
+		defer func() {
+			if err := state.Flush(); err != nil {
+				log.WithFields(logrus.Fields{
+					"script": s.Name,
+					"file":   state.filename,
+					"error":  err,
+				}).Error("Failed to save state")
+			}
+		}()
+	}
 	err := sb.RunScript(s.Script)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -0,0 +1,224 @@
+package sandbox
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	artifactDefaultType  = "application/vnd.unknown.config+json"
+	artifactDefaultLayer = "application/octet-stream"
+)
+
+// artifactLayer is a file included in an artifact
+type artifactLayer struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+	Content     string            `json:"content"`
+}
+
+// artifactContent is the lua representation of an artifact
+type artifactContent struct {
+	ArtifactType string            `json:"artifactType"`
+	Annotations  map[string]string `json:"annotations"`
+	Config       string            `json:"config"`
+	Layers       []artifactLayer   `json:"layers"`
+	Subject      string            `json:"subject"`
+	ByDigest     bool              `json:"byDigest"`
+}
+
+func setupArtifact(s *Sandbox) {
+	s.setupMod(
+		luaArtifactName,
+		map[string]lua.LGFunction{
+			"get": s.artifactGet,
+			"put": s.artifactPut,
+		},
+		map[string]map[string]lua.LGFunction{},
+	)
+}
+
+func (s *Sandbox) artifactGet(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	s.log.WithFields(logrus.Fields{
+		"script": s.name,
+		"image":  r.r.CommonName(),
+	}).Debug("Retrieve artifact")
+	m, err := s.rc.ManifestGet(s.ctx, r.r)
+	if err != nil {
+		ls.RaiseError("Failed retrieving \"%s\" manifest: %v", r.r.CommonName(), err)
+	}
+	mi, ok := m.(manifest.Imager)
+	if !ok || m.IsList() {
+		ls.RaiseError("Artifact methods are not available for manifest \"%s\"", r.r.CommonName())
+	}
+	ac := artifactContent{Layers: []artifactLayer{}}
+	if ma, ok := m.(manifest.Annotator); ok {
+		ac.Annotations, _ = ma.GetAnnotations()
+	}
+	if mr, ok := m.(manifest.Refers); ok {
+		if d, err := mr.GetRefers(); err == nil && d != nil {
+			rSubj := r.r
+			rSubj.Tag = ""
+			rSubj.Digest = d.Digest.String()
+			ac.Subject = rSubj.CommonName()
+		}
+	}
+	switch orig := m.GetOrig().(type) {
+	case v1.ArtifactManifest:
+		ac.ArtifactType = orig.ArtifactType
+	default:
+		d, err := mi.GetConfig()
+		if err != nil {
+			ls.RaiseError("Failed looking up \"%s\" config: %v", r.r.CommonName(), err)
+		}
+		ac.ArtifactType = d.MediaType
+		ac.Config = s.artifactBlob(ls, r.r, d)
+	}
+	layers, err := mi.GetLayers()
+	if err != nil {
+		ls.RaiseError("Failed looking up \"%s\" layers: %v", r.r.CommonName(), err)
+	}
+	for _, d := range layers {
+		ac.Layers = append(ac.Layers, artifactLayer{
+			MediaType:   d.MediaType,
+			Digest:      d.Digest.String(),
+			Size:        d.Size,
+			Annotations: d.Annotations,
+			Content:     s.artifactBlob(ls, r.r, d),
+		})
+	}
+	ls.Push(go2lua.Export(ls, ac))
+	return 1
+}
+
+// artifactBlob returns the content of a blob
+func (s *Sandbox) artifactBlob(ls *lua.LState, r ref.Ref, d types.Descriptor) string {
+	b, err := s.rc.BlobGet(s.ctx, r, d)
+	if err != nil {
+		ls.RaiseError("Failed retrieving \"%s\" blob %s: %v", r.CommonName(), d.Digest.String(), err)
+	}
+	defer b.Close()
+	content, err := io.ReadAll(b)
+	if err != nil {
+		ls.RaiseError("Failed reading \"%s\" blob %s: %v", r.CommonName(), d.Digest.String(), err)
+	}
+	return string(content)
+}
+
+func (s *Sandbox) artifactPut(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1).r
+	ac := artifactContent{}
+	if ls.GetTop() >= 2 {
+		err = go2lua.Import(ls, ls.Get(2), &ac, ac)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+	}
+	if ac.ArtifactType == "" {
+		ac.ArtifactType = artifactDefaultType
+	}
+	if ac.Config == "" {
+		ac.Config = "{}"
+	}
+	var subjDesc *types.Descriptor
+	if ac.Subject != "" {
+		rSubj, err := s.parseRef(ac.Subject)
+		if err != nil {
+			ls.ArgError(2, "subject parsing failed: "+err.Error())
+		}
+		if !ref.EqualRepository(r, rSubj) {
+			ls.ArgError(2, "subject must be in the same repository as the artifact")
+		}
+		mSubj, err := s.rc.ManifestHead(s.ctx, rSubj)
+		if err != nil {
+			ls.RaiseError("Failed retrieving \"%s\" manifest: %v", rSubj.CommonName(), err)
+		}
+		d := mSubj.GetDescriptor()
+		subjDesc = &types.Descriptor{MediaType: d.MediaType, Digest: d.Digest, Size: d.Size}
+	}
+
+	// build the manifest from the content, blobs are pushed after the dry-run check
+	blobs := map[digest.Digest][]byte{}
+	confDesc := types.Descriptor{
+		MediaType: ac.ArtifactType,
+		Digest:    digest.FromString(ac.Config),
+		Size:      int64(len(ac.Config)),
+	}
+	blobs[confDesc.Digest] = []byte(ac.Config)
+	layers := []types.Descriptor{}
+	for _, al := range ac.Layers {
+		if al.MediaType == "" {
+			al.MediaType = artifactDefaultLayer
+		}
+		d := types.Descriptor{
+			MediaType:   al.MediaType,
+			Digest:      digest.FromString(al.Content),
+			Size:        int64(len(al.Content)),
+			Annotations: al.Annotations,
+		}
+		blobs[d.Digest] = []byte(al.Content)
+		layers = append(layers, d)
+	}
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned:   v1.ManifestSchemaVersion,
+		MediaType:   types.MediaTypeOCI1Manifest,
+		Config:      confDesc,
+		Layers:      layers,
+		Annotations: ac.Annotations,
+		Refers:      subjDesc,
+	}))
+	if err != nil {
+		ls.RaiseError("Failed to create artifact: %v", err)
+	}
+	if ac.ByDigest {
+		r.Tag = ""
+		r.Digest = m.GetDescriptor().Digest.String()
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"script":       s.name,
+		"image":        r.CommonName(),
+		"artifactType": ac.ArtifactType,
+		"subject":      ac.Subject,
+		"dry-run":      s.dryRun,
+	}).Info("Put artifact")
+	s.action("artifact.put", r)
+	if !s.dryRun {
+		for d, content := range blobs {
+			_, err = s.rc.BlobPut(s.ctx, r, types.Descriptor{Digest: d, Size: int64(len(content))}, bytes.NewReader(content))
+			if err != nil {
+				ls.RaiseError("Failed to put blob: %v", err)
+			}
+		}
+		err = s.rc.ManifestPut(s.ctx, r, m)
+		if err != nil {
+			ls.RaiseError("Failed to put manifest: %v", err)
+		}
+		err = s.rc.Close(s.ctx, r)
+		if err != nil {
+			ls.RaiseError("Failed closing reference \"%s\": %v", r.CommonName(), err)
+		}
+	}
+	ls.Push(lua.LString(m.GetDescriptor().Digest.String()))
+	return 1
+}
@@ -190,6 +190,7 @@ func (s *Sandbox) blobPut(ls *lua.LState) int {
 	if rdr == nil {
 		ls.ArgError(2, "blob content expected")
 	}
+	s.action("blob.put", r.r)
 
 	dOut, err := s.rc.BlobPut(s.ctx, r.r, types.Descriptor{Digest: d}, rdr)
 	if err != nil {
@@ -3,11 +3,17 @@ package sandbox
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/types/blob"
 	"github.com/regclient/regclient/types/manifest"
 	v1 "github.com/regclient/regclient/types/oci/v1"
@@ -33,6 +39,7 @@ func setupImage(s *Sandbox) {
 			"manifest":      s.manifestGet,
 			"manifestHead":  s.manifestHead,
 			"manifestList":  s.manifestGetList,
+			"mod":           s.imageMod,
 			"ratelimitWait": s.imageRateLimitWait,
 		},
 		map[string]map[string]lua.LGFunction{
@@ -211,6 +218,7 @@ func (s *Sandbox) imageCopy(ls *lua.LState) int {
 		"includeExternal": lOpts.IncludeExternal,
 		"dry-run":         s.dryRun,
 	}).Info("Copy image")
+	s.action("image.copy", src.r, tgt.r)
 	if s.dryRun {
 		return 0
 	}
@@ -258,6 +266,7 @@ func (s *Sandbox) imageImportTar(ls *lua.LState) int {
 		s.sem.Acquire(s.ctx, 1)
 		defer s.sem.Release(1)
 	}
+	s.action("image.importTar", tgt.r)
 	rs, err := os.Open(file)
 	if err != nil {
 		ls.RaiseError("Failed to read from \"%s\": %v", file, err)
@@ -269,6 +278,201 @@ func (s *Sandbox) imageImportTar(ls *lua.LState) int {
 	return 0
 }
 
+// imageModOpts are the lua options for image.mod
+type imageModOpts struct {
+	Annotations       map[string]string `json:"annotations"`
+	Labels            map[string]string `json:"labels"`
+	LabelToAnnotation bool              `json:"labelToAnnotation"`
+	BuildArgRm        map[string]string `json:"buildArgRm"`
+	ExposeAdd         []string          `json:"exposeAdd"`
+	ExposeRm          []string          `json:"exposeRm"`
+	VolumeAdd         []string          `json:"volumeAdd"`
+	VolumeRm          []string          `json:"volumeRm"`
+	ExternalURLsRm    bool              `json:"externalURLsRm"`
+	ToOCI             bool              `json:"toOCI"`
+	LayerCompress     string            `json:"layerCompress"`
+	LayerRmCreatedBy  string            `json:"layerRmCreatedBy"`
+	LayerStripFile    string            `json:"layerStripFile"`
+	TimeMax           string            `json:"timeMax"`
+	ConfigTimeMax     string            `json:"configTimeMax"`
+	LayerTimeMax      string            `json:"layerTimeMax"`
+	Create            string            `json:"create"`
+	Replace           bool              `json:"replace"`
+}
+
+// modOpts converts the lua options to mod options
+func (lOpts imageModOpts) modOpts() ([]mod.Opts, error) {
+	opts := []mod.Opts{}
+	for _, k := range sortedKeys(lOpts.Annotations) {
+		opts = append(opts, mod.WithAnnotation(k, lOpts.Annotations[k]))
+	}
+	for _, k := range sortedKeys(lOpts.Labels) {
+		opts = append(opts, mod.WithLabel(k, lOpts.Labels[k]))
+	}
+	if lOpts.LabelToAnnotation {
+		opts = append(opts, mod.WithLabelToAnnotation())
+	}
+	for _, k := range sortedKeys(lOpts.BuildArgRm) {
+		re, err := regexp.Compile(lOpts.BuildArgRm[k])
+		if err != nil {
+			return nil, fmt.Errorf("buildArgRm value for %s must be a valid regex: %w", k, err)
+		}
+		opts = append(opts, mod.WithBuildArgRm(k, re))
+	}
+	for _, port := range lOpts.ExposeAdd {
+		opts = append(opts, mod.WithExposeAdd(port))
+	}
+	for _, port := range lOpts.ExposeRm {
+		opts = append(opts, mod.WithExposeRm(port))
+	}
+	for _, vol := range lOpts.VolumeAdd {
+		opts = append(opts, mod.WithVolumeAdd(vol))
+	}
+	for _, vol := range lOpts.VolumeRm {
+		opts = append(opts, mod.WithVolumeRm(vol))
+	}
+	if lOpts.ExternalURLsRm {
+		opts = append(opts, mod.WithExternalURLsRm())
+	}
+	if lOpts.ToOCI {
+		opts = append(opts, mod.WithManifestToOCI())
+	}
+	if lOpts.LayerCompress != "" {
+		ct, err := archive.ParseCompressType(lOpts.LayerCompress)
+		if err != nil {
+			return nil, fmt.Errorf("unknown compression %s: %w", lOpts.LayerCompress, err)
+		}
+		opts = append(opts, mod.WithLayerCompression(ct))
+	}
+	if lOpts.LayerRmCreatedBy != "" {
+		re, err := regexp.Compile(lOpts.LayerRmCreatedBy)
+		if err != nil {
+			return nil, fmt.Errorf("layerRmCreatedBy must be a valid regex: %w", err)
+		}
+		opts = append(opts, mod.WithLayerRmCreatedBy(*re))
+	}
+	if lOpts.LayerStripFile != "" {
+		opts = append(opts, mod.WithLayerStripFile(lOpts.LayerStripFile))
+	}
+	for _, tm := range []struct {
+		val    string
+		config bool
+		layer  bool
+	}{
+		{val: lOpts.TimeMax, config: true, layer: true},
+		{val: lOpts.ConfigTimeMax, config: true},
+		{val: lOpts.LayerTimeMax, layer: true},
+	} {
+		if tm.val == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, tm.val)
+		if err != nil {
+			return nil, fmt.Errorf("time must be formatted %s: %w", time.RFC3339, err)
+		}
+		if tm.config {
+			opts = append(opts, mod.WithConfigTimestampMax(t))
+		}
+		if tm.layer {
+			opts = append(opts, mod.WithLayerTimestampMax(t))
+		}
+	}
+	return opts, nil
+}
+
+// imageMod applies changes to an image, returning a reference to the modified image
+func (s *Sandbox) imageMod(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	lOpts := imageModOpts{}
+	if ls.GetTop() >= 2 {
+		err = go2lua.Import(ls, ls.Get(2), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+	}
+	opts, err := lOpts.modOpts()
+	if err != nil {
+		ls.ArgError(2, err.Error())
+	}
+	var rNew ref.Ref
+	if lOpts.Create != "" {
+		if strings.ContainsAny(lOpts.Create, "/:") {
+			rNew, err = s.parseRef(lOpts.Create)
+			if err != nil {
+				ls.ArgError(2, "create reference parsing failed: "+err.Error())
+			}
+		} else {
+			rNew = r.r
+			rNew.Digest = ""
+			rNew.Tag = lOpts.Create
+		}
+	} else if lOpts.Replace {
+		if r.r.Tag == "" {
+			ls.ArgError(2, "cannot replace an image digest, reference must include a tag")
+		}
+		rNew = r.r
+		rNew.Digest = ""
+	}
+	if s.sem != nil {
+		s.sem.Acquire(s.ctx, 1)
+		defer s.sem.Release(1)
+	}
+	fields := logrus.Fields{
+		"script":  s.name,
+		"image":   r.r.CommonName(),
+		"dry-run": s.dryRun,
+	}
+	if rNew.Tag != "" {
+		fields["target"] = rNew.CommonName()
+	}
+	s.log.WithFields(fields).Info("Modify image")
+	if rNew.Tag != "" {
+		s.action("image.mod", r.r, rNew)
+	} else {
+		s.action("image.mod", r.r)
+	}
+	// the modified image is pushed by digest, so dry-run returns the unmodified reference
+	rOut := r.r
+	if !s.dryRun {
+		rOut, err = mod.Apply(s.ctx, s.rc, r.r, opts...)
+		if err != nil {
+			ls.RaiseError("Failed to modify image \"%s\": %v", r.r.CommonName(), err)
+		}
+		if rNew.Tag != "" {
+			err = s.rc.ImageCopy(s.ctx, rOut, rNew)
+			if err != nil {
+				ls.RaiseError("Failed copying \"%s\" to \"%s\": %v", rOut.CommonName(), rNew.CommonName(), err)
+			}
+			rOut = rNew
+		}
+		err = s.rc.Close(s.ctx, rOut)
+		if err != nil {
+			ls.RaiseError("Failed closing reference \"%s\": %v", rOut.CommonName(), err)
+		}
+	} else if rNew.Tag != "" {
+		rOut = rNew
+	}
+	ud := ls.NewUserData()
+	ud.Value = &reference{r: rOut}
+	ls.SetMetatable(ud, ls.GetTypeMetatable(luaReferenceName))
+	ls.Push(ud)
+	return 1
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (s *Sandbox) imageRateLimit(ls *lua.LState) int {
 	err := s.ctx.Err()
 	if err != nil {
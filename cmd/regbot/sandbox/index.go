@@ -0,0 +1,266 @@
+package sandbox
+
+import (
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func setupIndex(s *Sandbox) {
+	s.setupMod(
+		luaIndexName,
+		map[string]lua.LGFunction{
+			"add":    s.indexAdd,
+			"create": s.indexCreate,
+			"put":    s.indexPut,
+			"remove": s.indexRemove,
+		},
+		map[string]map[string]lua.LGFunction{},
+	)
+}
+
+// checkIndex returns the index at position i along with the list of descriptors
+func (s *Sandbox) checkIndex(ls *lua.LState, i int) (*sbManifest, []types.Descriptor) {
+	m := s.checkManifest(ls, i, true, false)
+	mi, ok := m.m.(manifest.Indexer)
+	if !ok || !m.m.IsList() {
+		ls.ArgError(i, "index expected")
+	}
+	dl, err := mi.GetManifestList()
+	if err != nil {
+		ls.RaiseError("Failed to get manifest list: %v", err)
+	}
+	return m, dl
+}
+
+// pushIndex returns a copy of the index with a new descriptor list to lua
+func (s *Sandbox) pushIndex(ls *lua.LState, m *sbManifest, dl []types.Descriptor) int {
+	newM, err := manifest.New(manifest.WithOrig(m.m.GetOrig()))
+	if err != nil {
+		ls.RaiseError("Failed to copy index: %v", err)
+	}
+	mi, ok := newM.(manifest.Indexer)
+	if !ok {
+		ls.RaiseError("Index methods are not available for manifest")
+	}
+	err = mi.SetManifestList(dl)
+	if err != nil {
+		ls.RaiseError("Failed to update index: %v", err)
+	}
+	sbm := &sbManifest{m: newM, r: m.r}
+	ud, err := wrapUserData(ls, sbm, newM.GetOrig(), luaManifestName)
+	if err != nil {
+		ls.RaiseError("Failed packaging index: %v", err)
+	}
+	ls.Push(ud)
+	return 1
+}
+
+func (s *Sandbox) indexCreate(ls *lua.LState) int {
+	r := s.checkReference(ls, 1)
+	lOpts := struct {
+		Annotations map[string]string `json:"annotations"`
+	}{}
+	if ls.GetTop() >= 2 {
+		err := go2lua.Import(ls, ls.Get(2), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+	}
+	m, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned:   v1.IndexSchemaVersion,
+		MediaType:   types.MediaTypeOCI1ManifestList,
+		Manifests:   []types.Descriptor{},
+		Annotations: lOpts.Annotations,
+	}))
+	if err != nil {
+		ls.RaiseError("Failed to create index: %v", err)
+	}
+	sbm := &sbManifest{m: m, r: r.r}
+	ud, err := wrapUserData(ls, sbm, m.GetOrig(), luaManifestName)
+	if err != nil {
+		ls.RaiseError("Failed packaging index: %v", err)
+	}
+	ls.Push(ud)
+	return 1
+}
+
+func (s *Sandbox) indexAdd(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	m, dl := s.checkIndex(ls, 1)
+	src := s.checkReference(ls, 2)
+	lOpts := struct {
+		Platform    string            `json:"platform"`
+		Annotations map[string]string `json:"annotations"`
+	}{}
+	if ls.GetTop() >= 3 {
+		err := go2lua.Import(ls, ls.Get(3), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+	}
+	srcM, err := s.rc.ManifestGet(s.ctx, src.r)
+	if err != nil {
+		ls.RaiseError("Failed retrieving \"%s\" manifest: %v", src.r.CommonName(), err)
+	}
+	srcDesc := srcM.GetDescriptor()
+	d := types.Descriptor{
+		MediaType:   srcDesc.MediaType,
+		Digest:      srcDesc.Digest,
+		Size:        srcDesc.Size,
+		Annotations: lOpts.Annotations,
+	}
+	if lOpts.Platform != "" {
+		p, err := platform.Parse(lOpts.Platform)
+		if err != nil {
+			ls.ArgError(3, "platform parsing failed: "+err.Error())
+		}
+		d.Platform = &p
+	} else {
+		d.Platform = s.imagePlatform(src.r, srcM)
+	}
+
+	// copy the manifest into the index repository when needed
+	if !ref.EqualRepository(m.r, src.r) {
+		s.indexCopyEntry(ls, src.r, m.r, d.Digest)
+	}
+
+	// replace any entry with the same digest or platform
+	newDL := []types.Descriptor{}
+	for _, cur := range dl {
+		if cur.Digest == d.Digest {
+			continue
+		}
+		if cur.Platform != nil && d.Platform != nil && platform.Match(*cur.Platform, *d.Platform) {
+			continue
+		}
+		newDL = append(newDL, cur)
+	}
+	newDL = append(newDL, d)
+	return s.pushIndex(ls, m, newDL)
+}
+
+// indexCopyEntry copies a manifest by digest from the source to the target repository
+func (s *Sandbox) indexCopyEntry(ls *lua.LState, src, tgt ref.Ref, dig digest.Digest) {
+	rSrc := src
+	rSrc.Tag = ""
+	rSrc.Digest = dig.String()
+	rTgt := tgt
+	rTgt.Tag = ""
+	rTgt.Digest = dig.String()
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"source":  rSrc.CommonName(),
+		"target":  rTgt.CommonName(),
+		"dry-run": s.dryRun,
+	}).Info("Copy image")
+	s.action("image.copy", rSrc, rTgt)
+	if !s.dryRun {
+		if s.sem != nil {
+			s.sem.Acquire(s.ctx, 1)
+			defer s.sem.Release(1)
+		}
+		err := s.rc.ImageCopy(s.ctx, rSrc, rTgt)
+		if err != nil {
+			ls.RaiseError("Failed copying \"%s\" to \"%s\": %v", rSrc.CommonName(), rTgt.CommonName(), err)
+		}
+	}
+}
+
+// imagePlatform returns the platform from an image config, or nil for other manifests
+func (s *Sandbox) imagePlatform(r ref.Ref, m manifest.Manifest) *platform.Platform {
+	mi, ok := m.(manifest.Imager)
+	if !ok || m.IsList() {
+		return nil
+	}
+	cd, err := mi.GetConfig()
+	if err != nil || (cd.MediaType != types.MediaTypeOCI1ImageConfig && cd.MediaType != types.MediaTypeDocker2ImageConfig) {
+		return nil
+	}
+	conf, err := s.rc.BlobGetOCIConfig(s.ctx, r, cd)
+	if err != nil {
+		s.log.WithFields(logrus.Fields{
+			"script": s.name,
+			"image":  r.CommonName(),
+			"err":    err,
+		}).Warn("Failed to get image config for platform")
+		return nil
+	}
+	c := conf.GetConfig()
+	return &platform.Platform{
+		OS:           c.OS,
+		Architecture: c.Architecture,
+		Variant:      c.Variant,
+		OSVersion:    c.OSVersion,
+		OSFeatures:   c.OSFeatures,
+	}
+}
+
+func (s *Sandbox) indexRemove(ls *lua.LState) int {
+	m, dl := s.checkIndex(ls, 1)
+	match := ls.CheckString(2)
+	var p *platform.Platform
+	if _, err := digest.Parse(match); err != nil {
+		pp, err := platform.Parse(match)
+		if err != nil {
+			ls.ArgError(2, "digest or platform expected: "+err.Error())
+		}
+		p = &pp
+	}
+	newDL := []types.Descriptor{}
+	for _, d := range dl {
+		if p == nil && d.Digest.String() == match {
+			continue
+		}
+		if p != nil && d.Platform != nil && platform.Match(*d.Platform, *p) {
+			continue
+		}
+		newDL = append(newDL, d)
+	}
+	return s.pushIndex(ls, m, newDL)
+}
+
+func (s *Sandbox) indexPut(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	m, dl := s.checkIndex(ls, 1)
+	r := m.r
+	if ls.GetTop() >= 2 {
+		r = s.checkReference(ls, 2).r
+	}
+	// entries are only available in the repository of the index, copy them before pushing elsewhere
+	if !ref.EqualRepository(m.r, r) {
+		for _, d := range dl {
+			s.indexCopyEntry(ls, m.r, r, d.Digest)
+		}
+	}
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"image":   r.CommonName(),
+		"dry-run": s.dryRun,
+	}).Info("Put index")
+	s.action("index.put", r)
+	if !s.dryRun {
+		err = s.rc.ManifestPut(s.ctx, r, m.m)
+		if err != nil {
+			ls.RaiseError("Failed to put index \"%s\": %v", r.CommonName(), err)
+		}
+		err = s.rc.Close(s.ctx, r)
+		if err != nil {
+			ls.RaiseError("Failed closing reference \"%s\": %v", r.CommonName(), err)
+		}
+	}
+	ls.Push(lua.LString(m.m.GetDescriptor().Digest.String()))
+	return 1
+}
@@ -46,7 +46,7 @@ func (s *Sandbox) checkManifest(ls *lua.LState, i int, list bool, head bool) *sb
 	var m *sbManifest
 	switch ls.Get(i).Type() {
 	case lua.LTString:
-		r, err := ref.New(ls.CheckString(1))
+		r, err := s.parseRef(ls.CheckString(i))
 		if err != nil {
 			ls.RaiseError("reference parsing failed: %v", err)
 		}
@@ -111,6 +111,7 @@ func (s *Sandbox) manifestDelete(ls *lua.LState) int {
 		"image":   r.CommonName(),
 		"dry-run": s.dryRun,
 	}).Info("Delete manifest")
+	s.action("manifest.delete", r)
 	if s.dryRun {
 		return 0
 	}
@@ -252,6 +253,7 @@ func (s *Sandbox) manifestPut(ls *lua.LState) int {
 		"script": s.name,
 		"image":  r.r.CommonName(),
 	}).Debug("Put manifest")
+	s.action("manifest.put", r.r)
 
 	m, err := manifest.New(manifest.WithOrig(sbm.m.GetOrig()))
 	if err != nil {
@@ -59,7 +59,7 @@ func (s *Sandbox) checkReference(ls *lua.LState, i int) *reference {
 	var r *reference
 	switch ls.Get(i).Type() {
 	case lua.LTString:
-		nr, err := ref.New(ls.CheckString(i))
+		nr, err := s.parseRef(ls.CheckString(i))
 		if err != nil {
 			ls.ArgError(i, "reference parsing failed: "+err.Error())
 		}
@@ -0,0 +1,159 @@
+package sandbox
+
+import (
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func setupReferrer(s *Sandbox) {
+	s.setupMod(
+		luaReferrerName,
+		map[string]lua.LGFunction{
+			"copy":   s.referrerCopy,
+			"delete": s.referrerDelete,
+			"list":   s.referrerList,
+		},
+		map[string]map[string]lua.LGFunction{},
+	)
+}
+
+// checkReferrerOpts parses the optional filter table at position i
+func (s *Sandbox) checkReferrerOpts(ls *lua.LState, i int) []scheme.ReferrerOpts {
+	rOpts := []scheme.ReferrerOpts{}
+	if ls.GetTop() < i || ls.Get(i).Type() == lua.LTNil {
+		return rOpts
+	}
+	lOpts := struct {
+		ArtifactType string            `json:"artifactType"`
+		Annotations  map[string]string `json:"annotations"`
+	}{}
+	err := go2lua.Import(ls, ls.Get(i), &lOpts, lOpts)
+	if err != nil {
+		ls.RaiseError("Failed to parse options: %v", err)
+	}
+	if lOpts.ArtifactType != "" {
+		rOpts = append(rOpts, scheme.WithReferrerAT(lOpts.ArtifactType))
+	}
+	if len(lOpts.Annotations) > 0 {
+		rOpts = append(rOpts, scheme.WithReferrerAnnotations(lOpts.Annotations))
+	}
+	return rOpts
+}
+
+// rcReferrerList returns the referrers to a reference, resolving a tag to the digest
+func (s *Sandbox) rcReferrerList(ls *lua.LState, r *reference, rOpts []scheme.ReferrerOpts) []types.Descriptor {
+	rDig := r.r
+	if rDig.Digest == "" {
+		m, err := s.rc.ManifestHead(s.ctx, rDig)
+		if err != nil {
+			ls.RaiseError("Failed retrieving \"%s\" manifest: %v", r.r.CommonName(), err)
+		}
+		rDig.Digest = m.GetDescriptor().Digest.String()
+	}
+	rl, err := s.rc.ReferrerList(s.ctx, rDig, rOpts...)
+	if err != nil {
+		ls.RaiseError("Failed listing referrers to \"%s\": %v", r.r.CommonName(), err)
+	}
+	return rl.Descriptors
+}
+
+func (s *Sandbox) referrerList(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	rOpts := s.checkReferrerOpts(ls, 2)
+	s.log.WithFields(logrus.Fields{
+		"script": s.name,
+		"image":  r.r.CommonName(),
+	}).Debug("List referrers")
+	dl := s.rcReferrerList(ls, r, rOpts)
+	ls.Push(go2lua.Export(ls, dl))
+	return 1
+}
+
+func (s *Sandbox) referrerCopy(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	src := s.checkReference(ls, 1)
+	tgt := s.checkReference(ls, 2)
+	rOpts := s.checkReferrerOpts(ls, 3)
+	dl := s.rcReferrerList(ls, src, rOpts)
+	if s.sem != nil {
+		s.sem.Acquire(s.ctx, 1)
+		defer s.sem.Release(1)
+	}
+	for _, d := range dl {
+		rSrc := src.r
+		rSrc.Tag = ""
+		rSrc.Digest = d.Digest.String()
+		rTgt := tgt.r
+		rTgt.Tag = ""
+		rTgt.Digest = d.Digest.String()
+		s.log.WithFields(logrus.Fields{
+			"script":  s.name,
+			"source":  rSrc.CommonName(),
+			"target":  rTgt.CommonName(),
+			"dry-run": s.dryRun,
+		}).Info("Copy referrer")
+		s.action("referrer.copy", rSrc, rTgt)
+		if s.dryRun {
+			continue
+		}
+		err = s.rc.ImageCopy(s.ctx, rSrc, rTgt)
+		if err != nil {
+			ls.RaiseError("Failed copying \"%s\" to \"%s\": %v", rSrc.CommonName(), rTgt.CommonName(), err)
+		}
+	}
+	if !s.dryRun {
+		err = s.rc.Close(s.ctx, tgt.r)
+		if err != nil {
+			ls.RaiseError("Failed closing reference \"%s\": %v", tgt.r.CommonName(), err)
+		}
+	}
+	ls.Push(lua.LNumber(len(dl)))
+	return 1
+}
+
+func (s *Sandbox) referrerDelete(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	rOpts := s.checkReferrerOpts(ls, 2)
+	dl := s.rcReferrerList(ls, r, rOpts)
+	for _, d := range dl {
+		rDel := r.r
+		rDel.Tag = ""
+		rDel.Digest = d.Digest.String()
+		s.log.WithFields(logrus.Fields{
+			"script":  s.name,
+			"image":   rDel.CommonName(),
+			"dry-run": s.dryRun,
+		}).Info("Delete referrer")
+		s.action("referrer.delete", rDel)
+		if s.dryRun {
+			continue
+		}
+		err = s.rc.ManifestDelete(s.ctx, rDel, regclient.WithManifestCheckRefers())
+		if err != nil {
+			ls.RaiseError("Failed deleting \"%s\": %v", rDel.CommonName(), err)
+		}
+	}
+	if !s.dryRun {
+		err = s.rc.Close(s.ctx, r.r)
+		if err != nil {
+			ls.RaiseError("Failed closing reference \"%s\": %v", r.r.CommonName(), err)
+		}
+	}
+	ls.Push(lua.LNumber(len(dl)))
+	return 1
+}
@@ -24,6 +24,10 @@ func (s *Sandbox) repoLs(ls *lua.LState) int {
 		ls.ArgError(1, "Expected registry name (host and optional port)")
 	}
 	host := hostLVS.String()
+	// a registry host cannot be rewritten like a reference, so it would reach the live registry
+	if s.refMap != nil {
+		ls.RaiseError("Listing repositories on \"%s\" is not supported when references are rewritten", host)
+	}
 	s.log.WithFields(logrus.Fields{
 		"script": s.name,
 		"host":   host,
@@ -6,6 +6,7 @@ import (
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	lua "github.com/yuin/gopher-lua"
 	"golang.org/x/sync/semaphore"
@@ -19,17 +20,33 @@ const (
 	luaImageName       = "image"
 	luaImageConfigName = "imageconfig"
 	luaBlobName        = "blob"
+	luaReferrerName    = "referrer"
+	luaArtifactName    = "artifact"
+	luaIndexName       = "index"
+	luaStateName       = "state"
 )
 
 // Sandbox defines a lua sandbox
 type Sandbox struct {
-	name   string
-	ctx    context.Context
-	log    *logrus.Logger
-	ls     *lua.LState
-	rc     *regclient.RegClient
-	sem    *semaphore.Weighted
-	dryRun bool
+	name    string
+	ctx     context.Context
+	log     *logrus.Logger
+	ls      *lua.LState
+	rc      *regclient.RegClient
+	sem     *semaphore.Weighted
+	dryRun  bool
+	actions func(Action)
+	refMap  func(ref.Ref) ref.Ref
+	refOrig map[string]ref.Ref
+	state   State
+	globals map[string]interface{}
+}
+
+// Action is a change to a registry requested by a script
+type Action struct {
+	Action string `json:"action" yaml:"action"`
+	Ref    string `json:"ref" yaml:"ref"`
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
 }
 
 // LuaMod defines a mod to add to Lua's sandbox
@@ -42,6 +59,10 @@ var luaMods = []LuaMod{
 	setupImage,
 	setupManifest,
 	setupBlob,
+	setupReferrer,
+	setupArtifact,
+	setupIndex,
+	setupState,
 }
 
 // Opt function to process options on sandbox
@@ -53,9 +74,10 @@ func New(name string, opts ...Opt) *Sandbox {
 	ls := lua.NewState()
 
 	s := &Sandbox{
-		name:   name,
-		ls:     ls,
-		dryRun: false,
+		name:    name,
+		ls:      ls,
+		dryRun:  false,
+		globals: map[string]interface{}{},
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -79,10 +101,20 @@ func New(name string, opts ...Opt) *Sandbox {
 	// add other global functions to sandbox
 	fn := s.ls.NewFunction(s.sandboxLog)
 	s.ls.SetGlobal("log", fn)
+	for name, v := range s.globals {
+		s.ls.SetGlobal(name, go2lua.Export(s.ls, v))
+	}
 
 	return s
 }
 
+// WithActions reports each change to a registry, including changes skipped by a dry-run
+func WithActions(fn func(Action)) Opt {
+	return func(s *Sandbox) {
+		s.actions = fn
+	}
+}
+
 // WithContext defines the context for a sandbox
 func WithContext(ctx context.Context) Opt {
 	return func(s *Sandbox) {
@@ -97,6 +129,13 @@ func WithDryRun() Opt {
 	}
 }
 
+// WithGlobal sets a global variable in the sandbox
+func WithGlobal(name string, v interface{}) Opt {
+	return func(s *Sandbox) {
+		s.globals[name] = v
+	}
+}
+
 // WithLog specifies a logrus logger
 func WithLog(log *logrus.Logger) Opt {
 	return func(s *Sandbox) {
@@ -111,6 +150,21 @@ func WithRegClient(rc *regclient.RegClient) Opt {
 	}
 }
 
+// WithRefMap rewrites each reference parsed from the script.
+// Actions record the reference from the script, and listing repositories on a registry host is rejected.
+func WithRefMap(fn func(ref.Ref) ref.Ref) Opt {
+	return func(s *Sandbox) {
+		s.refMap = fn
+	}
+}
+
+// WithState provides the key/value store for the state module
+func WithState(st State) Opt {
+	return func(s *Sandbox) {
+		s.state = st
+	}
+}
+
 // WithSemaphore defines a semaphore to limit various actions
 func WithSemaphore(sem *semaphore.Weighted) Opt {
 	return func(s *Sandbox) {
@@ -118,6 +172,53 @@ func WithSemaphore(sem *semaphore.Weighted) Opt {
 	}
 }
 
+// action reports a change to a registry
+func (s *Sandbox) action(name string, r ref.Ref, tgt ...ref.Ref) {
+	if s.actions == nil {
+		return
+	}
+	a := Action{Action: name, Ref: s.origRef(r).CommonName()}
+	if len(tgt) > 0 {
+		a.Target = s.origRef(tgt[0]).CommonName()
+	}
+	s.actions(a)
+}
+
+// parseRef parses a reference from the script
+func (s *Sandbox) parseRef(str string) (ref.Ref, error) {
+	r, err := ref.New(str)
+	if err != nil {
+		return r, err
+	}
+	if s.refMap != nil {
+		rMap := s.refMap(r)
+		if s.refOrig == nil {
+			s.refOrig = map[string]ref.Ref{}
+		}
+		s.refOrig[refRepoKey(rMap)] = r
+		r = rMap
+	}
+	return r, nil
+}
+
+// origRef returns the reference from the script before it was rewritten by the ref map
+func (s *Sandbox) origRef(r ref.Ref) ref.Ref {
+	rOrig, ok := s.refOrig[refRepoKey(r)]
+	if !ok {
+		return r
+	}
+	rOrig.Tag = r.Tag
+	rOrig.Digest = r.Digest
+	return rOrig
+}
+
+// refRepoKey returns the repository of a reference without the tag or digest
+func refRepoKey(r ref.Ref) string {
+	r.Tag = ""
+	r.Digest = ""
+	return r.CommonName()
+}
+
 func (s *Sandbox) setupMod(name string, funcs map[string]lua.LGFunction, tables map[string]map[string]lua.LGFunction) {
 	mt := s.ls.NewTypeMetatable(name)
 	s.ls.SetGlobal(name, mt)
@@ -0,0 +1,186 @@
+package sandbox
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// State is a key/value store shared between scripts and persisted between runs.
+// Values are limited to nil, bool, float64, string, []interface{}, and map[string]interface{}.
+type State interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, val interface{}) error
+	Delete(key string) error
+	List() []string
+}
+
+func setupState(s *Sandbox) {
+	s.setupMod(
+		luaStateName,
+		map[string]lua.LGFunction{
+			"delete": s.stateDelete,
+			"get":    s.stateGet,
+			"list":   s.stateList,
+			"set":    s.stateSet,
+		},
+		map[string]map[string]lua.LGFunction{},
+	)
+}
+
+func (s *Sandbox) checkState(ls *lua.LState) State {
+	if s.state == nil {
+		ls.RaiseError("State is not available")
+	}
+	return s.state
+}
+
+func (s *Sandbox) stateGet(ls *lua.LState) int {
+	st := s.checkState(ls)
+	key := ls.CheckString(1)
+	val, ok := st.Get(key)
+	if !ok {
+		ls.Push(lua.LNil)
+		return 1
+	}
+	ls.Push(stateToLua(ls, val))
+	return 1
+}
+
+func (s *Sandbox) stateSet(ls *lua.LState) int {
+	st := s.checkState(ls)
+	key := ls.CheckString(1)
+	val, err := stateFromLua(ls.Get(2), map[*lua.LTable]bool{})
+	if err != nil {
+		ls.ArgError(2, err.Error())
+	}
+	s.log.WithFields(logrus.Fields{
+		"script": s.name,
+		"key":    key,
+	}).Debug("Set state")
+	err = st.Set(key, val)
+	if err != nil {
+		ls.RaiseError("Failed to set state \"%s\": %v", key, err)
+	}
+	return 0
+}
+
+func (s *Sandbox) stateDelete(ls *lua.LState) int {
+	st := s.checkState(ls)
+	key := ls.CheckString(1)
+	s.log.WithFields(logrus.Fields{
+		"script": s.name,
+		"key":    key,
+	}).Debug("Delete state")
+	err := st.Delete(key)
+	if err != nil {
+		ls.RaiseError("Failed to delete state \"%s\": %v", key, err)
+	}
+	return 0
+}
+
+func (s *Sandbox) stateList(ls *lua.LState) int {
+	st := s.checkState(ls)
+	prefix := ls.OptString(1, "")
+	keys := []string{}
+	for _, key := range st.List() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	lTab := ls.NewTable()
+	for _, key := range keys {
+		lTab.Append(lua.LString(key))
+	}
+	ls.Push(lTab)
+	return 1
+}
+
+// stateFromLua converts a lua value to a value that can be saved in the state, parents tracks tables to reject recursion
+func stateFromLua(lv lua.LValue, parents map[*lua.LTable]bool) (interface{}, error) {
+	switch v := lv.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		// json cannot encode NaN or Inf, so the state would never save
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("state does not support non-finite numbers")
+		}
+		return f, nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LTable:
+		if parents[v] {
+			return nil, fmt.Errorf("state does not support recursive tables")
+		}
+		parents[v] = true
+		defer delete(parents, v)
+		// tables with only sequential integer keys are saved as an array
+		count := 0
+		v.ForEach(func(lua.LValue, lua.LValue) { count++ })
+		if count > 0 && count == v.MaxN() {
+			list := make([]interface{}, 0, count)
+			for i := 1; i <= count; i++ {
+				val, err := stateFromLua(v.RawGetInt(i), parents)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, val)
+			}
+			return list, nil
+		}
+		m := map[string]interface{}{}
+		var err error
+		v.ForEach(func(lk, lv lua.LValue) {
+			if err != nil {
+				return
+			}
+			ks, ok := lk.(lua.LString)
+			if !ok {
+				err = fmt.Errorf("state table keys must be strings, found %s", lk.Type().String())
+				return
+			}
+			m[string(ks)], err = stateFromLua(lv, parents)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("state does not support %s values", lv.Type().String())
+	}
+}
+
+// stateToLua converts a state value to lua
+func stateToLua(ls *lua.LState, val interface{}) lua.LValue {
+	switch v := val.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		lTab := ls.NewTable()
+		for _, entry := range v {
+			lTab.Append(stateToLua(ls, entry))
+		}
+		return lTab
+	case map[string]interface{}:
+		lTab := ls.NewTable()
+		for k, entry := range v {
+			lTab.RawSetString(k, stateToLua(ls, entry))
+		}
+		return lTab
+	default:
+		return lua.LNil
+	}
+}
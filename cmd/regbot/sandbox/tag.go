@@ -31,6 +31,7 @@ func (s *Sandbox) tagDelete(ls *lua.LState) int {
 		"image":   r.r.CommonName(),
 		"dry-run": s.dryRun,
 	}).Info("Delete tag")
+	s.action("tag.delete", r.r)
 	if s.dryRun {
 		return 0
 	}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// stateStore is the key/value state shared by scripts, saved to a json file by Flush when configured
+type stateStore struct {
+	mu       sync.Mutex
+	filename string
+	dirty    bool
+	values   map[string]interface{}
+}
+
+// stateLoad reads the state file, a missing file or empty filename returns an empty state
+func stateLoad(filename string) (*stateStore, error) {
+	st := &stateStore{
+		filename: filename,
+		values:   map[string]interface{}{},
+	}
+	if filename == "" {
+		return st, nil
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &st.values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", filename, err)
+	}
+	if st.values == nil {
+		st.values = map[string]interface{}{}
+	}
+	return st, nil
+}
+
+// Get returns the value for a key
+func (st *stateStore) Get(key string) (interface{}, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	val, ok := st.values[key]
+	return val, ok
+}
+
+// Set saves the value for a key, a nil value deletes the key
+func (st *stateStore) Set(key string, val interface{}) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if val == nil {
+		delete(st.values, key)
+	} else {
+		st.values[key] = val
+	}
+	st.dirty = true
+	return nil
+}
+
+// Delete removes a key
+func (st *stateStore) Delete(key string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.values[key]; !ok {
+		return nil
+	}
+	delete(st.values, key)
+	st.dirty = true
+	return nil
+}
+
+// List returns all keys
+func (st *stateStore) List() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	keys := make([]string, 0, len(st.values))
+	for key := range st.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Flush writes any changes to the state file
+func (st *stateStore) Flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.dirty || st.filename == "" {
+		return nil
+	}
+	err := st.save()
+	if err != nil {
+		return err
+	}
+	st.dirty = false
+	return nil
+}
+
+// save writes the state to a temp file and renames it to avoid a partial write, the lock must be held
+func (st *stateStore) save() error {
+	b, err := json.MarshalIndent(st.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(st.filename), filepath.Base(st.filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), st.filename)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	st, err := stateLoad(file)
+	if err != nil {
+		t.Fatalf("failed to load missing state: %v", err)
+	}
+	if len(st.List()) != 0 {
+		t.Errorf("unexpected keys in new state: %v", st.List())
+	}
+	// concurrent updates
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := st.Set(fmt.Sprintf("key%d", i), float64(i))
+			if err != nil {
+				t.Errorf("failed to set key%d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	nested := map[string]interface{}{
+		"firstSeen": float64(1600000000),
+		"tags":      []interface{}{"v1", "v2"},
+		"keep":      true,
+	}
+	err = st.Set("nested", nested)
+	if err != nil {
+		t.Fatalf("failed to set nested: %v", err)
+	}
+	err = st.Delete("key0")
+	if err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	err = st.Set("key1", nil)
+	if err != nil {
+		t.Fatalf("failed to set nil: %v", err)
+	}
+	err = st.Delete("missing")
+	if err != nil {
+		t.Fatalf("failed to delete missing key: %v", err)
+	}
+	// changes are only written by a flush
+	if _, err := os.Stat(file); err == nil {
+		t.Errorf("state file written before flush")
+	}
+	err = st.Flush()
+	if err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	// reload from the file
+	st2, err := stateLoad(file)
+	if err != nil {
+		t.Fatalf("failed to reload state: %v", err)
+	}
+	keys := st2.List()
+	sort.Strings(keys)
+	expectKeys := []string{"key2", "key3", "key4", "key5", "key6", "key7", "key8", "key9", "nested"}
+	if !reflect.DeepEqual(keys, expectKeys) {
+		t.Errorf("unexpected keys: %v, expected %v", keys, expectKeys)
+	}
+	val, ok := st2.Get("nested")
+	if !ok || !reflect.DeepEqual(val, nested) {
+		t.Errorf("unexpected nested value: %v", val)
+	}
+	val, ok = st2.Get("key5")
+	if !ok || val != float64(5) {
+		t.Errorf("unexpected key5 value: %v", val)
+	}
+	// memory only state
+	stMem, err := stateLoad("")
+	if err != nil {
+		t.Fatalf("failed to load memory state: %v", err)
+	}
+	err = stMem.Set("key", "value")
+	if err != nil {
+		t.Errorf("failed to set memory state: %v", err)
+	}
+	err = stMem.Flush()
+	if err != nil {
+		t.Errorf("failed to flush memory state: %v", err)
+	}
+	// invalid file
+	badFile := filepath.Join(t.TempDir(), "bad.json")
+	err = os.WriteFile(badFile, []byte("not json"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write bad file: %v", err)
+	}
+	_, err = stateLoad(badFile)
+	if err == nil {
+		t.Errorf("invalid state file did not fail")
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// triggerInterval is the default time between polls of a watched repository
+	triggerInterval = time.Minute
+	// triggerCheckMax is the default number of existing tags checked for a new digest on each poll
+	triggerCheckMax = 10
+)
+
+// triggerEvent is the change to a tag passed to the script in the "trigger" global
+type triggerEvent struct {
+	Repo      string `json:"repo"`
+	Tag       string `json:"tag"`
+	Ref       string `json:"ref"`
+	OldDigest string `json:"oldDigest"`
+	NewDigest string `json:"newDigest"`
+}
+
+// triggerWatch polls the repositories of a script for changed tags
+type triggerWatch struct {
+	script  ConfigScript
+	repos   []ref.Ref
+	allow   []*regexp.Regexp
+	deny    []*regexp.Regexp
+	digests map[string]map[string]string // repo -> tag -> digest, empty when the digest is not known
+	next    map[string]int               // repo -> index of the next existing tag to check
+}
+
+func triggerNew(s ConfigScript) (*triggerWatch, error) {
+	if s.Trigger == nil || len(s.Trigger.Repos) == 0 {
+		return nil, fmt.Errorf("trigger repos missing for script %s: %w", s.Name, ErrMissingInput)
+	}
+	tw := &triggerWatch{
+		script:  s,
+		repos:   []ref.Ref{},
+		allow:   []*regexp.Regexp{},
+		deny:    []*regexp.Regexp{},
+		digests: map[string]map[string]string{},
+		next:    map[string]int{},
+	}
+	for _, repo := range s.Trigger.Repos {
+		r, err := ref.New(repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trigger repo %s for script %s: %w", repo, s.Name, err)
+		}
+		r.Tag = ""
+		r.Digest = ""
+		tw.repos = append(tw.repos, r)
+	}
+	for _, filter := range s.Trigger.Allow {
+		exp, err := regexp.Compile("^" + filter + "$")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trigger allow %s for script %s: %w", filter, s.Name, err)
+		}
+		tw.allow = append(tw.allow, exp)
+	}
+	for _, filter := range s.Trigger.Deny {
+		exp, err := regexp.Compile("^" + filter + "$")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trigger deny %s for script %s: %w", filter, s.Name, err)
+		}
+		tw.deny = append(tw.deny, exp)
+	}
+	return tw, nil
+}
+
+// run polls the repositories and processes the script once for each change
+func (tw *triggerWatch) run(ctx context.Context) error {
+	var mainErr error
+	for _, ev := range tw.poll(ctx) {
+		if ctx.Err() != nil {
+			return ErrCanceled
+		}
+		log.WithFields(logrus.Fields{
+			"script":    tw.script.Name,
+			"ref":       ev.Ref,
+			"oldDigest": ev.OldDigest,
+			"newDigest": ev.NewDigest,
+		}).Info("Tag change triggered script")
+		err := tw.script.process(ctx, sandbox.WithGlobal("trigger", ev))
+		if err != nil && mainErr == nil {
+			mainErr = err
+		}
+	}
+	return mainErr
+}
+
+// poll returns the changed tags since the previous poll.
+// The first poll of a repository only records the matching tags with an unknown digest, without any head requests.
+// New tags are always checked, while existing tags, including those with an unknown digest, are checked in turns limited by checkMax.
+// A failed head request leaves the tag unchanged to retry on the next poll.
+func (tw *triggerWatch) poll(ctx context.Context) []triggerEvent {
+	events := []triggerEvent{}
+	for _, r := range tw.repos {
+		repo := r.CommonName()
+		tl, err := rc.TagList(ctx, r)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"script": tw.script.Name,
+				"repo":   repo,
+				"error":  err,
+			}).Warn("Failed to list tags")
+			continue
+		}
+		tags, err := tl.GetTags()
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"script": tw.script.Name,
+				"repo":   repo,
+				"error":  err,
+			}).Warn("Failed to list tags")
+			continue
+		}
+		prev, seen := tw.digests[repo]
+		matched := []string{}
+		existing := []string{}
+		for _, tag := range tags {
+			if !tw.match(tag) {
+				continue
+			}
+			matched = append(matched, tag)
+			if _, ok := prev[tag]; ok {
+				existing = append(existing, tag)
+			}
+		}
+		if !seen {
+			// digests are found on later polls, within the checkMax and rate limits
+			cur := map[string]string{}
+			for _, tag := range matched {
+				cur[tag] = ""
+			}
+			tw.digests[repo] = cur
+			continue
+		}
+		sort.Strings(existing)
+		check := map[string]bool{}
+		for _, tag := range matched {
+			if _, ok := prev[tag]; !ok {
+				check[tag] = true
+			}
+		}
+		if tw.script.Trigger.CheckMax < 0 || tw.script.Trigger.CheckMax >= len(existing) {
+			for _, tag := range existing {
+				check[tag] = true
+			}
+		} else {
+			next := tw.next[repo] % len(existing)
+			for i := 0; i < tw.script.Trigger.CheckMax; i++ {
+				check[existing[(next+i)%len(existing)]] = true
+			}
+			tw.next[repo] = (next + tw.script.Trigger.CheckMax) % len(existing)
+		}
+		cur := map[string]string{}
+		limited := false
+		for _, tag := range matched {
+			old, known := prev[tag]
+			if known {
+				cur[tag] = old
+			}
+			if !check[tag] || limited {
+				continue
+			}
+			rTag := r
+			rTag.Tag = tag
+			m, err := rc.ManifestHead(ctx, rTag)
+			if err != nil || manifest.GetDigest(m).String() == "" {
+				log.WithFields(logrus.Fields{
+					"script": tw.script.Name,
+					"ref":    rTag.CommonName(),
+					"error":  err,
+				}).Warn("Failed to get digest")
+				continue
+			}
+			dig := manifest.GetDigest(m).String()
+			cur[tag] = dig
+			// a tag with an unknown digest is recorded without an event
+			if old != dig && !(known && old == "") {
+				events = append(events, triggerEvent{Repo: repo, Tag: tag, Ref: rTag.CommonName(), OldDigest: old, NewDigest: dig})
+			}
+			rl := manifest.GetRateLimit(m)
+			if tw.script.Trigger.RateLimit.Min > 0 && rl.Set && rl.Remain < tw.script.Trigger.RateLimit.Min {
+				log.WithFields(logrus.Fields{
+					"script": tw.script.Name,
+					"repo":   repo,
+					"remain": rl.Remain,
+					"min":    tw.script.Trigger.RateLimit.Min,
+				}).Info("Delaying tag checks for rate limit")
+				limited = true
+			}
+		}
+		deleted := []string{}
+		for tag, old := range prev {
+			if _, ok := cur[tag]; !ok && old != "" {
+				deleted = append(deleted, tag)
+			}
+		}
+		sort.Strings(deleted)
+		for _, tag := range deleted {
+			rTag := r
+			rTag.Tag = tag
+			events = append(events, triggerEvent{Repo: repo, Tag: tag, Ref: rTag.CommonName(), OldDigest: prev[tag]})
+		}
+		tw.digests[repo] = cur
+	}
+	return events
+}
+
+// match applies the allow and deny filters to a tag
+func (tw *triggerWatch) match(tag string) bool {
+	if len(tw.allow) > 0 {
+		found := false
+		for _, exp := range tw.allow {
+			if exp.MatchString(tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, exp := range tw.deny {
+		if exp.MatchString(tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestTrigger(t *testing.T) {
+	ctx := context.Background()
+	fsMem := rwfs.MemNew()
+	err := rwfs.MkdirAll(fsMem, "registry.example.com", 0755)
+	if err != nil {
+		t.Fatalf("failed to setup memfs dir: %v", err)
+	}
+	err = rwfs.CopyRecursive(rwfs.OSNew(""), "testdata/testrepo", fsMem, "registry.example.com/app")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	sem = semaphore.NewWeighted(1)
+	rc = regclient.New(regclient.WithFS(fsMem))
+	state, err = stateLoad("")
+	if err != nil {
+		t.Fatalf("failed to setup state: %v", err)
+	}
+	rootOpts.dryRun = false
+	confBytes := `
+  version: 1
+  defaults:
+    interval: 60m
+  scripts:
+  - name: watch
+    trigger:
+      repos:
+      - ocidir://registry.example.com/app
+      allow:
+      - "v.*"
+      deny:
+      - "v2"
+    script: |
+      if trigger.newDigest == "" then
+        state.set("deleted/" .. trigger.tag, trigger.oldDigest)
+      else
+        state.set("changed/" .. trigger.tag, {repo = trigger.repo, ref = trigger.ref, old = trigger.oldDigest, new = trigger.newDigest})
+      end
+  `
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(confBytes)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	s := conf.Scripts[0]
+	if s.Interval != 0 || s.Trigger.Interval != triggerInterval {
+		t.Errorf("unexpected intervals: script %s, trigger %s", s.Interval.String(), s.Trigger.Interval.String())
+	}
+	tw, err := triggerNew(s)
+	if err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+	events := tw.poll(ctx)
+	if len(events) != 0 {
+		t.Errorf("first poll returned events: %v", events)
+	}
+	// the first poll does not head any tags
+	digs := tw.digests["ocidir://registry.example.com/app"]
+	if len(digs) == 0 {
+		t.Errorf("first poll did not record tags")
+	}
+	for tag, dig := range digs {
+		if dig != "" {
+			t.Errorf("first poll recorded a digest for %s: %s", tag, dig)
+		}
+	}
+	events = tw.poll(ctx)
+	if len(events) != 0 {
+		t.Errorf("second poll returned events: %v", events)
+	}
+	for tag, dig := range tw.digests["ocidir://registry.example.com/app"] {
+		if dig == "" {
+			t.Errorf("second poll did not record a digest for %s", tag)
+		}
+	}
+	getDigest := func(r ref.Ref) string {
+		t.Helper()
+		m, err := rc.ManifestHead(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get digest: %v", err)
+		}
+		return manifest.GetDigest(m).String()
+	}
+	rV1, _ := ref.New("ocidir://registry.example.com/app:v1")
+	digV1 := getDigest(rV1)
+	rV3, _ := ref.New("ocidir://registry.example.com/app:v3")
+	digV3 := getDigest(rV3)
+	// add v4, change v1, delete v3, and add an ignored latest tag
+	copies := [][2]string{
+		{"ocidir://registry.example.com/app:v1", "ocidir://registry.example.com/app:v4"},
+		{"ocidir://registry.example.com/app:v3", "ocidir://registry.example.com/app:v1"},
+		{"ocidir://registry.example.com/app:v4", "ocidir://registry.example.com/app:latest"},
+	}
+	for _, c := range copies {
+		rSrc, _ := ref.New(c[0])
+		rTgt, _ := ref.New(c[1])
+		err = rc.ImageCopy(ctx, rSrc, rTgt)
+		if err != nil {
+			t.Fatalf("failed to copy %s to %s: %v", c[0], c[1], err)
+		}
+	}
+	err = rc.TagDelete(ctx, rV3)
+	if err != nil {
+		t.Fatalf("failed to delete v3: %v", err)
+	}
+	err = tw.run(ctx)
+	if err != nil {
+		t.Fatalf("failed to run trigger: %v", err)
+	}
+	expectKeys := []string{"changed/v1", "changed/v4", "deleted/v3"}
+	keys := state.List()
+	if len(keys) != len(expectKeys) {
+		t.Errorf("unexpected state keys: %v, expected %v", keys, expectKeys)
+	}
+	for _, k := range expectKeys {
+		if _, ok := state.Get(k); !ok {
+			t.Errorf("missing state key %s", k)
+		}
+	}
+	if val, _ := state.Get("deleted/v3"); val != digV3 {
+		t.Errorf("unexpected deleted digest: %v, expected %s", val, digV3)
+	}
+	valGet, _ := state.Get("changed/v1")
+	if val, ok := valGet.(map[string]interface{}); !ok || val["old"] != digV1 || val["new"] != digV3 ||
+		val["repo"] != "ocidir://registry.example.com/app" || val["ref"] != "ocidir://registry.example.com/app:v1" {
+		t.Errorf("unexpected changed v1: %v", val)
+	}
+	valGet, _ = state.Get("changed/v4")
+	if val, ok := valGet.(map[string]interface{}); !ok || val["old"] != "" || val["new"] != digV1 {
+		t.Errorf("unexpected changed v4: %v", val)
+	}
+	events = tw.poll(ctx)
+	if len(events) != 0 {
+		t.Errorf("poll without changes returned events: %v", events)
+	}
+
+	t.Run("CheckMax", func(t *testing.T) {
+		s := conf.Scripts[0]
+		trig := *s.Trigger
+		trig.Allow = []string{"latest", "v.*"}
+		trig.Deny = []string{}
+		trig.CheckMax = 1
+		s.Trigger = &trig
+		tw, err := triggerNew(s)
+		if err != nil {
+			t.Fatalf("failed to create trigger: %v", err)
+		}
+		// each poll finds the digest of one tag without an event
+		for i := 0; i < 5; i++ {
+			events := tw.poll(ctx)
+			if len(events) != 0 {
+				t.Errorf("unexpected events on initial poll %d: %v", i, events)
+			}
+		}
+		for tag, dig := range tw.digests["ocidir://registry.example.com/app"] {
+			if dig == "" {
+				t.Errorf("initial polls did not record a digest for %s", tag)
+			}
+		}
+		// change every existing tag, each poll only checks one of them
+		rV2, _ := ref.New("ocidir://registry.example.com/app:v2")
+		digV2 := getDigest(rV2)
+		copies := [][2]string{
+			{"v4", "v2"},
+			{"v1", "latest"},
+			{"v1", "v4"},
+			{"v2", "v1"},
+		}
+		for _, c := range copies {
+			rSrc, _ := ref.New("ocidir://registry.example.com/app:" + c[0])
+			rTgt, _ := ref.New("ocidir://registry.example.com/app:" + c[1])
+			err = rc.ImageCopy(ctx, rSrc, rTgt)
+			if err != nil {
+				t.Fatalf("failed to copy %s to %s: %v", c[0], c[1], err)
+			}
+		}
+		tags := []string{"latest", "v1", "v2", "v4"}
+		found := []string{}
+		for i := range tags {
+			events := tw.poll(ctx)
+			if len(events) != 1 {
+				t.Fatalf("unexpected events on poll %d: %v", i, events)
+			}
+			found = append(found, events[0].Tag)
+			if events[0].Tag == "v2" && events[0].OldDigest != digV2 {
+				t.Errorf("unexpected old digest for v2: %s, expected %s", events[0].OldDigest, digV2)
+			}
+		}
+		if strings.Join(found, ",") != strings.Join(tags, ",") {
+			t.Errorf("unexpected tags found: %v, expected %v", found, tags)
+		}
+		events := tw.poll(ctx)
+		if len(events) != 0 {
+			t.Errorf("poll without changes returned events: %v", events)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			trig *ConfigTrigger
+		}{
+			{name: "NoTrigger"},
+			{name: "NoRepos", trig: &ConfigTrigger{}},
+			{name: "BadRepo", trig: &ConfigTrigger{Repos: []string{"Invalid:Ref:"}}},
+			{name: "BadAllow", trig: &ConfigTrigger{Repos: []string{"registry.example.com/app"}, Allow: []string{"v[1"}}},
+			{name: "BadDeny", trig: &ConfigTrigger{Repos: []string{"registry.example.com/app"}, Deny: []string{"v[1"}}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := triggerNew(ConfigScript{Name: tt.name, Trigger: tt.trig, Interval: time.Minute})
+				if err == nil {
+					t.Errorf("trigger did not fail")
+				}
+			})
+		}
+		_, err := triggerNew(ConfigScript{Name: "missing"})
+		if !errors.Is(err, ErrMissingInput) {
+			t.Errorf("unexpected error: %v, expected %v", err, ErrMissingInput)
+		}
+	})
+}
@@ -141,7 +141,7 @@ func init() {
 	rootCmd.AddCommand(artifactCmd)
 }
 
-func runArtifactGet(cmd *cobra.Command, args []string) error {
+func runArtifactGet(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	rc := newRegClient()
 
@@ -202,7 +202,7 @@ func runArtifactGet(cmd *cobra.Command, args []string) error {
 	} else {
 		return fmt.Errorf("either a reference or refers must be provided")
 	}
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	// pull the manifest
 	mm, err := rc.ManifestGet(ctx, r)
@@ -362,7 +362,7 @@ func runArtifactGet(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runArtifactList(cmd *cobra.Command, args []string) error {
+func runArtifactList(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 
 	// validate inputs
@@ -372,7 +372,7 @@ func runArtifactList(cmd *cobra.Command, args []string) error {
 	}
 
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	referrerOpts := []scheme.ReferrerOpts{}
 	if artifactOpts.filterAT != "" {
@@ -406,12 +406,11 @@ func runArtifactList(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, artifactOpts.formatList, rl)
 }
 
-func runArtifactPut(cmd *cobra.Command, args []string) error {
+func runArtifactPut(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	mOpts := []manifest.Opts{}
 	hasConfig := false
 	var r, rMan, rArt ref.Ref
-	var err error
 
 	switch artifactOpts.artifactMT {
 	case types.MediaTypeOCI1Artifact:
@@ -471,7 +470,7 @@ func runArtifactPut(cmd *cobra.Command, args []string) error {
 
 	// setup regclient
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	var refDesc *types.Descriptor
 	if !rArt.IsZero() {
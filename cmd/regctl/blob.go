@@ -244,14 +244,14 @@ func runBlobDiffLayer(cmd *cobra.Command, args []string) error {
 	return err
 }
 
-func runBlobGet(cmd *cobra.Command, args []string) error {
+func runBlobGet(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 	if blobOpts.mt != "" {
 		log.WithFields(logrus.Fields{
 			"mt": blobOpts.mt,
@@ -12,7 +12,9 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/signature"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
@@ -113,6 +115,25 @@ The other values may be 0 if not provided by the registry.`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageRateLimit,
 }
+var imageSignCmd = &cobra.Command{
+	Use:   "sign <image_ref>",
+	Short: "sign an image",
+	Long: `Signs an image with a local ECDSA or ed25519 private key.
+The signature uses the cosign simple signing format and is pushed to the image repository.
+By default the signature is saved to the "sha256-<digest>.sig" tag, use "--storage referrers" to push a referrer.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageSign,
+}
+var imageVerifyCmd = &cobra.Command{
+	Use:   "verify <image_ref>",
+	Short: "verify an image signature",
+	Long: `Verifies an image has a cosign simple signing signature from a local public key.
+Signatures are checked from both the digest tag and referrers unless "--storage" is set.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageVerify,
+}
 
 var imageOpts struct {
 	create          string
@@ -122,11 +143,16 @@ var imageOpts struct {
 	digestTags      bool
 	list            bool
 	modOpts         []mod.Opts
+	parallel        int
 	platform        string
 	platforms       []string
 	referrers       bool
 	replace         bool
 	requireList     bool
+	sigAnnotations  []string
+	sigKey          string
+	sigSkipIdentity bool
+	sigStorage      string
 }
 
 func init() {
@@ -134,6 +160,7 @@ func init() {
 
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.forceRecursive, "force-recursive", "", false, "Force recursive copy of image, repairs missing nested blobs and manifests")
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.includeExternal, "include-external", "", false, "Include external layers")
+	imageCopyCmd.Flags().IntVarP(&imageOpts.parallel, "parallel", "", 1, "Number of blobs to copy in parallel")
 	imageCopyCmd.Flags().StringArrayVarP(&imageOpts.platforms, "platforms", "", []string{}, "Copy only specific platforms, registry validation must be disabled")
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.digestTags, "digest-tags", "", false, "Include digest tags (\"sha256-<digest>.*\") when copying manifests")
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.referrers, "referrers", "", false, "Experimental: Include referrers")
@@ -332,6 +359,17 @@ func init() {
 		},
 	}, "label-to-annotation", "", `set annotations from labels`)
 	flagLabelAnnot.NoOptDefVal = "true"
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			ct, err := archive.ParseCompressType(val)
+			if err != nil {
+				return fmt.Errorf("unknown compression %s: %w", val, err)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerCompression(ct))
+			return nil
+		},
+	}, "layer-compress", "", `change layer compression (gzip, none, zstd)`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -418,6 +456,18 @@ func init() {
 	imageRateLimitCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
 	imageRateLimitCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	imageSignCmd.Flags().StringArrayVarP(&imageOpts.sigAnnotations, "annotation", "", []string{}, "Add an optional field to the signed payload (key=value)")
+	imageSignCmd.Flags().StringVarP(&imageOpts.sigKey, "key", "", "", "PEM private key file")
+	imageSignCmd.Flags().StringVarP(&imageOpts.sigStorage, "storage", "", "tag", "Signature storage (tag, referrers)")
+	imageSignCmd.MarkFlagRequired("key")
+
+	imageVerifyCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
+	imageVerifyCmd.Flags().StringVarP(&imageOpts.sigKey, "key", "", "", "PEM public key file")
+	imageVerifyCmd.Flags().BoolVarP(&imageOpts.sigSkipIdentity, "skip-identity", "", false, "Accept signatures created for a different repository")
+	imageVerifyCmd.Flags().StringVarP(&imageOpts.sigStorage, "storage", "", "any", "Signature storage (any, tag, referrers)")
+	imageVerifyCmd.MarkFlagRequired("key")
+	imageVerifyCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+
 	imageCmd.AddCommand(imageCopyCmd)
 	imageCmd.AddCommand(imageDeleteCmd)
 	imageCmd.AddCommand(imageDigestCmd)
@@ -427,10 +477,12 @@ func init() {
 	imageCmd.AddCommand(imageManifestCmd)
 	imageCmd.AddCommand(imageModCmd)
 	imageCmd.AddCommand(imageRateLimitCmd)
+	imageCmd.AddCommand(imageSignCmd)
+	imageCmd.AddCommand(imageVerifyCmd)
 	rootCmd.AddCommand(imageCmd)
 }
 
-func runImageCopy(cmd *cobra.Command, args []string) error {
+func runImageCopy(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	rSrc, err := ref.New(args[0])
 	if err != nil {
@@ -441,8 +493,8 @@ func runImageCopy(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, rSrc)
-	defer rc.Close(ctx, rTgt)
+	defer closeRef(ctx, rc, rSrc, &err)
+	defer closeRef(ctx, rc, rTgt, &err)
 
 	log.WithFields(logrus.Fields{
 		"source":      rSrc.CommonName(),
@@ -466,10 +518,18 @@ func runImageCopy(cmd *cobra.Command, args []string) error {
 	if len(imageOpts.platforms) > 0 {
 		opts = append(opts, regclient.ImageWithPlatforms(imageOpts.platforms))
 	}
+	if imageOpts.parallel > 1 {
+		opts = append(opts, regclient.ImageWithConcurrency(imageOpts.parallel))
+	}
+	if progressEnabled() {
+		ip := newImageProgress(os.Stderr)
+		defer ip.Stop()
+		opts = append(opts, regclient.ImageWithCallback(ip.callback))
+	}
 	return rc.ImageCopy(ctx, rSrc, rTgt, opts...)
 }
 
-func runImageExport(cmd *cobra.Command, args []string) error {
+func runImageExport(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
@@ -485,14 +545,14 @@ func runImageExport(cmd *cobra.Command, args []string) error {
 		w = os.Stdout
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 	log.WithFields(logrus.Fields{
 		"ref": r.CommonName(),
 	}).Debug("Image export")
 	return rc.ImageExport(ctx, r, w)
 }
 
-func runImageImport(cmd *cobra.Command, args []string) error {
+func runImageImport(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
@@ -504,7 +564,7 @@ func runImageImport(cmd *cobra.Command, args []string) error {
 	}
 	defer rs.Close()
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 	log.WithFields(logrus.Fields{
 		"ref":  r.CommonName(),
 		"file": args[1],
@@ -513,14 +573,14 @@ func runImageImport(cmd *cobra.Command, args []string) error {
 	return rc.ImageImport(ctx, r, rs)
 }
 
-func runImageInspect(cmd *cobra.Command, args []string) error {
+func runImageInspect(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	log.WithFields(logrus.Fields{
 		"host":     r.Registry,
@@ -562,7 +622,7 @@ func runImageInspect(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, imageOpts.format, blobConfig)
 }
 
-func runImageMod(cmd *cobra.Command, args []string) error {
+func runImageMod(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
@@ -593,13 +653,13 @@ func runImageMod(cmd *cobra.Command, args []string) error {
 		"ref": r.CommonName(),
 	}).Debug("Modifying image")
 
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 	rOut, err := mod.Apply(ctx, rc, r, imageOpts.modOpts...)
 	if err != nil {
 		return err
 	}
 	if rNew.Tag != "" {
-		defer rc.Close(ctx, rNew)
+		defer closeRef(ctx, rc, rNew, &err)
 		err = rc.ImageCopy(ctx, rOut, rNew)
 		if err != nil {
 			return fmt.Errorf("failed copying image to new name: %w", err)
@@ -634,6 +694,83 @@ func runImageRateLimit(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, imageOpts.format, manifest.GetRateLimit(m))
 }
 
+func runImageSign(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	keyBytes, err := os.ReadFile(imageOpts.sigKey)
+	if err != nil {
+		return err
+	}
+	key, err := signature.LoadPrivateKey(keyBytes)
+	if err != nil {
+		return err
+	}
+	storage, err := signature.ParseStorage(imageOpts.sigStorage)
+	if err != nil {
+		return err
+	}
+	opts := []signature.Opts{signature.WithStorage(storage)}
+	if len(imageOpts.sigAnnotations) > 0 {
+		annotations := map[string]string{}
+		for _, a := range imageOpts.sigAnnotations {
+			aSplit := strings.SplitN(a, "=", 2)
+			if len(aSplit) != 2 {
+				return fmt.Errorf("annotation must be formatted key=value: %s", a)
+			}
+			annotations[aSplit[0]] = aSplit[1]
+		}
+		opts = append(opts, signature.WithAnnotations(annotations))
+	}
+	rc := newRegClient()
+	defer closeRef(ctx, rc, r, &err)
+
+	log.WithFields(logrus.Fields{
+		"ref":     r.CommonName(),
+		"storage": imageOpts.sigStorage,
+	}).Debug("Image sign")
+	_, err = signature.Sign(ctx, rc, r, key, opts...)
+	return err
+}
+
+func runImageVerify(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	keyBytes, err := os.ReadFile(imageOpts.sigKey)
+	if err != nil {
+		return err
+	}
+	pub, err := signature.LoadPublicKey(keyBytes)
+	if err != nil {
+		return err
+	}
+	storage, err := signature.ParseStorage(imageOpts.sigStorage)
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer closeRef(ctx, rc, r, &err)
+
+	log.WithFields(logrus.Fields{
+		"ref":     r.CommonName(),
+		"storage": imageOpts.sigStorage,
+	}).Debug("Image verify")
+	opts := []signature.Opts{signature.WithStorage(storage)}
+	if imageOpts.sigSkipIdentity {
+		opts = append(opts, signature.WithSkipIdentity())
+	}
+	p, err := signature.Verify(ctx, rc, r, pub, opts...)
+	if err != nil {
+		return err
+	}
+	return template.Writer(os.Stdout, imageOpts.format, p)
+}
+
 type modFlagFunc struct {
 	f func(string) error
 	t string
@@ -93,7 +93,7 @@ func init() {
 	rootCmd.AddCommand(indexCmd)
 }
 
-func runIndexAdd(cmd *cobra.Command, args []string) error {
+func runIndexAdd(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 
 	// parse ref
@@ -104,7 +104,7 @@ func runIndexAdd(cmd *cobra.Command, args []string) error {
 
 	// setup regclient
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	// pull existing index
 	m, err := rc.ManifestGet(ctx, r)
@@ -155,7 +155,7 @@ func runIndexAdd(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, indexOpts.format, result)
 }
 
-func runIndexCreate(cmd *cobra.Command, args []string) error {
+func runIndexCreate(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 
 	// validate media type
@@ -171,7 +171,7 @@ func runIndexCreate(cmd *cobra.Command, args []string) error {
 
 	// setup regclient
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	// parse annotations
 	annotations := map[string]string{}
@@ -241,7 +241,7 @@ func runIndexCreate(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, indexOpts.format, result)
 }
 
-func runIndexDelete(cmd *cobra.Command, args []string) error {
+func runIndexDelete(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 
 	// parse ref
@@ -252,7 +252,7 @@ func runIndexDelete(cmd *cobra.Command, args []string) error {
 
 	// setup regclient
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	// pull existing index
 	m, err := rc.ManifestGet(ctx, r)
@@ -198,14 +198,14 @@ func getPlatformDesc(ctx context.Context, rc *regclient.RegClient, m manifest.Ma
 	return desc, nil
 }
 
-func runManifestDelete(cmd *cobra.Command, args []string) error {
+func runManifestDelete(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	if r.Digest == "" && manifestOpts.forceTagDeref {
 		m, err := rc.ManifestHead(ctx, r)
@@ -339,7 +339,7 @@ func runManifestDigest(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runManifestGet(cmd *cobra.Command, args []string) error {
+func runManifestGet(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	if manifestOpts.platform != "" && !flagChanged(cmd, "list") {
 		manifestOpts.list = false
@@ -352,7 +352,7 @@ func runManifestGet(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	m, err := getManifest(ctx, rc, r)
 	if err != nil {
@@ -370,14 +370,14 @@ func runManifestGet(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, manifestOpts.format, m)
 }
 
-func runManifestPut(cmd *cobra.Command, args []string) error {
+func runManifestPut(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 
 	raw, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+const progressFreq = time.Millisecond * 250
+
+// imageProgress tracks the state of an image copy for a live display
+type imageProgress struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	entries map[string]*imageProgressEntry
+	order   []string
+	lines   int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type imageProgressEntry struct {
+	kind       types.CallbackKind
+	state      types.CallbackState
+	start      time.Time
+	cur, total int64
+}
+
+// progressEnabled returns true when a live progress display should be shown on stderr
+func progressEnabled() bool {
+	return term.IsTerminal(int(os.Stderr.Fd())) && log.GetLevel() <= logrus.WarnLevel
+}
+
+// newImageProgress starts a progress display, Stop must be called to output the final state
+func newImageProgress(w io.Writer) *imageProgress {
+	ip := &imageProgress{
+		w:       w,
+		start:   time.Now(),
+		entries: map[string]*imageProgressEntry{},
+		done:    make(chan struct{}),
+	}
+	ip.wg.Add(1)
+	go func() {
+		defer ip.wg.Done()
+		ticker := time.NewTicker(progressFreq)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ip.done:
+				return
+			case <-ticker.C:
+				ip.display(false)
+			}
+		}
+	}()
+	return ip
+}
+
+// callback is passed to regclient.ImageWithCallback
+func (ip *imageProgress) callback(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	e, ok := ip.entries[instance]
+	if !ok {
+		e = &imageProgressEntry{kind: kind, start: time.Now()}
+		ip.entries[instance] = e
+		ip.order = append(ip.order, instance)
+	}
+	// ignore late updates after a final state
+	if e.state == types.CallbackFinished || e.state == types.CallbackSkipped || e.state == types.CallbackMounted {
+		return
+	}
+	if state == types.CallbackStarted {
+		e.start = time.Now()
+	}
+	e.state = state
+	if state != types.CallbackFailed {
+		e.cur = cur
+	}
+	e.total = total
+}
+
+// Stop ends the progress display and outputs a final summary
+func (ip *imageProgress) Stop() {
+	close(ip.done)
+	ip.wg.Wait()
+	ip.display(true)
+}
+
+func (ip *imageProgress) display(final bool) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	var sb strings.Builder
+	// move the cursor back over the previous output
+	if ip.lines > 0 {
+		fmt.Fprintf(&sb, "\033[%dA\033[J", ip.lines)
+	}
+	lines := 0
+	var mCount, mDone, bCount, bDone, bSkip, bMount, failed int
+	var xfer, total int64
+	active := []string{}
+	for _, inst := range ip.order {
+		e := ip.entries[inst]
+		switch e.kind {
+		case types.CallbackManifest:
+			mCount++
+			if e.state == types.CallbackFinished || e.state == types.CallbackSkipped {
+				mDone++
+			}
+		case types.CallbackBlob:
+			bCount++
+			total += e.total
+			switch e.state {
+			case types.CallbackSkipped:
+				bSkip++
+			case types.CallbackMounted:
+				bMount++
+			case types.CallbackFinished:
+				bDone++
+				xfer += e.total
+			case types.CallbackStarted, types.CallbackActive:
+				xfer += e.cur
+				active = append(active, inst)
+			}
+		}
+		if e.state == types.CallbackFailed {
+			failed++
+		}
+	}
+	if !final {
+		sort.SliceStable(active, func(i, j int) bool {
+			return ip.entries[active[i]].start.Before(ip.entries[active[j]].start)
+		})
+		for _, inst := range active {
+			e := ip.entries[inst]
+			pct := 0.0
+			if e.total > 0 {
+				pct = float64(e.cur) / float64(e.total) * 100
+			}
+			rate := ""
+			if sec := time.Since(e.start).Seconds(); sec > 0 {
+				rate = units.HumanSize(float64(e.cur)/sec) + "/s"
+			}
+			fmt.Fprintf(&sb, "  %s %10s / %-10s %5.1f%% %s\n", shortDigest(inst),
+				units.HumanSize(float64(e.cur)), units.HumanSize(float64(e.total)), pct, rate)
+			lines++
+		}
+	}
+	elapsed := time.Since(ip.start).Round(time.Second)
+	fmt.Fprintf(&sb, "Manifests: %d/%d | Blobs: %d/%d copied, %d skipped, %d mounted | %s / %s | %s",
+		mDone, mCount, bDone, bCount, bSkip, bMount,
+		units.HumanSize(float64(xfer)), units.HumanSize(float64(total)), elapsed.String())
+	if failed > 0 {
+		fmt.Fprintf(&sb, " | %d failed", failed)
+	}
+	sb.WriteString("\n")
+	lines++
+	ip.lines = lines
+	if final {
+		ip.lines = 0
+	}
+	_, _ = io.WriteString(ip.w, sb.String())
+}
+
+// shortDigest truncates a digest for display
+func shortDigest(s string) string {
+	if i := strings.Index(s, ":"); i >= 0 && len(s) > i+13 {
+		return s[:i+13]
+	}
+	return s
+}
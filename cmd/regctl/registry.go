@@ -63,6 +63,8 @@ var registryOpts struct {
 	priority             uint
 	repoAuth             bool
 	blobChunk, blobMax   int64
+	blobGetMin           int64
+	blobGetPar           int
 	apiOpts              []string
 	scheme               string   // TODO: remove
 	dns                  []string // TODO: remove
@@ -84,6 +86,8 @@ func init() {
 	registrySetCmd.Flags().BoolVarP(&registryOpts.repoAuth, "repo-auth", "", false, "Separate auth requests per repository instead of per registry")
 	registrySetCmd.Flags().Int64VarP(&registryOpts.blobChunk, "blob-chunk", "", 0, "Blob chunk size")
 	registrySetCmd.Flags().Int64VarP(&registryOpts.blobMax, "blob-max", "", 0, "Blob size before switching to chunked push, -1 to disable")
+	registrySetCmd.Flags().Int64VarP(&registryOpts.blobGetMin, "blob-get-min", "", 0, "Blob size before splitting a pull into parallel range requests")
+	registrySetCmd.Flags().IntVarP(&registryOpts.blobGetPar, "blob-get-par", "", 0, "Number of parallel range requests when pulling large blobs, 0 or 1 to disable")
 	registrySetCmd.Flags().StringArrayVarP(&registryOpts.apiOpts, "api-opts", "", nil, "List of options (key=value))")
 	registrySetCmd.RegisterFlagCompletionFunc("cacert", completeArgNone)
 	registrySetCmd.RegisterFlagCompletionFunc("tls", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -321,6 +325,12 @@ func runRegistrySet(cmd *cobra.Command, args []string) error {
 	if flagChanged(cmd, "blob-max") {
 		h.BlobMax = registryOpts.blobMax
 	}
+	if flagChanged(cmd, "blob-get-min") {
+		h.BlobGetMin = registryOpts.blobGetMin
+	}
+	if flagChanged(cmd, "blob-get-par") {
+		h.BlobGetPar = registryOpts.blobGetPar
+	}
 	if flagChanged(cmd, "api-opts") {
 		if h.APIOpts == nil {
 			h.APIOpts = map[string]string{}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/config"
 	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/scheme/reg"
+	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -53,6 +57,7 @@ var rootOpts struct {
 	logopts   []string
 	format    string // for Go template formatting of various commands
 	userAgent string
+	uploadDir string
 }
 
 func init() {
@@ -67,6 +72,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&rootOpts.verbosity, "verbosity", "v", logrus.WarnLevel.String(), "Log level (debug, info, warn, error, fatal, panic)")
 	rootCmd.PersistentFlags().StringArrayVar(&rootOpts.logopts, "logopt", []string{}, "Log options")
 	rootCmd.PersistentFlags().StringVarP(&rootOpts.userAgent, "user-agent", "", "", "Override user agent")
+	rootCmd.PersistentFlags().StringVarP(&rootOpts.uploadDir, "upload-state", "", "", "Directory to save chunked upload state for resuming interrupted pushes")
 
 	rootCmd.RegisterFlagCompletionFunc("verbosity", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"debug", "info", "warn", "error", "fatal", "panic"}, cobra.ShellCompDirectiveNoFileComp
@@ -140,10 +146,22 @@ func newRegClient() *regclient.RegClient {
 	if len(rcHosts) > 0 {
 		rcOpts = append(rcOpts, regclient.WithConfigHosts(rcHosts))
 	}
+	if rootOpts.uploadDir != "" {
+		rcOpts = append(rcOpts, regclient.WithUploadStore(reg.NewUploadStoreDir(rootOpts.uploadDir)))
+	}
 
 	return regclient.New(rcOpts...)
 }
 
+// closeRef closes a reference, returning the close error unless the command already failed.
+// Changes to an ocifile reference are only written to the tar file when it is closed.
+func closeRef(ctx context.Context, rc *regclient.RegClient, r ref.Ref, err *error) {
+	errC := rc.Close(ctx, r)
+	if errC != nil && *err == nil {
+		*err = fmt.Errorf("failed to close %s: %w", r.CommonName(), errC)
+	}
+}
+
 func setupVCSVars() {
 	verS := struct {
 		VCSRef string
@@ -54,14 +54,14 @@ func init() {
 	rootCmd.AddCommand(tagCmd)
 }
 
-func runTagDelete(cmd *cobra.Command, args []string) error {
+func runTagDelete(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 	log.WithFields(logrus.Fields{
 		"host":       r.Registry,
 		"repository": r.Repository,
@@ -74,14 +74,14 @@ func runTagDelete(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runTagLs(cmd *cobra.Command, args []string) error {
+func runTagLs(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
 	rc := newRegClient()
-	defer rc.Close(ctx, r)
+	defer closeRef(ctx, rc, r, &err)
 	log.WithFields(logrus.Fields{
 		"host":       r.Registry,
 		"repository": r.Repository,
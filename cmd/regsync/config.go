@@ -2,13 +2,19 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/regclient/regclient/config"
 	"github.com/regclient/regclient/pkg/template"
 	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
@@ -28,25 +34,49 @@ func init() {
 // Config is parsed configuration file for regsync
 type Config struct {
 	Version  int            `yaml:"version" json:"version"`
+	Include  []string       `yaml:"include" json:"include"`
 	Creds    []config.Host  `yaml:"creds" json:"creds"`
 	Defaults ConfigDefaults `yaml:"defaults" json:"defaults"`
 	Sync     []ConfigSync   `yaml:"sync" json:"sync"`
 }
 
+// configInclude is the content of an included file
+type configInclude struct {
+	Version  int           `yaml:"version"`
+	Include  []string      `yaml:"include"`
+	Creds    []config.Host `yaml:"creds"`
+	Defaults interface{}   `yaml:"defaults"`
+	Sync     []ConfigSync  `yaml:"sync"`
+}
+
+// configEnvPrefix is the prefix on environment variables that override defaults
+const configEnvPrefix = "REGSYNC_DEFAULTS"
+
 // ConfigDefaults is uses for general options and defaults for ConfigSync entries
 type ConfigDefaults struct {
-	Backup          string          `yaml:"backup" json:"backup"`
-	Interval        time.Duration   `yaml:"interval" json:"interval"`
-	Schedule        string          `yaml:"schedule" json:"schedule"`
-	RateLimit       ConfigRateLimit `yaml:"ratelimit" json:"ratelimit"`
-	Parallel        int             `yaml:"parallel" json:"parallel"`
-	DigestTags      *bool           `yaml:"digestTags" json:"digestTags"`
-	ForceRecursive  *bool           `yaml:"forceRecursive" json:"forceRecursive"`
-	IncludeExternal *bool           `yaml:"includeExternal" json:"includeExternal"`
-	MediaTypes      []string        `yaml:"mediaTypes" json:"mediaTypes"`
-	SkipDockerConf  bool            `yaml:"skipDockerConfig" json:"skipDockerConfig"`
-	Hooks           ConfigHooks     `yaml:"hooks" json:"hooks"`
-	UserAgent       string          `yaml:"userAgent" json:"userAgent"`
+	Backup          string                 `yaml:"backup" json:"backup"`
+	Interval        time.Duration          `yaml:"interval" json:"interval"`
+	Schedule        string                 `yaml:"schedule" json:"schedule"`
+	RateLimit       ConfigRateLimit        `yaml:"ratelimit" json:"ratelimit"`
+	Parallel        int                    `yaml:"parallel" json:"parallel"`
+	ParallelBlobs   int                    `yaml:"parallelBlobs" json:"parallelBlobs"`
+	BlobCache       ConfigBlobCache        `yaml:"blobCache" json:"blobCache"`
+	UploadState     string                 `yaml:"uploadState" json:"uploadState"`
+	Verify          *ConfigVerify          `yaml:"verify" json:"verify"`
+	Prune           *ConfigPrune           `yaml:"prune" json:"prune"`
+	State           string                 `yaml:"state" json:"state"`
+	Report          ConfigReport           `yaml:"report" json:"report"`
+	Listen          string                 `yaml:"listen" json:"listen"`
+	Webhook         *ConfigWebhook         `yaml:"webhook" json:"webhook"`
+	DigestTags      *bool                  `yaml:"digestTags" json:"digestTags"`
+	Referrers       *bool                  `yaml:"referrers" json:"referrers"`
+	ReferrerFilters []ConfigReferrerFilter `yaml:"referrerFilters" json:"referrerFilters"`
+	ForceRecursive  *bool                  `yaml:"forceRecursive" json:"forceRecursive"`
+	IncludeExternal *bool                  `yaml:"includeExternal" json:"includeExternal"`
+	MediaTypes      []string               `yaml:"mediaTypes" json:"mediaTypes"`
+	SkipDockerConf  bool                   `yaml:"skipDockerConfig" json:"skipDockerConfig"`
+	Hooks           ConfigHooks            `yaml:"hooks" json:"hooks"`
+	UserAgent       string                 `yaml:"userAgent" json:"userAgent"`
 }
 
 // ConfigRateLimit is for rate limit settings
@@ -55,29 +85,91 @@ type ConfigRateLimit struct {
 	Retry time.Duration `yaml:"retry" json:"retry"`
 }
 
+// ConfigBlobCache is for the local blob cache settings
+type ConfigBlobCache struct {
+	Dir     string `yaml:"dir" json:"dir"`
+	MaxSize int64  `yaml:"maxSize" json:"maxSize"`
+}
+
+// ConfigReport is for the report written after each sync
+type ConfigReport struct {
+	File   string `yaml:"file" json:"file"`
+	Format string `yaml:"format" json:"format"`
+}
+
+// ConfigWebhook enables the webhook receiver in server mode
+type ConfigWebhook struct {
+	Token string `yaml:"token" json:"token"`
+}
+
 // ConfigSync defines a source/target repository to sync
 type ConfigSync struct {
-	Source          string          `yaml:"source" json:"source"`
-	Target          string          `yaml:"target" json:"target"`
-	Type            string          `yaml:"type" json:"type"`
-	Tags            ConfigTags      `yaml:"tags" json:"tags"`
-	DigestTags      *bool           `yaml:"digestTags" json:"digestTags"`
-	Platform        string          `yaml:"platform" json:"platform"`
-	Platforms       []string        `yaml:"platforms" json:"platforms"`
-	ForceRecursive  *bool           `yaml:"forceRecursive" json:"forceRecursive"`
-	IncludeExternal *bool           `yaml:"includeExternal" json:"includeExternal"`
-	Backup          string          `yaml:"backup" json:"backup"`
-	Interval        time.Duration   `yaml:"interval" json:"interval"`
-	Schedule        string          `yaml:"schedule" json:"schedule"`
-	RateLimit       ConfigRateLimit `yaml:"ratelimit" json:"ratelimit"`
-	MediaTypes      []string        `yaml:"mediaTypes" json:"mediaTypes"`
-	Hooks           ConfigHooks     `yaml:"hooks" json:"hooks"`
-}
-
-// ConfigTags is an allow and deny list of tag regex strings
+	Source          string                 `yaml:"source" json:"source"`
+	Target          string                 `yaml:"target" json:"target"`
+	Type            string                 `yaml:"type" json:"type"`
+	Tags            ConfigTags             `yaml:"tags" json:"tags"`
+	DigestTags      *bool                  `yaml:"digestTags" json:"digestTags"`
+	Referrers       *bool                  `yaml:"referrers" json:"referrers"`
+	ReferrerFilters []ConfigReferrerFilter `yaml:"referrerFilters" json:"referrerFilters"`
+	Platform        string                 `yaml:"platform" json:"platform"`
+	Platforms       []string               `yaml:"platforms" json:"platforms"`
+	PlatformsIndex  bool                   `yaml:"platformsIndex" json:"platformsIndex"`
+	Mod             []ConfigMod            `yaml:"mod" json:"mod"`
+	ForceRecursive  *bool                  `yaml:"forceRecursive" json:"forceRecursive"`
+	IncludeExternal *bool                  `yaml:"includeExternal" json:"includeExternal"`
+	Backup          string                 `yaml:"backup" json:"backup"`
+	Interval        time.Duration          `yaml:"interval" json:"interval"`
+	Schedule        string                 `yaml:"schedule" json:"schedule"`
+	RateLimit       ConfigRateLimit        `yaml:"ratelimit" json:"ratelimit"`
+	MediaTypes      []string               `yaml:"mediaTypes" json:"mediaTypes"`
+	Hooks           ConfigHooks            `yaml:"hooks" json:"hooks"`
+	Verify          *ConfigVerify          `yaml:"verify" json:"verify"`
+	Prune           *ConfigPrune           `yaml:"prune" json:"prune"`
+}
+
+// ConfigReferrerFilter limits the referrers copied by artifact type and annotations
+type ConfigReferrerFilter struct {
+	ArtifactType string            `yaml:"artifactType" json:"artifactType"`
+	Annotations  map[string]string `yaml:"annotations" json:"annotations"`
+}
+
+// ConfigMod is a list of changes applied to each image before it is pushed to the target
+type ConfigMod struct {
+	Annotation        string `yaml:"annotation" json:"annotation"`
+	Label             string `yaml:"label" json:"label"`
+	LabelToAnnotation bool   `yaml:"labelToAnnotation" json:"labelToAnnotation"`
+	ExternalURLsRm    bool   `yaml:"externalURLsRm" json:"externalURLsRm"`
+	ToOCI             bool   `yaml:"toOCI" json:"toOCI"`
+	LayerCompress     string `yaml:"layerCompress" json:"layerCompress"`
+	LayerStripFile    string `yaml:"layerStripFile" json:"layerStripFile"`
+	TimeMax           string `yaml:"timeMax" json:"timeMax"`
+	ConfigTimeMax     string `yaml:"configTimeMax" json:"configTimeMax"`
+	LayerTimeMax      string `yaml:"layerTimeMax" json:"layerTimeMax"`
+}
+
+// ConfigPrune deletes tags from the target that are not found on the source
+type ConfigPrune struct {
+	Mode       string `yaml:"mode" json:"mode"`
+	Max        int    `yaml:"max" json:"max"`
+	Repos      bool   `yaml:"repos" json:"repos"`
+	AllowEmpty bool   `yaml:"allowEmpty" json:"allowEmpty"`
+}
+
+// ConfigVerify requires a valid signature on the source image before syncing
+type ConfigVerify struct {
+	Key          string `yaml:"key" json:"key"`
+	Storage      string `yaml:"storage" json:"storage"`
+	SkipIdentity bool   `yaml:"skipIdentity" json:"skipIdentity"`
+}
+
+// ConfigTags is an allow and deny list of tag regex strings, with optional semver and age filters
 type ConfigTags struct {
-	Allow []string `yaml:"allow" json:"allow"`
-	Deny  []string `yaml:"deny" json:"deny"`
+	Allow        []string      `yaml:"allow" json:"allow"`
+	Deny         []string      `yaml:"deny" json:"deny"`
+	SemverRange  []string      `yaml:"semverRange" json:"semverRange"`
+	SemverLatest int           `yaml:"semverLatest" json:"semverLatest"`
+	MinAge       time.Duration `yaml:"minAge" json:"minAge"`
+	MaxAge       time.Duration `yaml:"maxAge" json:"maxAge"`
 }
 
 // ConfigHooks for commands that run during the sync
@@ -102,8 +194,13 @@ func ConfigNew() *Config {
 	return &c
 }
 
-// ConfigLoadReader reads the config from an io.Reader
+// ConfigLoadReader reads the config from an io.Reader, included files are relative to the current directory
 func ConfigLoadReader(r io.Reader) (*Config, error) {
+	return configLoad(r, ".")
+}
+
+// configLoad reads the config, resolving included files relative to dir
+func configLoad(r io.Reader, dir string) (*Config, error) {
 	c := ConfigNew()
 	if err := yaml.NewDecoder(r).Decode(c); err != nil && !errors.Is(err, io.EOF) {
 		return nil, err
@@ -112,22 +209,58 @@ func ConfigLoadReader(r io.Reader) (*Config, error) {
 	if c.Version > 1 {
 		return c, ErrUnsupportedConfigVersion
 	}
+	files, err := configIncludeFiles(c.Include, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		err = configIncludeFile(c, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = configEnvDefaults(&c.Defaults, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	// the webhook triggers syncs, so it must not be open to anyone that can reach the listener
+	if c.Defaults.Webhook != nil && c.Defaults.Webhook.Token == "" {
+		return nil, fmt.Errorf("webhook requires a token: %w", ErrMissingInput)
+	}
 	// apply top level defaults
 	if c.Defaults.RateLimit.Retry < rateLimitRetryMin {
 		c.Defaults.RateLimit.Retry = rateLimitRetryMin
 	}
 	// apply defaults to each step
 	for i := range c.Sync {
+		// referrers are attached to the source digest, which is not pushed to the target tag
+		s := c.Sync[i]
+		if len(s.Mod) > 0 || (s.PlatformsIndex && len(s.Platforms) > 0) {
+			if s.Referrers != nil && *s.Referrers {
+				return nil, fmt.Errorf("referrers cannot be combined with mod or platformsIndex, sync %s to %s: %w", s.Source, s.Target, ErrInvalidInput)
+			} else if s.Referrers == nil && c.Defaults.Referrers != nil && *c.Defaults.Referrers {
+				log.WithFields(logrus.Fields{
+					"source": s.Source,
+					"target": s.Target,
+				}).Warn("Referrers are not copied with mod or platformsIndex, skipping the referrers default")
+				b := false
+				c.Sync[i].Referrers = &b
+			}
+		}
 		syncSetDefaults(&c.Sync[i], c.Defaults)
+		// validate the mod list before running any syncs
+		if _, err := c.Sync[i].modOpts(ref.Ref{}); err != nil {
+			return nil, err
+		}
 	}
-	err := configExpandTemplates(c)
+	err = configExpandTemplates(c)
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-// ConfigLoadFile loads the config from a specified filename
+// ConfigLoadFile loads the config from a specified filename, included files are relative to the config file
 func ConfigLoadFile(filename string) (*Config, error) {
 	_, err := os.Stat(filename)
 	if err == nil {
@@ -136,7 +269,7 @@ func ConfigLoadFile(filename string) (*Config, error) {
 			return nil, err
 		}
 		defer file.Close()
-		c, err := ConfigLoadReader(file)
+		c, err := configLoad(file, filepath.Dir(filename))
 		if err != nil {
 			return nil, err
 		}
@@ -145,6 +278,110 @@ func ConfigLoadFile(filename string) (*Config, error) {
 	return nil, err
 }
 
+// configIncludeFiles expands the include globs to a sorted list of files without duplicates
+func configIncludeFiles(include []string, dir string) ([]string, error) {
+	files := []string{}
+	found := map[string]bool{}
+	for _, pattern := range include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %s: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if !found[match] {
+				found[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// configIncludeFile appends the creds and sync steps from an included file
+func configIncludeFile(c *Config, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	inc := configInclude{}
+	if err := yaml.NewDecoder(file).Decode(&inc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	if inc.Version > 1 {
+		return fmt.Errorf("%s: %w", filename, ErrUnsupportedConfigVersion)
+	}
+	// creds are only loaded on startup, so they are rejected rather than ignored on a reload
+	if len(inc.Include) > 0 || inc.Defaults != nil || len(inc.Creds) > 0 {
+		return fmt.Errorf("included file %s may only contain sync: %w", filename, ErrInvalidInput)
+	}
+	c.Sync = append(c.Sync, inc.Sync...)
+	return nil
+}
+
+// configEnvDefaults overrides defaults from environment variables named after the yaml keys,
+// e.g. REGSYNC_DEFAULTS_PARALLEL or REGSYNC_DEFAULTS_RATELIMIT_MIN
+func configEnvDefaults(d *ConfigDefaults, lookup func(string) (string, bool)) error {
+	_, err := configEnvStruct(reflect.ValueOf(d).Elem(), configEnvPrefix, lookup)
+	return err
+}
+
+// configEnvStruct sets each field of a struct from the environment, returning true if any field was set
+func configEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	changed := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		fv := v.Field(i)
+		if val, ok := lookup(name); ok {
+			if f.Type.Kind() == reflect.String {
+				// strings are not parsed to allow values like "@every 1h"
+				fv.SetString(val)
+			} else {
+				nv := reflect.New(f.Type)
+				err := yaml.Unmarshal([]byte(val), nv.Interface())
+				if err != nil {
+					return changed, fmt.Errorf("failed to parse %s: %w", name, err)
+				}
+				fv.Set(nv.Elem())
+			}
+			changed = true
+			continue
+		}
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			c, err := configEnvStruct(fv, name, lookup)
+			if err != nil {
+				return changed, err
+			}
+			changed = changed || c
+		case f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct:
+			// a copy is modified to avoid changing a shared value
+			nv := reflect.New(f.Type.Elem())
+			if !fv.IsNil() {
+				nv.Elem().Set(fv.Elem())
+			}
+			c, err := configEnvStruct(nv.Elem(), name, lookup)
+			if err != nil {
+				return changed, err
+			}
+			if c {
+				fv.Set(nv)
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
 // expand templates in various parts of the config
 func configExpandTemplates(c *Config) error {
 	dataSync := struct {
@@ -219,6 +456,13 @@ func syncSetDefaults(s *ConfigSync, d ConfigDefaults) {
 		b := (d.DigestTags != nil && *d.DigestTags)
 		s.DigestTags = &b
 	}
+	if s.Referrers == nil {
+		b := (d.Referrers != nil && *d.Referrers)
+		s.Referrers = &b
+	}
+	if s.ReferrerFilters == nil && d.ReferrerFilters != nil {
+		s.ReferrerFilters = d.ReferrerFilters
+	}
 	if s.ForceRecursive == nil {
 		b := (d.ForceRecursive != nil && *d.ForceRecursive)
 		s.ForceRecursive = &b
@@ -236,4 +480,10 @@ func syncSetDefaults(s *ConfigSync, d ConfigDefaults) {
 	if s.Hooks.Unchanged == nil && d.Hooks.Unchanged != nil {
 		s.Hooks.Unchanged = d.Hooks.Unchanged
 	}
+	if s.Verify == nil && d.Verify != nil {
+		s.Verify = d.Verify
+	}
+	if s.Prune == nil && d.Prune != nil {
+		s.Prune = d.Prune
+	}
 }
@@ -5,10 +5,14 @@ import "errors"
 var (
 	// ErrCanceled is used when context is canceled before task completes
 	ErrCanceled = errors.New("task was canceled")
+	// ErrCreatedMissing when an image does not have a created time for the age filters
+	ErrCreatedMissing = errors.New("created time not available")
 	// ErrInvalidInput indicates a required field is invalid
 	ErrInvalidInput = errors.New("invalid input")
 	// ErrMissingInput indicates a required field is missing
 	ErrMissingInput = errors.New("required input missing")
+	// ErrPruneLimit when a prune would exceed the maximum deletions
+	ErrPruneLimit = errors.New("prune limit exceeded")
 	// ErrNotImplemented returned when method has not been implemented yet
 	ErrNotImplemented = errors.New("not implemented")
 	// ErrNotFound when anything else isn't found
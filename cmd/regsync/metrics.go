@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+)
+
+// syncMetrics tracks counters for each sync step, output in the Prometheus text format
+type syncMetrics struct {
+	mu    sync.Mutex
+	ready bool
+	syncs map[string]*metricsSync
+}
+
+type metricsSync struct {
+	source, target string
+	checked        int64
+	copied         int64
+	failed         int64
+	bytes          int64
+	runs           int64
+	runFailures    int64
+	durationSum    float64
+	lastSuccess    time.Time
+	rlSet          bool
+	rlRemain       int
+	rlLimit        int
+}
+
+func metricsNew() *syncMetrics {
+	return &syncMetrics{
+		syncs: map[string]*metricsSync{},
+	}
+}
+
+// entry returns the metrics for a sync step, the lock must be held
+func (m *syncMetrics) entry(s ConfigSync) *metricsSync {
+	key := syncKey(s)
+	ms, ok := m.syncs[key]
+	if !ok {
+		ms = &metricsSync{source: s.Source, target: s.Target}
+		m.syncs[key] = ms
+	}
+	return ms
+}
+
+// addImage counts the result of an image sync
+func (m *syncMetrics) addImage(s ConfigSync, status string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms := m.entry(s)
+	ms.checked++
+	switch status {
+	case statusCopied:
+		ms.copied++
+	case statusFailed, statusRateLimited:
+		ms.failed++
+	}
+}
+
+// addBytes counts bytes copied for a sync step
+func (m *syncMetrics) addBytes(s ConfigSync, n int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entry(s).bytes += n
+}
+
+// setRateLimit records the last rate limit seen on the source
+func (m *syncMetrics) setRateLimit(s ConfigSync, rl types.RateLimit) {
+	if m == nil || !rl.Set {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms := m.entry(s)
+	ms.rlSet = true
+	ms.rlRemain = rl.Remain
+	ms.rlLimit = rl.Limit
+}
+
+// endSync records the duration and result of a sync step
+func (m *syncMetrics) endSync(s ConfigSync, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms := m.entry(s)
+	ms.runs++
+	ms.durationSum += time.Since(start).Seconds()
+	if err != nil {
+		ms.runFailures++
+	} else {
+		ms.lastSuccess = time.Now()
+	}
+}
+
+// setReady is called after the initial sync completes
+func (m *syncMetrics) setReady() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.ready = true
+	m.mu.Unlock()
+}
+
+// write outputs the metrics in the Prometheus text exposition format
+func (m *syncMetrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.syncs))
+	for k := range m.syncs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	metrics := []struct {
+		name, help, kind string
+		value            func(ms *metricsSync) (string, bool)
+	}{
+		{"regsync_images_checked_total", "Images checked by the sync step.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.checked), true }},
+		{"regsync_images_copied_total", "Images copied by the sync step.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.copied), true }},
+		{"regsync_images_failed_total", "Images that failed to copy, including rate limits.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.failed), true }},
+		{"regsync_bytes_copied_total", "Bytes of blobs copied by the sync step.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.bytes), true }},
+		{"regsync_sync_runs_total", "Runs of the sync step.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.runs), true }},
+		{"regsync_sync_failures_total", "Runs of the sync step that returned an error.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.runFailures), true }},
+		{"regsync_sync_duration_seconds_total", "Total time spent running the sync step.", "counter",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%g", ms.durationSum), true }},
+		{"regsync_sync_last_success_timestamp_seconds", "Time of the last successful run of the sync step.", "gauge",
+			func(ms *metricsSync) (string, bool) {
+				return fmt.Sprintf("%d", ms.lastSuccess.Unix()), !ms.lastSuccess.IsZero()
+			}},
+		{"regsync_ratelimit_remaining", "Last rate limit remaining reported by the source registry.", "gauge",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.rlRemain), ms.rlSet }},
+		{"regsync_ratelimit_limit", "Last rate limit reported by the source registry.", "gauge",
+			func(ms *metricsSync) (string, bool) { return fmt.Sprintf("%d", ms.rlLimit), ms.rlSet }},
+	}
+	for _, metric := range metrics {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			ms := m.syncs[k]
+			val, ok := metric.value(ms)
+			if !ok {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "%s{source=\"%s\",target=\"%s\"} %s\n", metric.name, metricsLabel(ms.source), metricsLabel(ms.target), val)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var metricsLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsLabel escapes a label value
+func metricsLabel(s string) string {
+	return metricsLabelReplacer.Replace(s)
+}
+
+// handler returns the http handler for the metrics and health endpoints
+func (m *syncMetrics) handler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		err := m.write(w)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Debug("Failed to write metrics")
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		ready := m.ready
+		m.mu.Unlock()
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("initial sync running\n"))
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+// httpServe runs the http listener until the context is canceled
+func httpServe(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- srv.ListenAndServe()
+	}()
+	log.WithFields(logrus.Fields{
+		"listen": addr,
+	}).Info("HTTP listener started")
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+	}
+	shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutCtx)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient/types"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metricsNew()
+	s := ConfigSync{Source: "docker.io/library/alpine", Target: `registry:5000/"alpine"`}
+	m.addImage(s, statusCopied)
+	m.addImage(s, statusSkipped)
+	m.addImage(s, statusFailed)
+	m.addBytes(s, 1024)
+	m.setRateLimit(s, types.RateLimit{Set: true, Remain: 42, Limit: 100})
+	m.endSync(s, time.Now().Add(-2*time.Second), nil)
+	m.endSync(s, time.Now(), errors.New("failed"))
+	ts := httptest.NewServer(m.handler())
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("failed to get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		return resp.StatusCode, string(b)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("unexpected healthz status: %d", code)
+	}
+	if code, _ := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected readyz status before ready: %d", code)
+	}
+	m.setReady()
+	if code, _ := get("/readyz"); code != http.StatusOK {
+		t.Errorf("unexpected readyz status after ready: %d", code)
+	}
+	code, body := get("/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected metrics status: %d", code)
+	}
+	labels := `{source="docker.io/library/alpine",target="registry:5000/\"alpine\""}`
+	for _, expect := range []string{
+		"# TYPE regsync_images_checked_total counter",
+		"regsync_images_checked_total" + labels + " 3",
+		"regsync_images_copied_total" + labels + " 1",
+		"regsync_images_failed_total" + labels + " 1",
+		"regsync_bytes_copied_total" + labels + " 1024",
+		"regsync_sync_runs_total" + labels + " 2",
+		"regsync_sync_failures_total" + labels + " 1",
+		"regsync_sync_last_success_timestamp_seconds" + labels + " ",
+		"regsync_ratelimit_remaining" + labels + " 42",
+		"regsync_ratelimit_limit" + labels + " 100",
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("metrics missing %s", expect)
+		}
+	}
+}
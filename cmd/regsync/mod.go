@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// annotationMod is set on a modified image to a digest of the mod list
+const annotationMod = "io.regclient.regsync.mod"
+
+// modOpts converts the mod list to options for mod.Apply, expanding templates with the source ref
+func (s ConfigSync) modOpts(src ref.Ref) ([]mod.Opts, error) {
+	data := struct {
+		Ref  ref.Ref
+		Sync ConfigSync
+	}{Ref: src, Sync: s}
+	opts := []mod.Opts{}
+	for _, cm := range s.Mod {
+		if cm.Annotation != "" {
+			val, err := template.String(cm.Annotation, data)
+			if err != nil {
+				return nil, err
+			}
+			vs := strings.SplitN(val, "=", 2)
+			if len(vs) == 1 {
+				vs = append(vs, "")
+			}
+			opts = append(opts, mod.WithAnnotation(vs[0], vs[1]))
+		}
+		if cm.Label != "" {
+			val, err := template.String(cm.Label, data)
+			if err != nil {
+				return nil, err
+			}
+			vs := strings.SplitN(val, "=", 2)
+			if len(vs) == 1 {
+				vs = append(vs, "")
+			}
+			opts = append(opts, mod.WithLabel(vs[0], vs[1]))
+		}
+		if cm.LabelToAnnotation {
+			opts = append(opts, mod.WithLabelToAnnotation())
+		}
+		if cm.ExternalURLsRm {
+			opts = append(opts, mod.WithExternalURLsRm())
+		}
+		if cm.ToOCI {
+			opts = append(opts, mod.WithManifestToOCI())
+		}
+		if cm.LayerCompress != "" {
+			ct, err := archive.ParseCompressType(cm.LayerCompress)
+			if err != nil {
+				return nil, fmt.Errorf("unknown compression %s: %w", cm.LayerCompress, err)
+			}
+			opts = append(opts, mod.WithLayerCompression(ct))
+		}
+		if cm.LayerStripFile != "" {
+			opts = append(opts, mod.WithLayerStripFile(cm.LayerStripFile))
+		}
+		for _, tm := range []struct {
+			val    string
+			config bool
+			layer  bool
+		}{
+			{val: cm.TimeMax, config: true, layer: true},
+			{val: cm.ConfigTimeMax, config: true},
+			{val: cm.LayerTimeMax, layer: true},
+		} {
+			if tm.val == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, tm.val)
+			if err != nil {
+				return nil, fmt.Errorf("time must be formatted %s: %w", time.RFC3339, err)
+			}
+			if tm.config {
+				opts = append(opts, mod.WithConfigTimestampMax(t))
+			}
+			if tm.layer {
+				opts = append(opts, mod.WithLayerTimestampMax(t))
+			}
+		}
+	}
+	return opts, nil
+}
+
+// modHash returns a digest of the mod list, used to detect a changed configuration
+func (s ConfigSync) modHash() (string, error) {
+	b, err := json.Marshal(s.Mod)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(b).String(), nil
+}
+
+// modMatch returns true when the target was modified from the source digest with the current mod list
+func (s ConfigSync) modMatch(ctx context.Context, tgt ref.Ref, srcDigest string) (bool, error) {
+	m, err := rc.ManifestGet(ctx, tgt)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"target": tgt.CommonName(),
+			"error":  err,
+		}).Error("Failed to get target manifest")
+		return false, err
+	}
+	ma, ok := m.(manifest.Annotator)
+	if !ok {
+		return false, nil
+	}
+	annot, err := ma.GetAnnotations()
+	if err != nil {
+		return false, nil
+	}
+	hash, err := s.modHash()
+	if err != nil {
+		return false, err
+	}
+	return annot[regclient.AnnotationSourceDigest] == srcDigest && annot[annotationMod] == hash, nil
+}
+
+// copyMod copies the image to the target by digest, applies the mods, and then pushes the modified image to the target tag.
+// The unmodified image is deleted from the target when it did not exist before the copy.
+func (s ConfigSync) copyMod(ctx context.Context, src, tgt ref.Ref, srcDigest string, opts []regclient.ImageOpts) error {
+	modOpts, err := s.modOpts(src)
+	if err != nil {
+		return err
+	}
+	hash, err := s.modHash()
+	if err != nil {
+		return err
+	}
+	// the marker annotations are only pushed with the modified image
+	modOpts = append(modOpts,
+		mod.WithAnnotation(regclient.AnnotationSourceDigest, srcDigest),
+		mod.WithAnnotation(annotationMod, hash),
+	)
+	// avoid pushing the unmodified image to the target tag
+	tgtMod := tgt
+	tgtMod.Tag = ""
+	tgtMod.Digest = srcDigest
+	var mStage manifest.Manifest
+	if s.PlatformsIndex && len(s.Platforms) > 0 {
+		mSrc, err := rc.ManifestGet(ctx, src)
+		if err != nil {
+			return err
+		}
+		mStage, err = regclient.ImagePlatformsIndex(mSrc, s.Platforms)
+		if err != nil {
+			return err
+		}
+		tgtMod.Digest = manifest.GetDigest(mStage).String()
+	}
+	_, err = rc.ManifestHead(ctx, tgtMod)
+	staged := err != nil
+	if mStage != nil {
+		err = platformsIndexCopy(ctx, src, tgtMod, mStage, opts)
+	} else {
+		err = rc.ImageCopy(ctx, src, tgtMod, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	rOut, err := mod.Apply(ctx, rc, tgtMod, modOpts...)
+	if err == nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"target": tgt.CommonName(),
+			"digest": rOut.Digest,
+		}).Debug("Image modified")
+		err = rc.ImageCopy(ctx, rOut, tgt)
+	} else {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"target": tgt.CommonName(),
+			"error":  err,
+		}).Error("Failed to modify image")
+	}
+	// a failed mod returns the unmodified ref, which is also removed
+	if staged && (err != nil || rOut.Digest != tgtMod.Digest) {
+		if errDel := rc.ManifestDelete(ctx, tgtMod); errDel != nil {
+			log.WithFields(logrus.Fields{
+				"target": tgtMod.CommonName(),
+				"error":  errDel,
+			}).Warn("Failed to delete the unmodified image")
+		}
+	}
+	return err
+}
+
+// platformsIndexCopy copies each platform in the rewritten index and pushes the index by digest
+func platformsIndexCopy(ctx context.Context, src, tgt ref.Ref, mIdx manifest.Manifest, opts []regclient.ImageOpts) error {
+	mi, ok := mIdx.(manifest.Indexer)
+	if !ok {
+		return fmt.Errorf("manifest is not an index: %w", types.ErrUnsupportedMediaType)
+	}
+	dl, err := mi.GetManifestList()
+	if err != nil {
+		return err
+	}
+	for _, d := range dl {
+		srcChild := src
+		srcChild.Tag = ""
+		srcChild.Digest = d.Digest.String()
+		tgtChild := tgt
+		tgtChild.Tag = ""
+		tgtChild.Digest = d.Digest.String()
+		err = rc.ImageCopy(ctx, srcChild, tgtChild, opts...)
+		if err != nil {
+			return err
+		}
+	}
+	return rc.ManifestPut(ctx, tgt, mIdx)
+}
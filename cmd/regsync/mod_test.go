@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestMod(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-mod:v1
+    type: image
+    mod:
+    - annotation: "org.example.source={{ .Ref.CommonName }}"
+    - toOCI: true
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	_, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-mod:v1
+    type: image
+    mod:
+    - timeMax: yesterday
+  `)))
+	if err == nil {
+		t.Errorf("invalid mod did not fail")
+	}
+
+	src, _ := ref.New("ocidir://testrepo:v1")
+	tgt, _ := ref.New("ocidir://test-mod:v1")
+	mSrc, err := rc.ManifestHead(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	srcDigest := manifest.GetDigest(mSrc).String()
+	s := conf.Sync[0]
+	err = s.process(ctx, "once")
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	mTgt, err := rc.ManifestGet(ctx, tgt)
+	if err != nil {
+		t.Fatalf("failed to get target: %v", err)
+	}
+	tgtDigest := manifest.GetDigest(mTgt).String()
+	if tgtDigest == srcDigest {
+		t.Errorf("target was not modified")
+	}
+	annot, err := mTgt.(manifest.Annotator).GetAnnotations()
+	if err != nil {
+		t.Fatalf("failed to get annotations: %v", err)
+	}
+	if annot[regclient.AnnotationSourceDigest] != srcDigest {
+		t.Errorf("unexpected source digest annotation, expected %s, received %s", srcDigest, annot[regclient.AnnotationSourceDigest])
+	}
+	if annot["org.example.source"] != src.CommonName() {
+		t.Errorf("unexpected annotation, expected %s, received %s", src.CommonName(), annot["org.example.source"])
+	}
+	match, err := s.modMatch(ctx, tgt, srcDigest)
+	if err != nil || !match {
+		t.Errorf("modified target does not match source: %v", err)
+	}
+
+	// a second sync should skip the already modified image
+	err = s.process(ctx, "once")
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	mTgt, err = rc.ManifestHead(ctx, tgt)
+	if err != nil {
+		t.Fatalf("failed to head target: %v", err)
+	}
+	if manifest.GetDigest(mTgt).String() != tgtDigest {
+		t.Errorf("target changed on second sync")
+	}
+}
+
+func TestModFailure(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	// xz is a valid compression but cannot be used for image layers
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-mod-fail:v1
+    type: image
+    mod:
+    - layerCompress: xz
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	src, _ := ref.New("ocidir://testrepo:v1")
+	mSrc, err := rc.ManifestHead(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	s := conf.Sync[0]
+	err = s.process(ctx, "once")
+	if err == nil {
+		t.Errorf("sync did not fail")
+	}
+	tgt, _ := ref.New("ocidir://test-mod-fail:v1")
+	if _, err := rc.ManifestHead(ctx, tgt); err == nil {
+		t.Errorf("target tag was pushed after a failed mod")
+	}
+	tgt.Tag = ""
+	tgt.Digest = manifest.GetDigest(mSrc).String()
+	if _, err := rc.ManifestHead(ctx, tgt); err == nil {
+		t.Errorf("unmodified image was not deleted after a failed mod")
+	}
+}
+
+func TestModPlatformsIndex(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  sync:
+  - source: ocidir://testrepo:v3
+    target: ocidir://test-mod-pi:v3
+    type: image
+    platforms:
+    - linux/amd64
+    platformsIndex: true
+    mod:
+    - annotation: "org.example.mod=one"
+  - source: ocidir://testrepo:v3
+    target: ocidir://test-mod-partial:v3
+    type: image
+    platforms:
+    - linux/amd64
+    platformsIndex: true
+    mod:
+    - annotation: "org.example.mod=one"
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	src, _ := ref.New("ocidir://testrepo:v3")
+	mIdx, err := rc.ManifestGet(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	mStage, err := regclient.ImagePlatformsIndex(mIdx, []string{"linux/amd64"})
+	if err != nil {
+		t.Fatalf("failed to rewrite index: %v", err)
+	}
+	mSrc, err := rc.ManifestHead(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	srcDigest := manifest.GetDigest(mSrc).String()
+	check := func(t *testing.T, s ConfigSync, expect string) {
+		t.Helper()
+		tgt, _ := ref.New(s.Target)
+		mTgt, err := rc.ManifestGet(ctx, tgt)
+		if err != nil {
+			t.Fatalf("failed to get target: %v", err)
+		}
+		annot, err := mTgt.(manifest.Annotator).GetAnnotations()
+		if err != nil {
+			t.Fatalf("failed to get annotations: %v", err)
+		}
+		if annot["org.example.mod"] != expect {
+			t.Errorf("unexpected annotation, expected %s, received %s", expect, annot["org.example.mod"])
+		}
+		dl, err := mTgt.(manifest.Indexer).GetManifestList()
+		if err != nil || len(dl) != 1 {
+			t.Errorf("unexpected platforms in target: %v", dl)
+		}
+		match, err := s.modMatch(ctx, tgt, srcDigest)
+		if err != nil || !match {
+			t.Errorf("modified target does not match source: %v", err)
+		}
+	}
+
+	t.Run("Staged", func(t *testing.T) {
+		s := conf.Sync[0]
+		err := s.process(ctx, "once")
+		if err != nil {
+			t.Fatalf("failed to sync: %v", err)
+		}
+		check(t, s, "one")
+		// the unmodified index is removed after the mod
+		rStage, _ := ref.New("ocidir://test-mod-pi")
+		rStage.Digest = manifest.GetDigest(mStage).String()
+		if _, err := rc.ManifestHead(ctx, rStage); err == nil {
+			t.Errorf("unmodified index found in target: %s", rStage.CommonName())
+		}
+	})
+	t.Run("Partial", func(t *testing.T) {
+		// an earlier failure left the unmodified index with the source digest annotation at the tag
+		s := conf.Sync[1]
+		tgt, _ := ref.New(s.Target)
+		err := rc.ImageCopy(ctx, src, tgt, regclient.ImageWithPlatforms(s.Platforms), regclient.ImageWithPlatformsIndex())
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		err = s.process(ctx, "once")
+		if err != nil {
+			t.Fatalf("failed to sync: %v", err)
+		}
+		check(t, s, "one")
+	})
+	t.Run("Changed", func(t *testing.T) {
+		s := conf.Sync[1]
+		s.Mod = []ConfigMod{{Annotation: "org.example.mod=two"}}
+		err := s.process(ctx, "once")
+		if err != nil {
+			t.Fatalf("failed to sync: %v", err)
+		}
+		check(t, s, "two")
+	})
+}
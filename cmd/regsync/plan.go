@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// planCreate is a tag missing from the target
+	planCreate = "create"
+	// planUpdate is a tag on the target with a different digest
+	planUpdate = "update"
+	// planBackup is a target image saved before being overwritten
+	planBackup = "backup"
+	// planPrune is a tag deleted from the target
+	planPrune = "prune"
+	// planReferrers is an unchanged image with referrers missing from the target
+	planReferrers = "referrers"
+)
+
+// checkPlan collects the changes each sync step would make, output by the check command
+type checkPlan struct {
+	mu    sync.Mutex
+	order []string
+	syncs map[string]*planSync
+}
+
+// planOutput is the plan output
+type planOutput struct {
+	Summary planSummary `json:"summary"`
+	Syncs   []*planSync `json:"syncs"`
+}
+
+// planSummary counts the changes by action
+type planSummary struct {
+	Create    int   `json:"create"`
+	Update    int   `json:"update"`
+	Backup    int   `json:"backup"`
+	Prune     int   `json:"prune"`
+	Referrers int   `json:"referrers"`
+	Bytes     int64 `json:"bytes"`
+	Errors    int   `json:"errors"`
+}
+
+// planSync are the changes for a sync step
+type planSync struct {
+	Source  string       `json:"source"`
+	Target  string       `json:"target"`
+	Type    string       `json:"type"`
+	Changes []planChange `json:"changes"`
+	Bytes   int64        `json:"bytes"`
+	Error   string       `json:"error,omitempty"`
+	blobs   map[digest.Digest]bool
+}
+
+// planChange is a single change to the target
+type planChange struct {
+	Action    string `json:"action"`
+	Target    string `json:"target"`
+	Source    string `json:"source,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	OldDigest string `json:"oldDigest,omitempty"`
+	NewDigest string `json:"newDigest,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+}
+
+func planNew() *checkPlan {
+	return &checkPlan{
+		order: []string{},
+		syncs: map[string]*planSync{},
+	}
+}
+
+// entry returns the plan for a sync step, the lock must be held
+func (p *checkPlan) entry(s ConfigSync) *planSync {
+	key := syncKey(s)
+	ps, ok := p.syncs[key]
+	if !ok {
+		ps = &planSync{
+			Source:  s.Source,
+			Target:  s.Target,
+			Type:    s.Type,
+			Changes: []planChange{},
+			blobs:   map[digest.Digest]bool{},
+		}
+		p.syncs[key] = ps
+		p.order = append(p.order, key)
+	}
+	return ps
+}
+
+// startSync adds a sync step to the plan
+func (p *checkPlan) startSync(s ConfigSync) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entry(s)
+}
+
+// add appends a change to the plan
+func (p *checkPlan) add(s ConfigSync, pc planChange) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps := p.entry(s)
+	ps.Changes = append(ps.Changes, pc)
+}
+
+// addBlobs returns the size of blobs not already counted for the sync step or found on the target
+func (p *checkPlan) addBlobs(s ConfigSync, descs []types.Descriptor, tgtDescs []types.Descriptor) int64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps := p.entry(s)
+	tgtBlobs := map[digest.Digest]bool{}
+	for _, d := range tgtDescs {
+		tgtBlobs[d.Digest] = true
+	}
+	var size int64
+	for _, d := range descs {
+		if ps.blobs[d.Digest] || tgtBlobs[d.Digest] {
+			continue
+		}
+		ps.blobs[d.Digest] = true
+		size += d.Size
+	}
+	ps.Bytes += size
+	return size
+}
+
+// endSync records an error from the sync step
+func (p *checkPlan) endSync(s ConfigSync, err error) {
+	if p == nil || err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entry(s).Error = err.Error()
+}
+
+// output returns the plan with a summary
+func (p *checkPlan) output() planOutput {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := planOutput{Syncs: []*planSync{}}
+	for _, key := range p.order {
+		ps := p.syncs[key]
+		out.Syncs = append(out.Syncs, ps)
+		out.Summary.Bytes += ps.Bytes
+		if ps.Error != "" {
+			out.Summary.Errors++
+		}
+		for _, pc := range ps.Changes {
+			switch pc.Action {
+			case planCreate:
+				out.Summary.Create++
+			case planUpdate:
+				out.Summary.Update++
+			case planBackup:
+				out.Summary.Backup++
+			case planPrune:
+				out.Summary.Prune++
+			case planReferrers:
+				out.Summary.Referrers++
+			}
+		}
+	}
+	return out
+}
+
+// MarshalPretty outputs a human readable plan
+func (po planOutput) MarshalPretty() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 1, ' ', 0)
+	for _, ps := range po.Syncs {
+		fmt.Fprintf(tw, "Sync %s -> %s (%s):\n", ps.Source, ps.Target, ps.Type)
+		if len(ps.Changes) == 0 && ps.Error == "" {
+			fmt.Fprintf(tw, "  no changes\n")
+		}
+		for _, pc := range ps.Changes {
+			switch pc.Action {
+			case planCreate:
+				fmt.Fprintf(tw, "  + %s\t%s\t%s\t%s\n", pc.Action, pc.Target, pc.NewDigest, units.HumanSize(float64(pc.Bytes)))
+			case planUpdate:
+				fmt.Fprintf(tw, "  ~ %s\t%s\t%s -> %s\t%s\n", pc.Action, pc.Target, pc.OldDigest, pc.NewDigest, units.HumanSize(float64(pc.Bytes)))
+			case planBackup:
+				fmt.Fprintf(tw, "  > %s\t%s\t-> %s\n", pc.Action, pc.Target, pc.Backup)
+			case planPrune:
+				fmt.Fprintf(tw, "  - %s\t%s\n", pc.Action, pc.Target)
+			case planReferrers:
+				fmt.Fprintf(tw, "  + %s\t%s\t%s\t%s\n", pc.Action, pc.Target, pc.NewDigest, units.HumanSize(float64(pc.Bytes)))
+			}
+		}
+		if ps.Error != "" {
+			fmt.Fprintf(tw, "  error: %s\n", ps.Error)
+		}
+		fmt.Fprintf(tw, "  estimated transfer: %s\n", units.HumanSize(float64(ps.Bytes)))
+		fmt.Fprintf(tw, "\n")
+	}
+	fmt.Fprintf(tw, "Plan: %d to create, %d to update, %d to backup, %d to prune, %d with new referrers, %d errors, estimated transfer %s\n",
+		po.Summary.Create, po.Summary.Update, po.Summary.Backup, po.Summary.Prune, po.Summary.Referrers, po.Summary.Errors,
+		units.HumanSize(float64(po.Summary.Bytes)))
+	err := tw.Flush()
+	return buf.Bytes(), err
+}
+
+// planBlobs returns the config and layer descriptors for an image, limiting a manifest list to the platforms when set
+func planBlobs(ctx context.Context, r ref.Ref, platforms []string) ([]types.Descriptor, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	descs := []types.Descriptor{}
+	if mi, ok := m.(manifest.Indexer); ok && m.IsList() {
+		dl, err := mi.GetManifestList()
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dl {
+			if len(platforms) > 0 && d.Platform != nil {
+				found, err := regclient.ImagePlatformInList(d.Platform, platforms)
+				if err != nil {
+					return nil, err
+				}
+				if !found {
+					continue
+				}
+			}
+			rChild := r
+			rChild.Tag = ""
+			rChild.Digest = d.Digest.String()
+			childDescs, err := planBlobs(ctx, rChild, nil)
+			if err != nil {
+				return nil, err
+			}
+			descs = append(descs, childDescs...)
+		}
+		return descs, nil
+	}
+	if mi, ok := m.(manifest.Imager); ok {
+		if d, err := mi.GetConfig(); err == nil {
+			descs = append(descs, d)
+		}
+		layers, err := mi.GetLayers()
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, layers...)
+	}
+	return descs, nil
+}
+
+// planRef adds the changes for an image to the plan
+func (s ConfigSync) planRef(ctx context.Context, src, tgt ref.Ref, ri reportImage, tgtExists, tgtMatches bool, referMissing []types.Descriptor) {
+	if plan == nil {
+		return
+	}
+	var tgtDescs []types.Descriptor
+	if tgtExists {
+		var err error
+		tgtDescs, err = planBlobs(ctx, tgt, nil)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"target": tgt.CommonName(),
+				"error":  err,
+			}).Debug("Failed to list target blobs")
+		}
+	}
+	if len(referMissing) > 0 {
+		for _, d := range referMissing {
+			rSrc := src
+			rSrc.Tag = ""
+			rSrc.Digest = d.Digest.String()
+			descs, err := planBlobs(ctx, rSrc, nil)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"source": rSrc.CommonName(),
+					"error":  err,
+				}).Warn("Failed to estimate referrer size")
+			}
+			plan.add(s, planChange{
+				Action:    planReferrers,
+				Source:    rSrc.CommonName(),
+				Target:    tgt.CommonName(),
+				NewDigest: d.Digest.String(),
+				Bytes:     d.Size + plan.addBlobs(s, descs, nil),
+			})
+		}
+		return
+	}
+	if tgtExists && !tgtMatches && s.Backup != "" {
+		backupRef, err := s.backupRef(tgt)
+		if err == nil {
+			plan.add(s, planChange{
+				Action:    planBackup,
+				Target:    tgt.CommonName(),
+				Backup:    backupRef.CommonName(),
+				OldDigest: ri.TargetDigest,
+			})
+		}
+	}
+	platforms := s.Platforms
+	if src.Digest != "" {
+		platforms = nil
+	}
+	descs, err := planBlobs(ctx, src, platforms)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"error":  err,
+		}).Warn("Failed to estimate image size")
+	}
+	pc := planChange{
+		Action:    planCreate,
+		Source:    src.CommonName(),
+		Target:    tgt.CommonName(),
+		NewDigest: ri.SourceDigest,
+		Bytes:     plan.addBlobs(s, descs, tgtDescs),
+	}
+	if tgtExists {
+		pc.Action = planUpdate
+		pc.OldDigest = ri.TargetDigest
+	}
+	plan.add(s, pc)
+}
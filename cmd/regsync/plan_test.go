@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  sync:
+  - source: ocidir://testrepo
+    target: ocidir://test-plan
+    type: repository
+    tags:
+      allow:
+      - v1
+      - v2
+    backup: "bkup-{{ .Ref.Tag }}"
+    prune:
+      mode: tags
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	// setup a target with an outdated v2 and an extra tag
+	for src, tgt := range map[string]string{
+		"ocidir://testrepo:v1": "ocidir://test-plan:v2",
+		"ocidir://testrepo:v3": "ocidir://test-plan:old",
+	} {
+		rSrc, _ := ref.New(src)
+		rTgt, _ := ref.New(tgt)
+		err = rc.ImageCopy(ctx, rSrc, rTgt)
+		if err != nil {
+			t.Fatalf("failed to copy %s: %v", src, err)
+		}
+	}
+	defer func() { plan = nil }()
+	plan = planNew()
+	err = conf.Sync[0].process(ctx, "check")
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	out := plan.output()
+	expect := planSummary{Create: 1, Update: 1, Backup: 1, Prune: 1, Bytes: out.Summary.Bytes}
+	if out.Summary != expect {
+		t.Errorf("unexpected summary, expected %v, received %v", expect, out.Summary)
+	}
+	if out.Summary.Bytes <= 0 {
+		t.Errorf("bytes to transfer not estimated")
+	}
+	if len(out.Syncs) != 1 {
+		t.Fatalf("unexpected syncs: %v", out.Syncs)
+	}
+	for _, pc := range out.Syncs[0].Changes {
+		switch pc.Action {
+		case planUpdate:
+			if pc.Target != "ocidir://test-plan:v2" || pc.OldDigest == "" || pc.NewDigest == "" || pc.OldDigest == pc.NewDigest {
+				t.Errorf("unexpected update: %v", pc)
+			}
+		case planBackup:
+			if pc.Backup != "ocidir://test-plan:bkup-v2" {
+				t.Errorf("unexpected backup: %v", pc)
+			}
+		case planPrune:
+			if pc.Target != "ocidir://test-plan:old" {
+				t.Errorf("unexpected prune: %v", pc)
+			}
+		}
+	}
+	pretty, err := out.MarshalPretty()
+	if err != nil {
+		t.Fatalf("failed to format plan: %v", err)
+	}
+	if !strings.Contains(string(pretty), "Plan: 1 to create, 1 to update, 1 to backup, 1 to prune") {
+		t.Errorf("unexpected plan output: %s", pretty)
+	}
+	b, err := json.Marshal(out)
+	if err != nil || !strings.Contains(string(b), `"oldDigest"`) {
+		t.Errorf("unexpected json output: %s, %v", b, err)
+	}
+	// check does not modify the target
+	r, _ := ref.New("ocidir://test-plan:v1")
+	if _, err := rc.ManifestHead(ctx, r); err == nil {
+		t.Errorf("check created the target")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+)
+
+// syncProgressFreq is the minimum interval between progress logs for an active transfer
+const syncProgressFreq = time.Second * 15
+
+// syncProgress logs the progress of an image copy
+type syncProgress struct {
+	sync     ConfigSync
+	src, tgt string
+	mu       sync.Mutex
+	start    map[string]time.Time
+	last     map[string]time.Time
+}
+
+func newSyncProgress(s ConfigSync, src, tgt string) *syncProgress {
+	return &syncProgress{
+		sync:  s,
+		src:   src,
+		tgt:   tgt,
+		start: map[string]time.Time{},
+		last:  map[string]time.Time{},
+	}
+}
+
+// callback is passed to regclient.ImageWithCallback
+func (sp *syncProgress) callback(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64) {
+	sp.mu.Lock()
+	now := time.Now()
+	fields := logrus.Fields{
+		"source": sp.src,
+		"target": sp.tgt,
+		"kind":   kind.String(),
+		"digest": instance,
+		"state":  state.String(),
+		"size":   total,
+	}
+	switch state {
+	case types.CallbackStarted:
+		sp.start[instance] = now
+		sp.last[instance] = now
+	case types.CallbackActive:
+		if now.Sub(sp.last[instance]) < syncProgressFreq {
+			sp.mu.Unlock()
+			return
+		}
+		sp.last[instance] = now
+		fields["bytes"] = cur
+	case types.CallbackFinished, types.CallbackFailed:
+		if start, ok := sp.start[instance]; ok {
+			elapsed := now.Sub(start)
+			fields["duration"] = elapsed.Round(time.Millisecond).String()
+			if sec := elapsed.Seconds(); state == types.CallbackFinished && kind == types.CallbackBlob && sec > 0 {
+				fields["bytes-per-sec"] = int64(float64(total) / sec)
+			}
+		}
+		delete(sp.start, instance)
+		delete(sp.last, instance)
+		if state == types.CallbackFinished && kind == types.CallbackBlob {
+			metrics.addBytes(sp.sync, total)
+		}
+	}
+	sp.mu.Unlock()
+
+	entry := log.WithFields(fields)
+	switch state {
+	case types.CallbackFailed:
+		entry.Warn("Transfer failed")
+	case types.CallbackSkipped, types.CallbackMounted:
+		entry.Debug("Transfer skipped")
+	case types.CallbackStarted:
+		entry.Info("Transfer started")
+	case types.CallbackActive:
+		entry.Info("Transfer progress")
+	case types.CallbackFinished:
+		entry.Info("Transfer finished")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// pruneModeOff leaves tags on the target that are missing from the source
+	pruneModeOff = "off"
+	// pruneModeTags deletes tags on the target that are missing from the source
+	pruneModeTags = "tags"
+	// pruneModeTagsManifests deletes tags, and deletes the manifest when no remaining tag points to it
+	pruneModeTagsManifests = "tagsAndManifests"
+	// pruneMaxDefault is the number of deletions allowed in each sync step when max is not set
+	pruneMaxDefault = 25
+	// pruneBackupTag is expanded in the backup template to find the backup tags in the target repository
+	pruneBackupTag = "REGSYNCBACKUPTAG"
+)
+
+// digestTagRE matches tags created for digest tags (signatures, attestations, etc), these are never pruned
+var digestTagRE = regexp.MustCompile(`^[a-z0-9]+-[a-f0-9]{32,}(\..*)?$`)
+
+// pruneState tracks deletions across all repositories in a sync step
+type pruneState struct {
+	deleted int
+}
+
+// enabled returns true when a prune mode is configured
+func (p *ConfigPrune) enabled() bool {
+	return p != nil && p.Mode != "" && p.Mode != pruneModeOff
+}
+
+// pruneRepo deletes tags from the target repository that are not in the keep list
+func (s ConfigSync) pruneRepo(ctx context.Context, tRepoRef ref.Ref, keep []string, action string, ps *pruneState) error {
+	if !s.Prune.enabled() {
+		return nil
+	}
+	if len(keep) == 0 && !s.Prune.AllowEmpty {
+		// an empty list is more likely an error on the source or in the filters than a removal of every tag
+		log.WithFields(logrus.Fields{
+			"source": s.Source,
+			"target": tRepoRef.CommonName(),
+		}).Warn("No source tags found, skipping prune")
+		return nil
+	}
+	return s.pruneTags(ctx, tRepoRef, keep, action, ps)
+}
+
+// pruneTags deletes every tag from the target repository that is not in the keep list
+func (s ConfigSync) pruneTags(ctx context.Context, tRepoRef ref.Ref, keep []string, action string, ps *pruneState) error {
+	if s.Prune.Mode != pruneModeTags && s.Prune.Mode != pruneModeTagsManifests {
+		log.WithFields(logrus.Fields{
+			"target": tRepoRef.CommonName(),
+			"mode":   s.Prune.Mode,
+		}).Error("Prune mode not recognized, must be one of: off, tags, or tagsAndManifests")
+		return ErrInvalidInput
+	}
+	tTags, err := rc.TagList(ctx, tRepoRef)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"target": tRepoRef.CommonName(),
+			"error":  err,
+		}).Error("Failed getting target tags")
+		return err
+	}
+	tTagList, err := tTags.GetTags()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"target": tRepoRef.CommonName(),
+			"error":  err,
+		}).Error("Failed getting target tags")
+		return err
+	}
+	keepMap := map[string]bool{}
+	for _, tag := range keep {
+		keepMap[tag] = true
+	}
+	backupRE, err := s.pruneBackupRE(tRepoRef)
+	if err != nil {
+		return err
+	}
+	pruneList := []string{}
+	keepList := []string{}
+	for _, tag := range tTagList {
+		if keepMap[tag] || digestTagRE.MatchString(tag) || (backupRE != nil && backupRE.MatchString(tag)) {
+			keepList = append(keepList, tag)
+		} else {
+			pruneList = append(pruneList, tag)
+		}
+	}
+	if len(pruneList) == 0 {
+		return nil
+	}
+	max := s.Prune.Max
+	if max == 0 {
+		max = pruneMaxDefault
+	}
+	if max > 0 && ps.deleted+len(pruneList) > max {
+		log.WithFields(logrus.Fields{
+			"target":  tRepoRef.CommonName(),
+			"tags":    pruneList,
+			"deleted": ps.deleted,
+			"max":     max,
+		}).Error("Prune exceeds the maximum deletions, skipping")
+		return fmt.Errorf("prune of %d tags from %s exceeds max %d: %w", len(pruneList), tRepoRef.CommonName(), max, ErrPruneLimit)
+	}
+	ps.deleted += len(pruneList)
+	if action == "check" {
+		for _, tag := range pruneList {
+			r := tRepoRef
+			r.Tag = tag
+			log.WithFields(logrus.Fields{
+				"target": tRepoRef.CommonName(),
+				"tag":    tag,
+				"mode":   s.Prune.Mode,
+			}).Info("Prune needed")
+			plan.add(s, planChange{Action: planPrune, Target: r.CommonName()})
+		}
+		return nil
+	}
+
+	// manifests are only deleted when no kept tag points to the same digest
+	keepDigests := map[string]bool{}
+	pruneDigests := map[string]string{}
+	if s.Prune.Mode == pruneModeTagsManifests {
+		lookup := func(tag string) (string, error) {
+			r := tRepoRef
+			r.Tag = tag
+			m, err := rc.ManifestHead(ctx, r)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"target": r.CommonName(),
+					"error":  err,
+				}).Error("Failed to lookup target manifest")
+				return "", err
+			}
+			return manifest.GetDigest(m).String(), nil
+		}
+		for _, tag := range keepList {
+			dig, err := lookup(tag)
+			if err != nil {
+				return err
+			}
+			keepDigests[dig] = true
+		}
+		for _, tag := range pruneList {
+			dig, err := lookup(tag)
+			if err != nil {
+				return err
+			}
+			pruneDigests[tag] = dig
+		}
+	}
+	var retErr error
+	deletedDigests := map[string]bool{}
+	for _, tag := range pruneList {
+		r := tRepoRef
+		r.Tag = tag
+		dig, ok := pruneDigests[tag]
+		if ok && deletedDigests[dig] {
+			// tag was removed with an earlier manifest delete
+			continue
+		}
+		if ok && !keepDigests[dig] {
+			r.Tag = ""
+			r.Digest = dig
+			err = rc.ManifestDelete(ctx, r)
+			deletedDigests[dig] = true
+		} else {
+			err = rc.TagDelete(ctx, r)
+		}
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"target": r.CommonName(),
+				"error":  err,
+			}).Error("Failed to prune")
+			retErr = err
+			continue
+		}
+		log.WithFields(logrus.Fields{
+			"target": r.CommonName(),
+			"tag":    tag,
+			"mode":   s.Prune.Mode,
+		}).Info("Pruned")
+	}
+	return retErr
+}
+
+// pruneBackupRE returns a regexp matching the tags created by the backup template in the target repository
+func (s ConfigSync) pruneBackupRE(tRepoRef ref.Ref) (*regexp.Regexp, error) {
+	if s.Backup == "" {
+		return nil, nil
+	}
+	r := tRepoRef
+	r.Tag = pruneBackupTag
+	backupRef, err := s.backupRef(r)
+	if err != nil {
+		return nil, err
+	}
+	if !ref.EqualRepository(backupRef, tRepoRef) {
+		return nil, nil
+	}
+	parts := strings.Split(backupRef.Tag, pruneBackupTag)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".+") + "$")
+}
+
+// pruneRepos deletes all tags from target repositories that were previously synced by this step and removed from the source
+func (s ConfigSync) pruneRepos(ctx context.Context, sRepoList []string, action string, ps *pruneState) error {
+	if state == nil {
+		if s.Prune.enabled() && s.Prune.Repos {
+			log.WithFields(logrus.Fields{
+				"target": s.Target,
+			}).Warn("Pruning repositories requires a state file, skipping")
+		}
+		return nil
+	}
+	prevList := state.syncRepos(s)
+	if len(sRepoList) == 0 && len(prevList) > 0 {
+		// an empty list is more likely an error on the source than a removal of every repository
+		log.WithFields(logrus.Fields{
+			"source": s.Source,
+		}).Warn("No source repositories found, skipping repository prune")
+		return nil
+	}
+	repoMap := map[string]bool{}
+	for _, repo := range sRepoList {
+		repoMap[repo] = true
+	}
+	var retErr error
+	for _, repo := range prevList {
+		if repoMap[repo] {
+			continue
+		}
+		if !s.Prune.enabled() || !s.Prune.Repos {
+			continue
+		}
+		tRepoRef, err := ref.New(fmt.Sprintf("%s/%s", s.Target, repo))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"target": s.Target,
+				"repo":   repo,
+				"error":  err,
+			}).Error("Failed parsing target")
+			return err
+		}
+		// repository pruning is an explicit opt-in to delete every tag
+		err = s.pruneTags(ctx, tRepoRef, []string{}, action, ps)
+		if err != nil || action == "check" {
+			// retry on the next run
+			repoMap[repo] = true
+		}
+		if err != nil {
+			retErr = err
+		}
+	}
+	if action != "check" {
+		repos := make([]string, 0, len(repoMap))
+		for repo := range repoMap {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		state.setSyncRepos(s, repos)
+	}
+	return retErr
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	confRdr := bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  `))
+	conf, err = ConfigLoadReader(confRdr)
+	if err != nil {
+		t.Errorf("failed parsing config: %v", err)
+		return
+	}
+
+	// steps run in order against the same target
+	tests := []struct {
+		name    string
+		deny    []string
+		backup  string
+		replace string // tag on the target replaced with a different image before the sync
+		prune   *ConfigPrune
+		action  string
+		exists  []string
+		missing []string
+		expErr  error
+	}{
+		{
+			name:   "copy",
+			action: "once",
+			exists: []string{"v1", "v2", "v3"},
+		},
+		{
+			name:   "disabled",
+			deny:   []string{"v2"},
+			prune:  &ConfigPrune{Mode: pruneModeOff},
+			action: "once",
+			exists: []string{"v1", "v2", "v3"},
+		},
+		{
+			name:   "check",
+			deny:   []string{"v2"},
+			prune:  &ConfigPrune{Mode: pruneModeTags},
+			action: "check",
+			exists: []string{"v1", "v2", "v3"},
+		},
+		{
+			name:   "limit",
+			deny:   []string{"v2", "v3"},
+			prune:  &ConfigPrune{Mode: pruneModeTags, Max: 1},
+			action: "once",
+			exists: []string{"v1", "v2", "v3"},
+			expErr: ErrPruneLimit,
+		},
+		{
+			name:   "invalid mode",
+			deny:   []string{"v2"},
+			prune:  &ConfigPrune{Mode: "all"},
+			action: "once",
+			exists: []string{"v1", "v2", "v3"},
+			expErr: ErrInvalidInput,
+		},
+		{
+			name:    "tags",
+			deny:    []string{"v2"},
+			prune:   &ConfigPrune{Mode: pruneModeTags},
+			action:  "once",
+			exists:  []string{"v1", "v3"},
+			missing: []string{"v2"},
+		},
+		{
+			name:    "backup",
+			backup:  "bkup-{{.Ref.Tag}}",
+			replace: "v1",
+			action:  "once",
+			exists:  []string{"v1", "v3", "bkup-v1"},
+		},
+		{
+			name:    "backup prune",
+			deny:    []string{"v2"},
+			backup:  "bkup-{{.Ref.Tag}}",
+			prune:   &ConfigPrune{Mode: pruneModeTags},
+			action:  "once",
+			exists:  []string{"v1", "v3", "bkup-v1"},
+			missing: []string{"v2"},
+		},
+		{
+			name:   "empty",
+			deny:   []string{".*"},
+			prune:  &ConfigPrune{Mode: pruneModeTags, Max: -1},
+			action: "once",
+			exists: []string{"v1", "v3", "bkup-v1"},
+		},
+		{
+			name:    "tags and manifests",
+			deny:    []string{"v2", "v3"},
+			prune:   &ConfigPrune{Mode: pruneModeTagsManifests, Max: -1},
+			action:  "once",
+			exists:  []string{"v1"},
+			missing: []string{"v2", "v3"},
+		},
+		{
+			name:    "empty allowed",
+			deny:    []string{".*"},
+			prune:   &ConfigPrune{Mode: pruneModeTags, Max: -1, AllowEmpty: true},
+			action:  "once",
+			missing: []string{"v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ConfigSync{
+				Source: "ocidir://testrepo",
+				Target: "ocidir://test-prune",
+				Type:   "repository",
+				Tags:   ConfigTags{Deny: tt.deny},
+				Backup: tt.backup,
+				Prune:  tt.prune,
+			}
+			syncSetDefaults(&s, conf.Defaults)
+			if tt.replace != "" {
+				rSrc, _ := ref.New("ocidir://testrepo:v2")
+				rTgt, _ := ref.New("ocidir://test-prune:" + tt.replace)
+				err := rc.ImageCopy(ctx, rSrc, rTgt)
+				if err != nil {
+					t.Fatalf("failed to replace %s: %v", tt.replace, err)
+				}
+			}
+			err := s.process(ctx, tt.action)
+			if tt.expErr != nil {
+				if err == nil {
+					t.Errorf("process did not fail")
+				} else if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error on process: %v, expected %v", err, tt.expErr)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error on process: %v", err)
+				return
+			}
+			for _, tag := range tt.exists {
+				r, _ := ref.New("ocidir://test-prune:" + tag)
+				if _, err := rc.ManifestHead(ctx, r); err != nil {
+					t.Errorf("tag was pruned: %s", tag)
+				}
+			}
+			for _, tag := range tt.missing {
+				r, _ := ref.New("ocidir://test-prune:" + tag)
+				if _, err := rc.ManifestHead(ctx, r); err == nil {
+					t.Errorf("tag was not pruned: %s", tag)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneRepos(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	state, err = stateLoad(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	defer func() { state = nil }()
+	rSrc, _ := ref.New("ocidir://testrepo:v1")
+	for _, repo := range []string{"app1", "app2", "other"} {
+		rTgt, _ := ref.New("ocidir://test-prune-repos/" + repo + ":v1")
+		err = rc.ImageCopy(ctx, rSrc, rTgt)
+		if err != nil {
+			t.Fatalf("failed to copy %s: %v", repo, err)
+		}
+	}
+	s := ConfigSync{
+		Source: "ocidir://source",
+		Target: "ocidir://test-prune-repos",
+		Type:   "registry",
+		Prune:  &ConfigPrune{Mode: pruneModeTags, Repos: true},
+	}
+	syncSetDefaults(&s, conf.Defaults)
+
+	// steps run in order against the same target
+	tests := []struct {
+		name    string
+		repos   []string
+		action  string
+		exists  []string
+		missing []string
+		expect  []string
+	}{
+		{
+			name:   "record",
+			repos:  []string{"app1", "app2"},
+			action: "once",
+			exists: []string{"app1", "app2", "other"},
+			expect: []string{"app1", "app2"},
+		},
+		{
+			name:   "empty source",
+			repos:  []string{},
+			action: "once",
+			exists: []string{"app1", "app2", "other"},
+			expect: []string{"app1", "app2"},
+		},
+		{
+			name:   "check",
+			repos:  []string{"app1"},
+			action: "check",
+			exists: []string{"app1", "app2", "other"},
+			expect: []string{"app1", "app2"},
+		},
+		{
+			name:    "prune",
+			repos:   []string{"app1"},
+			action:  "once",
+			exists:  []string{"app1", "other"},
+			missing: []string{"app2"},
+			expect:  []string{"app1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.pruneRepos(ctx, tt.repos, tt.action, &pruneState{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, repo := range tt.exists {
+				r, _ := ref.New("ocidir://test-prune-repos/" + repo + ":v1")
+				if _, err := rc.ManifestHead(ctx, r); err != nil {
+					t.Errorf("repo was pruned: %s", repo)
+				}
+			}
+			for _, repo := range tt.missing {
+				r, _ := ref.New("ocidir://test-prune-repos/" + repo + ":v1")
+				if _, err := rc.ManifestHead(ctx, r); err == nil {
+					t.Errorf("repo was not pruned: %s", repo)
+				}
+			}
+			repos := state.syncRepos(s)
+			if strings.Join(repos, ",") != strings.Join(tt.expect, ",") {
+				t.Errorf("unexpected repos in state: %v, expected %v", repos, tt.expect)
+			}
+		})
+	}
+}
+
+func TestPruneAgeError(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata/testrepo", fsMem, "test-age-src")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	// add a tag to the source that fails to resolve
+	index, err := rwfs.ReadFile(fsMem, "test-age-src/index.json")
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	missing := `{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:` + strings.Repeat("0", 64) + `","size":1024,"annotations":{"org.opencontainers.image.ref.name":"broken"}},`
+	index = bytes.Replace(index, []byte(`"manifests":[`), []byte(`"manifests":[`+missing), 1)
+	err = rwfs.WriteFile(fsMem, "test-age-src/index.json", index, 0644)
+	if err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	rSrc, _ := ref.New("ocidir://test-age-src:v1")
+	rTgt, _ := ref.New("ocidir://test-age-tgt:broken")
+	err = rc.ImageCopy(ctx, rSrc, rTgt)
+	if err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	s := ConfigSync{
+		Source: "ocidir://test-age-src",
+		Target: "ocidir://test-age-tgt",
+		Type:   "repository",
+		Tags:   ConfigTags{MinAge: time.Hour},
+		Prune:  &ConfigPrune{Mode: pruneModeTags, Max: -1},
+	}
+	syncSetDefaults(&s, conf.Defaults)
+	err = s.process(ctx, "once")
+	if err == nil {
+		t.Errorf("process did not fail on a tag that cannot be queried")
+	}
+	if _, err := rc.ManifestHead(ctx, rTgt); err != nil {
+		t.Errorf("tag was pruned after a failed age lookup: %v", err)
+	}
+}
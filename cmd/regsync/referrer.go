@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// referrerOpts returns the image copy options to include referrers matching the filters
+func (s ConfigSync) referrerOpts() []regclient.ImageOpts {
+	if s.Referrers == nil || !*s.Referrers {
+		return nil
+	}
+	if len(s.ReferrerFilters) == 0 {
+		return []regclient.ImageOpts{regclient.ImageWithReferrers()}
+	}
+	opts := []regclient.ImageOpts{}
+	for _, filter := range s.ReferrerFilters {
+		opts = append(opts, regclient.ImageWithReferrers(filter.rOpts()...))
+	}
+	return opts
+}
+
+// rOpts converts the filter to options for a referrer list
+func (f ConfigReferrerFilter) rOpts() []scheme.ReferrerOpts {
+	rOpts := []scheme.ReferrerOpts{}
+	if f.ArtifactType != "" {
+		rOpts = append(rOpts, scheme.WithReferrerAT(f.ArtifactType))
+	}
+	if len(f.Annotations) > 0 {
+		rOpts = append(rOpts, scheme.WithReferrerAnnotations(f.Annotations))
+	}
+	return rOpts
+}
+
+// referrersMissing returns the source referrers to the digest that are not found on the target
+func (s ConfigSync) referrersMissing(ctx context.Context, src, tgt ref.Ref, dig string) ([]types.Descriptor, error) {
+	if s.Referrers == nil || !*s.Referrers {
+		return nil, nil
+	}
+	src.Tag = ""
+	src.Digest = dig
+	tgt.Tag = ""
+	tgt.Digest = dig
+	filters := [][]scheme.ReferrerOpts{}
+	for _, filter := range s.ReferrerFilters {
+		filters = append(filters, filter.rOpts())
+	}
+	if len(filters) == 0 {
+		filters = append(filters, []scheme.ReferrerOpts{})
+	}
+	tgtDigests := map[digest.Digest]bool{}
+	rlTgt, err := rc.ReferrerList(ctx, tgt)
+	if err != nil {
+		// an error listing the target referrers results in copying all referrers
+		log.WithFields(logrus.Fields{
+			"target": tgt.CommonName(),
+			"error":  err,
+		}).Debug("Failed to list target referrers")
+	} else {
+		for _, d := range rlTgt.Descriptors {
+			tgtDigests[d.Digest] = true
+		}
+	}
+	missing := []types.Descriptor{}
+	for _, rOpts := range filters {
+		rlSrc, err := rc.ReferrerList(ctx, src, rOpts...)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"source": src.CommonName(),
+				"error":  err,
+			}).Error("Failed to list source referrers")
+			return nil, err
+		}
+		for _, d := range rlSrc.Descriptors {
+			if !tgtDigests[d.Digest] {
+				tgtDigests[d.Digest] = true
+				missing = append(missing, d)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// referrersCopy copies referrers to the digest without copying the image
+func (s ConfigSync) referrersCopy(ctx context.Context, src, tgt ref.Ref, descs []types.Descriptor, opts []regclient.ImageOpts) error {
+	for _, d := range descs {
+		referSrc := src
+		referSrc.Tag = ""
+		referSrc.Digest = d.Digest.String()
+		referTgt := tgt
+		referTgt.Tag = ""
+		referTgt.Digest = d.Digest.String()
+		log.WithFields(logrus.Fields{
+			"source":       referSrc.CommonName(),
+			"target":       referTgt.CommonName(),
+			"artifactType": d.ArtifactType,
+		}).Info("Copying referrer")
+		err := rc.ImageCopy(ctx, referSrc, referTgt, opts...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
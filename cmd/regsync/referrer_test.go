@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	boolTrue := true
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	sigType := "application/example.sig"
+	sbomType := "application/example.sbom"
+	src, _ := ref.New("ocidir://testrepo:v1")
+	tgt, _ := ref.New("ocidir://test-refer:v1")
+	mSrc, err := rc.ManifestHead(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	srcDesc := mSrc.GetDescriptor()
+	// pushArtifact adds an artifact to the source referring to v1
+	pushArtifact := func(artifactType string) {
+		am, err := manifest.New(manifest.WithOrig(v1.ArtifactManifest{
+			MediaType:    types.MediaTypeOCI1Artifact,
+			ArtifactType: artifactType,
+			Refers:       &srcDesc,
+		}))
+		if err != nil {
+			t.Fatalf("failed to create artifact: %v", err)
+		}
+		r := src
+		r.Tag = ""
+		r.Digest = am.GetDescriptor().Digest.String()
+		err = rc.ManifestPut(ctx, r, am)
+		if err != nil {
+			t.Fatalf("failed to push artifact: %v", err)
+		}
+	}
+	// countReferrers returns the number of referrers to v1 on the target
+	countReferrers := func() int {
+		r := tgt
+		r.Tag = ""
+		r.Digest = srcDesc.Digest.String()
+		rl, err := rc.ReferrerList(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to list referrers: %v", err)
+		}
+		return len(rl.Descriptors)
+	}
+	s := ConfigSync{
+		Source:          src.CommonName(),
+		Target:          tgt.CommonName(),
+		Type:            "image",
+		Referrers:       &boolTrue,
+		ReferrerFilters: []ConfigReferrerFilter{{ArtifactType: sigType}},
+	}
+	syncSetDefaults(&s, conf.Defaults)
+
+	pushArtifact(sigType)
+	err = s.process(ctx, "once")
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if c := countReferrers(); c != 1 {
+		t.Errorf("unexpected referrers after first sync, expected 1, received %d", c)
+	}
+	// a new signature on an unchanged image is copied, the filtered sbom is not
+	pushArtifact(sigType + ".v2")
+	pushArtifact(sbomType)
+	s.ReferrerFilters = append(s.ReferrerFilters, ConfigReferrerFilter{ArtifactType: sigType + ".v2"})
+	missing, err := s.referrersMissing(ctx, src, tgt, srcDesc.Digest.String())
+	if err != nil || len(missing) != 1 {
+		t.Errorf("unexpected missing referrers: %v, %v", missing, err)
+	}
+	err = s.process(ctx, "once")
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if c := countReferrers(); c != 2 {
+		t.Errorf("unexpected referrers after second sync, expected 2, received %d", c)
+	}
+	missing, err = s.referrersMissing(ctx, src, tgt, srcDesc.Digest.String())
+	if err != nil || len(missing) != 0 {
+		t.Errorf("referrers missing after sync: %v, %v", missing, err)
+	}
+}
+
+func TestReferrersConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        string
+		expErr      error
+		expDisabled bool
+	}{
+		{
+			name: "mod",
+			conf: `
+  version: 1
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-refer:v1
+    type: image
+    referrers: true
+    mod:
+    - toOCI: true
+  `,
+			expErr: ErrInvalidInput,
+		},
+		{
+			name: "platformsIndex",
+			conf: `
+  version: 1
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-refer:v1
+    type: image
+    referrers: true
+    platforms:
+    - linux/amd64
+    platformsIndex: true
+  `,
+			expErr: ErrInvalidInput,
+		},
+		{
+			name: "default skipped with platformsIndex",
+			conf: `
+  version: 1
+  defaults:
+    referrers: true
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-refer:v1
+    type: image
+    platforms:
+    - linux/amd64
+    platformsIndex: true
+  `,
+			expDisabled: true,
+		},
+		{
+			name: "default skipped with mod",
+			conf: `
+  version: 1
+  defaults:
+    referrers: true
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-refer:v1
+    type: image
+    mod:
+    - toOCI: true
+  `,
+			expDisabled: true,
+		},
+		{
+			name: "disabled on step",
+			conf: `
+  version: 1
+  defaults:
+    referrers: true
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocidir://test-refer:v1
+    type: image
+    referrers: false
+    mod:
+    - toOCI: true
+  `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ConfigLoadReader(bytes.NewReader([]byte(tt.conf)))
+			if tt.expErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if tt.expErr != nil {
+				if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error: %v, expected %v", err, tt.expErr)
+				}
+				return
+			}
+			if tt.expDisabled && (c.Sync[0].Referrers == nil || *c.Sync[0].Referrers) {
+				t.Errorf("referrers were not disabled on the sync")
+			}
+		})
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/internal/semver"
 	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
 	"golang.org/x/sync/semaphore"
 )
@@ -151,6 +154,87 @@ func TestRegsyncOnce(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name: "RepoTagFilterSemver",
+			sync: ConfigSync{
+				Source: "ocidir://testrepo",
+				Target: "ocidir://test-semver",
+				Type:   "repository",
+				Tags: ConfigTags{
+					SemverRange:  []string{">=2 <4"},
+					SemverLatest: 1,
+				},
+			},
+			exists: []string{"ocidir://test-semver:v3"},
+			desired: []string{
+				"test-semver/blobs/sha256/a4bdb3dbc74b4fce1d2064f346ddb767cd36e4f959e570c01970036912c2c0fb", // v3
+			},
+			undesired: []string{
+				"test-semver/blobs/sha256/94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694", // v1
+				"test-semver/blobs/sha256/3fadbd1aeb4e8c0fe8328c4007012b7a6fdbc7c578ad4880b3480706a3432be1", // v2
+			},
+			expErr: nil,
+		},
+		{
+			name: "RepoTagFilterMinAge",
+			sync: ConfigSync{
+				Source: "ocidir://testrepo",
+				Target: "ocidir://test-minage",
+				Type:   "repository",
+				Tags: ConfigTags{
+					Allow:  []string{"v1"},
+					MinAge: time.Hour,
+				},
+			},
+			exists: []string{"ocidir://test-minage:v1"},
+			expErr: nil,
+		},
+		{
+			name: "RepoTagFilterMaxAge",
+			sync: ConfigSync{
+				Source: "ocidir://testrepo",
+				Target: "ocidir://test-maxage",
+				Type:   "repository",
+				Tags: ConfigTags{
+					MaxAge: time.Hour,
+				},
+			},
+			undesired: []string{
+				"test-maxage/index.json",
+			},
+			expErr: nil,
+		},
+		{
+			name: "RepoTagFilterSemverInvalid",
+			sync: ConfigSync{
+				Source: "ocidir://testrepo",
+				Target: "ocidir://test-semver",
+				Type:   "repository",
+				Tags: ConfigTags{
+					SemverRange: []string{"1.x"},
+				},
+			},
+			expErr: semver.ErrInvalidConstraint,
+		},
+		{
+			name: "ImagePlatformsIndex",
+			sync: ConfigSync{
+				Source:         "ocidir://testrepo:v1",
+				Target:         "ocidir://test-plat:v1",
+				Type:           "image",
+				Platforms:      []string{"linux/amd64"},
+				PlatformsIndex: true,
+			},
+			exists: []string{"ocidir://test-plat:v1"},
+			desired: []string{
+				"test-plat/blobs/sha256/aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832", // amd64
+			},
+			undesired: []string{
+				"test-plat/blobs/sha256/94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694", // v1
+				"test-plat/blobs/sha256/2ea09753fab80a36c32fc7a959537a38a7bcbf09eddba48671c51c29b2c943ac", // arm64
+			},
+			expErr: nil,
+		},
 		{
 			name: "ImageDigestTags",
 			sync: ConfigSync{
@@ -492,3 +576,127 @@ func TestConfigRead(t *testing.T) {
 	}
 	// TODO: test remainder of templates and parsing
 }
+
+func TestPlatformsIndexMatch(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	src, _ := ref.New("ocidir://testrepo:v1")
+	tgt, _ := ref.New("ocidir://test-plat:v1")
+	err = rc.ImageCopy(ctx, src, tgt, regclient.ImageWithPlatforms([]string{"linux/amd64"}), regclient.ImageWithPlatformsIndex())
+	if err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	mSrc, err := rc.ManifestHead(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	tests := []struct {
+		platforms []string
+		expect    bool
+	}{
+		{platforms: []string{"linux/amd64"}, expect: true},
+		{platforms: []string{"linux/amd64", "linux/arm64"}, expect: false},
+		{platforms: []string{"linux/arm64"}, expect: false},
+	}
+	for _, tt := range tests {
+		match, err := platformsIndexMatch(ctx, src, tgt, tt.platforms, mSrc)
+		if err != nil {
+			t.Errorf("%v: failed to compare: %v", tt.platforms, err)
+		} else if match != tt.expect {
+			t.Errorf("%v: unexpected match, expected %t, received %t", tt.platforms, tt.expect, match)
+		}
+	}
+}
+
+func TestProcessClose(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  sync:
+  - source: ocidir://testrepo:v1
+    target: ocifile://missing/out.tar:v1
+    type: image
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	cs := conf.Sync[0]
+	src, err := ref.New(cs.Source)
+	if err != nil {
+		t.Fatalf("failed to create src ref: %v", err)
+	}
+	tgt, err := ref.New(cs.Target)
+	if err != nil {
+		t.Fatalf("failed to create tgt ref: %v", err)
+	}
+	// the tar file is written on close, which fails without the parent directory
+	err = cs.processRef(ctx, src, tgt, "copy")
+	if err == nil {
+		t.Errorf("process did not fail when the target could not be written")
+	}
+	if _, err := rwfs.Stat(fsMem, "missing/out.tar"); err == nil {
+		t.Errorf("target file exists")
+	}
+}
+
+func TestFilterTagsAgeCache(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	state, err = stateLoad("")
+	if err != nil {
+		t.Fatalf("failed to setup state: %v", err)
+	}
+	defer func() { state = nil }()
+	s := ConfigSync{
+		Source: "ocidir://testrepo",
+		Target: "ocidir://test-age-cache",
+		Type:   "repository",
+		Tags:   ConfigTags{MinAge: time.Hour},
+	}
+	r, _ := ref.New(s.Source)
+	tags, err := s.filterTagsAge(ctx, r, []string{"v1"})
+	if err != nil {
+		t.Fatalf("failed to filter tags: %v", err)
+	}
+	if len(tags) != 1 {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	rV1, _ := ref.New("ocidir://testrepo:v1")
+	m, err := rc.ManifestHead(ctx, rV1)
+	if err != nil {
+		t.Fatalf("failed to head v1: %v", err)
+	}
+	key := manifest.GetDigest(m).String()
+	if _, ok := state.created(key); !ok {
+		t.Fatalf("created time was not cached for %s", key)
+	}
+	// a cached time is used without pulling the image again
+	state.setCreated(key, time.Now())
+	tags, err = s.filterTagsAge(ctx, r, []string{"v1"})
+	if err != nil {
+		t.Fatalf("failed to filter tags: %v", err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("cached created time was not used: %v", tags)
+	}
+}
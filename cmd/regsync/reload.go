@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// configWatchInterval is how often the config files are checked for changes in server mode
+var configWatchInterval = 10 * time.Second
+
+// confMu protects conf.Sync when the config is reloaded
+var confMu sync.RWMutex
+
+// scheduler tracks the cron entries for each sync step so they can be updated on a reload
+type scheduler struct {
+	ctx     context.Context
+	cron    *cron.Cron
+	wg      *sync.WaitGroup
+	mu      sync.Mutex
+	entries map[string]cron.EntryID
+	err     error
+}
+
+func schedulerNew(ctx context.Context, c *cron.Cron, wg *sync.WaitGroup) *scheduler {
+	return &scheduler{
+		ctx:     ctx,
+		cron:    c,
+		wg:      wg,
+		entries: map[string]cron.EntryID{},
+	}
+}
+
+// schedKey identifies a sync step by its full configuration
+func schedKey(s ConfigSync) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return syncKey(s)
+	}
+	return string(b)
+}
+
+// setErr saves the first error seen
+func (sch *scheduler) setErr(err error) {
+	if err == nil {
+		return
+	}
+	sch.mu.Lock()
+	if sch.err == nil {
+		sch.err = err
+	}
+	sch.mu.Unlock()
+}
+
+// update schedules new sync steps and removes any that are no longer configured.
+// Running syncs are not interrupted, and new steps immediately copy missing images.
+func (sch *scheduler) update(syncs []ConfigSync, wait bool) {
+	sch.mu.Lock()
+	keep := map[string]bool{}
+	added := []ConfigSync{}
+	for _, s := range syncs {
+		key := schedKey(s)
+		if keep[key] {
+			continue
+		}
+		keep[key] = true
+		if _, ok := sch.entries[key]; ok {
+			continue
+		}
+		if id, ok := sch.add(s); ok {
+			sch.entries[key] = id
+			added = append(added, s)
+		}
+	}
+	for key, id := range sch.entries {
+		if !keep[key] {
+			sch.cron.Remove(id)
+			delete(sch.entries, key)
+			log.WithFields(logrus.Fields{
+				"id": id,
+			}).Debug("Removed scheduled task")
+		}
+	}
+	sch.mu.Unlock()
+	// immediately copy any images that are missing from target
+	for _, s := range added {
+		s := s
+		if wait && conf.Defaults.Parallel <= 0 {
+			sch.setErr(s.process(sch.ctx, "missing"))
+			continue
+		}
+		sch.wg.Add(1)
+		go func() {
+			defer sch.wg.Done()
+			sch.setErr(s.process(sch.ctx, "missing"))
+		}()
+	}
+}
+
+// add creates the cron entry for a sync step, the lock must be held
+func (sch *scheduler) add(s ConfigSync) (cron.EntryID, bool) {
+	sched := s.Schedule
+	if sched == "" && s.Interval != 0 {
+		sched = "@every " + s.Interval.String()
+	}
+	if sched == "" {
+		log.WithFields(logrus.Fields{
+			"source": s.Source,
+			"target": s.Target,
+			"type":   s.Type,
+		}).Error("No schedule or interval found, ignoring")
+		return 0, false
+	}
+	id, err := sch.cron.AddFunc(sched, func() {
+		log.WithFields(logrus.Fields{
+			"source": s.Source,
+			"target": s.Target,
+			"type":   s.Type,
+		}).Debug("Running task")
+		sch.wg.Add(1)
+		defer sch.wg.Done()
+		sch.setErr(s.process(sch.ctx, "copy"))
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": s.Source,
+			"target": s.Target,
+			"sched":  sched,
+			"error":  err,
+		}).Error("Failed to schedule task")
+		return 0, false
+	}
+	log.WithFields(logrus.Fields{
+		"source": s.Source,
+		"target": s.Target,
+		"type":   s.Type,
+		"sched":  sched,
+	}).Debug("Scheduled task")
+	return id, true
+}
+
+// configDigest returns a hash of the config file and all included files
+func configDigest(filename string) ([]byte, error) {
+	h := sha256.New()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(b)
+	c := Config{}
+	err = yaml.Unmarshal(b, &c)
+	if err != nil {
+		return nil, err
+	}
+	files, err := configIncludeFiles(c.Include, filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		io.WriteString(h, "\x00"+file+"\x00")
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(b)
+	}
+	return h.Sum(nil), nil
+}
+
+// configWatch reloads the config when the files change or a SIGHUP is received
+func configWatch(ctx context.Context, filename string, sch *scheduler) {
+	last, err := configDigest(filename)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"file":  filename,
+			"error": err,
+		}).Warn("Failed to read config for reload")
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		force := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			force = true
+		case <-ticker.C:
+		}
+		cur, err := configDigest(filename)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"file":  filename,
+				"error": err,
+			}).Warn("Failed to read config for reload")
+			continue
+		}
+		if !force && string(cur) == string(last) {
+			continue
+		}
+		last = cur
+		err = configReload(filename, sch)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"file":  filename,
+				"error": err,
+			}).Error("Failed to reload config, keeping the previous config")
+		}
+	}
+}
+
+// configReload loads the config and replaces the sync steps
+func configReload(filename string, sch *scheduler) error {
+	newConf, err := ConfigLoadFile(filename)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(newConf.Creds, conf.Creds) || !reflect.DeepEqual(newConf.Defaults, conf.Defaults) {
+		log.WithFields(logrus.Fields{
+			"file": filename,
+		}).Warn("Changes to creds and defaults outside of the sync steps require a restart")
+	}
+	if len(newConf.Sync) == 0 && len(conf.Sync) > 0 {
+		return fmt.Errorf("config has no sync steps: %w", ErrMissingInput)
+	}
+	confMu.Lock()
+	conf.Sync = newConf.Sync
+	confMu.Unlock()
+	sch.update(newConf.Sync, false)
+	log.WithFields(logrus.Fields{
+		"file":  filename,
+		"syncs": len(newConf.Sync),
+	}).Info("Config reloaded")
+	return nil
+}
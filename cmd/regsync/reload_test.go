@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestConfigInclude(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"regsync.yml": `
+version: 1
+include:
+- teams/*.yml
+- teams/b.yml
+defaults:
+  parallel: 1
+  interval: 60m
+sync:
+- source: ocidir://testrepo:v1
+  target: ocidir://test-inc:v1
+  type: image
+`,
+		"teams/a.yml": `
+sync:
+- source: ocidir://testrepo:v2
+  target: ocidir://test-inc-a:v2
+  type: image
+`,
+		"teams/b.yml": `
+sync:
+- source: ocidir://testrepo:v3
+  target: ocidir://test-inc-b:v3
+  type: image
+  interval: 5m
+`,
+		"bad/defaults.yml": `
+defaults:
+  parallel: 5
+`,
+		"creds/a.yml": `
+creds:
+- registry: registry-a:5000
+  tls: disabled
+`,
+	}
+	for name, content := range files {
+		filename := filepath.Join(tempDir, name)
+		err := os.MkdirAll(filepath.Dir(filename), 0755)
+		if err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		err = os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	t.Setenv(configEnvPrefix+"_PARALLEL", "3")
+	t.Setenv(configEnvPrefix+"_RATELIMIT_MIN", "50")
+	t.Setenv(configEnvPrefix+"_SCHEDULE", "@every 2h")
+	t.Setenv(configEnvPrefix+"_WEBHOOK_TOKEN", "secret")
+	c, err := ConfigLoadFile(filepath.Join(tempDir, "regsync.yml"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if len(c.Sync) != 3 || c.Sync[1].Target != "ocidir://test-inc-a:v2" || c.Sync[2].Target != "ocidir://test-inc-b:v3" {
+		t.Errorf("unexpected sync steps: %v", c.Sync)
+	}
+	if c.Defaults.Parallel != 3 || c.Defaults.RateLimit.Min != 50 || c.Defaults.Schedule != "@every 2h" {
+		t.Errorf("unexpected defaults: %v", c.Defaults)
+	}
+	if c.Defaults.Webhook == nil || c.Defaults.Webhook.Token != "secret" {
+		t.Errorf("webhook token not set from env")
+	}
+	if c.Sync[0].Schedule != "@every 2h" || c.Sync[2].Interval != 5*time.Minute {
+		t.Errorf("defaults not applied to sync steps: %v", c.Sync)
+	}
+
+	err = os.WriteFile(filepath.Join(tempDir, "regsync.yml"), []byte("version: 1\ninclude:\n- bad/*.yml\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	_, err = ConfigLoadFile(filepath.Join(tempDir, "regsync.yml"))
+	if err == nil {
+		t.Errorf("include with defaults did not fail")
+	}
+	err = os.WriteFile(filepath.Join(tempDir, "regsync.yml"), []byte("version: 1\ninclude:\n- creds/*.yml\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	_, err = ConfigLoadFile(filepath.Join(tempDir, "regsync.yml"))
+	if err == nil {
+		t.Errorf("include with creds did not fail")
+	}
+	t.Setenv(configEnvPrefix+"_PARALLEL", "many")
+	_, err = ConfigLoadFile(filepath.Join(tempDir, "teams", "a.yml"))
+	if err == nil {
+		t.Errorf("invalid env did not fail")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	tempDir := t.TempDir()
+	confFile := filepath.Join(tempDir, "regsync.yml")
+	incFile := filepath.Join(tempDir, "team.yml")
+	writeFile := func(filename, content string) {
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	writeFile(confFile, `
+version: 1
+include:
+- team.yml
+defaults:
+  parallel: 1
+  interval: 60m
+sync:
+- source: ocidir://testrepo:v1
+  target: ocidir://test-reload:v1
+  type: image
+`)
+	writeFile(incFile, `
+sync:
+- source: ocidir://testrepo:v2
+  target: ocidir://test-reload:v2
+  type: image
+`)
+	conf, err = ConfigLoadFile(confFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	var wg sync.WaitGroup
+	c := cron.New()
+	sch := schedulerNew(ctx, c, &wg)
+	sch.update(conf.Sync, true)
+	wg.Wait()
+	if len(c.Entries()) != 2 {
+		t.Errorf("unexpected cron entries, expected 2, received %d", len(c.Entries()))
+	}
+	digest1, err := configDigest(confFile)
+	if err != nil {
+		t.Fatalf("failed to digest config: %v", err)
+	}
+	origIDs := map[cron.EntryID]bool{}
+	for _, e := range c.Entries() {
+		origIDs[e.ID] = true
+	}
+
+	// change the included file, replacing v2 with v3
+	writeFile(incFile, `
+sync:
+- source: ocidir://testrepo:v3
+  target: ocidir://test-reload:v3
+  type: image
+`)
+	digest2, err := configDigest(confFile)
+	if err != nil {
+		t.Fatalf("failed to digest config: %v", err)
+	}
+	if string(digest1) == string(digest2) {
+		t.Errorf("digest did not change with the included file")
+	}
+	err = configReload(confFile, sch)
+	if err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	wg.Wait()
+	entries := c.Entries()
+	if len(entries) != 2 {
+		t.Errorf("unexpected cron entries, expected 2, received %d", len(entries))
+	}
+	kept := 0
+	for _, e := range entries {
+		if origIDs[e.ID] {
+			kept++
+		}
+	}
+	if kept != 1 {
+		t.Errorf("unchanged sync step was rescheduled")
+	}
+	if len(conf.Sync) != 2 || conf.Sync[1].Target != "ocidir://test-reload:v3" {
+		t.Errorf("unexpected sync steps after reload: %v", conf.Sync)
+	}
+	// the new step copies missing images immediately
+	if _, err := rwfs.Stat(fsMem, "test-reload/index.json"); err != nil {
+		t.Errorf("target not created: %v", err)
+	}
+
+	// an invalid config keeps the previous config
+	writeFile(incFile, "sync: [")
+	err = configReload(confFile, sch)
+	if err == nil {
+		t.Errorf("invalid config did not fail")
+	}
+	if len(c.Entries()) != 2 || len(conf.Sync) != 2 {
+		t.Errorf("invalid config changed the schedule")
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// statusCopied is an image copied to the target
+	statusCopied = "copied"
+	// statusSkipped is an image that did not need to be copied
+	statusSkipped = "skipped"
+	// statusNeeded is an image that would be copied when running check
+	statusNeeded = "needed"
+	// statusFailed is an image that failed to copy
+	statusFailed = "failed"
+	// statusRateLimited is an image that was not copied because of a rate limit
+	statusRateLimited = "ratelimited"
+)
+
+// syncReport collects the results of the last run of each sync step
+type syncReport struct {
+	mu       sync.Mutex
+	filename string
+	format   string
+	start    time.Time
+	order    []string
+	syncs    map[string]*reportSync
+}
+
+// reportOutput is the JSON report
+type reportOutput struct {
+	Start   time.Time     `json:"start"`
+	End     time.Time     `json:"end"`
+	Summary reportSummary `json:"summary"`
+	Syncs   []*reportSync `json:"syncs"`
+}
+
+// reportSummary counts images by status
+type reportSummary struct {
+	Copied      int `json:"copied"`
+	Skipped     int `json:"skipped"`
+	Needed      int `json:"needed"`
+	Failed      int `json:"failed"`
+	RateLimited int `json:"ratelimited"`
+}
+
+// reportSync is the result of a sync step
+type reportSync struct {
+	Source   string        `json:"source"`
+	Target   string        `json:"target"`
+	Type     string        `json:"type"`
+	Action   string        `json:"action"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Error    string        `json:"error,omitempty"`
+	Failures int           `json:"failures"`
+	Summary  reportSummary `json:"summary"`
+	Images   []reportImage `json:"images"`
+}
+
+// reportImage is the result of syncing an image
+type reportImage struct {
+	Source       string    `json:"source"`
+	Target       string    `json:"target"`
+	SourceDigest string    `json:"sourceDigest,omitempty"`
+	TargetDigest string    `json:"targetDigest,omitempty"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+}
+
+func reportNew(filename, format string) (*syncReport, error) {
+	switch format {
+	case "":
+		format = "json"
+	case "json", "junit":
+	default:
+		return nil, fmt.Errorf("report format %s, must be one of: json, junit: %w", format, ErrInvalidInput)
+	}
+	return &syncReport{
+		filename: filename,
+		format:   format,
+		start:    time.Now(),
+		syncs:    map[string]*reportSync{},
+	}, nil
+}
+
+// startSync resets the results for a sync step
+func (r *syncReport) startSync(s ConfigSync, action string, start time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := syncKey(s)
+	if _, ok := r.syncs[key]; !ok {
+		r.order = append(r.order, key)
+	}
+	r.syncs[key] = &reportSync{
+		Source: s.Source,
+		Target: s.Target,
+		Type:   s.Type,
+		Action: action,
+		Start:  start,
+		Images: []reportImage{},
+	}
+}
+
+// addImage adds an image result to a sync step
+func (r *syncReport) addImage(s ConfigSync, ri reportImage) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs, ok := r.syncs[syncKey(s)]
+	if !ok {
+		return
+	}
+	rs.Images = append(rs.Images, ri)
+	rs.Summary.add(ri.Status)
+}
+
+// endSync records the final result of a sync step
+func (r *syncReport) endSync(s ConfigSync, failures int, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs, ok := r.syncs[syncKey(s)]
+	if !ok {
+		return
+	}
+	rs.End = time.Now()
+	rs.Failures = failures
+	if err != nil {
+		rs.Error = err.Error()
+	}
+}
+
+func (sum *reportSummary) add(status string) {
+	switch status {
+	case statusCopied:
+		sum.Copied++
+	case statusSkipped:
+		sum.Skipped++
+	case statusNeeded:
+		sum.Needed++
+	case statusFailed:
+		sum.Failed++
+	case statusRateLimited:
+		sum.RateLimited++
+	}
+}
+
+// output returns the current report
+func (r *syncReport) output() reportOutput {
+	out := reportOutput{
+		Start: r.start,
+		End:   time.Now(),
+		Syncs: []*reportSync{},
+	}
+	for _, key := range r.order {
+		rs := r.syncs[key]
+		out.Syncs = append(out.Syncs, rs)
+		for _, ri := range rs.Images {
+			out.Summary.add(ri.Status)
+		}
+	}
+	return out
+}
+
+// write saves the report in the configured format
+func (r *syncReport) write() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := r.output()
+	var b []byte
+	var err error
+	switch r.format {
+	case "junit":
+		b, err = xml.MarshalIndent(out.junit(), "", "  ")
+		b = append([]byte(xml.Header), b...)
+	default:
+		b, err = json.MarshalIndent(out, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.filename), filepath.Base(r.filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.filename)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+// junit converts the report to JUnit XML, with a suite per sync step and a case per image
+func (out reportOutput) junit() junitSuites {
+	js := junitSuites{
+		Name: "regsync",
+		Time: out.End.Sub(out.Start).Seconds(),
+	}
+	for _, rs := range out.Syncs {
+		suite := junitSuite{
+			Name:      syncKey(ConfigSync{Source: rs.Source, Target: rs.Target}),
+			Time:      rs.End.Sub(rs.Start).Seconds(),
+			Timestamp: rs.Start.Format(time.RFC3339),
+		}
+		for _, ri := range rs.Images {
+			jc := junitCase{
+				Name:      ri.Target,
+				Classname: ri.Source,
+				Time:      ri.End.Sub(ri.Start).Seconds(),
+			}
+			switch ri.Status {
+			case statusFailed, statusRateLimited:
+				jc.Failure = &junitMessage{Message: ri.Error, Type: ri.Status}
+				suite.Failures++
+			case statusSkipped:
+				jc.Skipped = &junitMessage{Message: "no copy needed"}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, jc)
+		}
+		// include errors from the sync step that are not associated with an image
+		if rs.Error != "" && suite.Failures == 0 {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      rs.Target,
+				Classname: rs.Source,
+				Time:      suite.Time,
+				Failure:   &junitMessage{Message: rs.Error, Type: statusFailed},
+			})
+			suite.Failures++
+		}
+		suite.Tests = len(suite.Cases)
+		js.Tests += suite.Tests
+		js.Failures += suite.Failures
+		js.Skipped += suite.Skipped
+		js.Suites = append(js.Suites, suite)
+	}
+	return js
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	tempDir := t.TempDir()
+	stateFile := filepath.Join(tempDir, "state.json")
+	jsonFile := filepath.Join(tempDir, "report.json")
+	junitFile := filepath.Join(tempDir, "report.xml")
+	defer func() {
+		state = nil
+		report = nil
+	}()
+	_, err = reportNew(jsonFile, "yaml")
+	if err == nil {
+		t.Errorf("invalid report format did not fail")
+	}
+
+	syncs := []ConfigSync{
+		{
+			Source: "ocidir://testrepo",
+			Target: "ocidir://test-report",
+			Type:   "repository",
+			Tags:   ConfigTags{Allow: []string{"v1", "v2"}},
+		},
+		{
+			Source: "ocidir://testrepo:missing",
+			Target: "ocidir://test-report:missing",
+			Type:   "image",
+		},
+	}
+	for i := range syncs {
+		syncSetDefaults(&syncs[i], conf.Defaults)
+	}
+	// run twice, copying on the first pass and skipping on the second
+	for pass := 1; pass <= 2; pass++ {
+		state, err = stateLoad(stateFile)
+		if err != nil {
+			t.Fatalf("failed to load state: %v", err)
+		}
+		report, err = reportNew(jsonFile, "json")
+		if err != nil {
+			t.Fatalf("failed to create report: %v", err)
+		}
+		for _, s := range syncs {
+			_ = s.process(ctx, "once")
+		}
+		b, err := os.ReadFile(jsonFile)
+		if err != nil {
+			t.Fatalf("failed to read report: %v", err)
+		}
+		out := reportOutput{}
+		err = json.Unmarshal(b, &out)
+		if err != nil {
+			t.Fatalf("failed to parse report: %v", err)
+		}
+		expect := reportSummary{Copied: 2, Failed: 1}
+		if pass == 2 {
+			expect = reportSummary{Skipped: 2, Failed: 1}
+		}
+		if out.Summary != expect {
+			t.Errorf("pass %d: unexpected summary, expected %v, received %v", pass, expect, out.Summary)
+		}
+		if len(out.Syncs) != 2 || out.Syncs[1].Error == "" || out.Syncs[1].Failures != pass {
+			t.Errorf("pass %d: unexpected sync results: %v", pass, out.Syncs)
+		}
+	}
+
+	// validate the state
+	st, err := stateLoad(stateFile)
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	si, ok := st.Images["ocidir://test-report:v1"]
+	if !ok || si.TargetDigest == "" || si.TargetDigest != si.SourceDigest || si.LastSuccess.IsZero() {
+		t.Errorf("unexpected state for v1: %v", si)
+	}
+	si, ok = st.Images["ocidir://test-report:missing"]
+	if !ok || si.Failures != 2 || si.LastError == "" || !si.LastSuccess.IsZero() {
+		t.Errorf("unexpected state for missing: %v", si)
+	}
+	ss, ok := st.Syncs[syncKey(syncs[0])]
+	if !ok || ss.Failures != 0 || ss.LastSuccess.IsZero() {
+		t.Errorf("unexpected state for sync: %v", ss)
+	}
+
+	// check does not update the state and outputs junit
+	state = st
+	report, err = reportNew(junitFile, "junit")
+	if err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+	for _, s := range syncs {
+		_ = s.process(ctx, "check")
+	}
+	if state.Syncs[syncKey(syncs[1])].Failures != 2 {
+		t.Errorf("check updated the state")
+	}
+	b, err := os.ReadFile(junitFile)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	js := junitSuites{}
+	err = xml.Unmarshal(b, &js)
+	if err != nil {
+		t.Fatalf("failed to parse junit: %v", err)
+	}
+	if js.Tests != 3 || js.Failures != 1 || js.Skipped != 2 || len(js.Suites) != 2 {
+		t.Errorf("unexpected junit results: tests %d, failures %d, skipped %d", js.Tests, js.Failures, js.Skipped)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -22,7 +23,10 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/semver"
 	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/scheme/reg"
+	"github.com/regclient/regclient/signature"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/platform"
@@ -45,6 +49,7 @@ var rootOpts struct {
 	verbosity string
 	logopts   []string
 	format    string // for Go template formatting of various commands
+	checkFmt  string // for Go template formatting of the check plan
 }
 
 //go:embed embed/*
@@ -53,12 +58,16 @@ var embedFS embed.FS
 var (
 	// VCSRef and VCSTag are populated from an embed at build time
 	// These are used to version the UserAgent header
-	VCSRef = ""
-	VCSTag = ""
-	conf   *Config
-	log    *logrus.Logger
-	rc     *regclient.RegClient
-	sem    *semaphore.Weighted
+	VCSRef  = ""
+	VCSTag  = ""
+	conf    *Config
+	log     *logrus.Logger
+	rc      *regclient.RegClient
+	sem     *semaphore.Weighted
+	report  *syncReport
+	state   *stateStore
+	metrics *syncMetrics
+	plan    *checkPlan
 )
 
 var rootCmd = &cobra.Command{
@@ -82,6 +91,8 @@ var checkCmd = &cobra.Command{
 	Short: "processes each sync command once but skip actual copy",
 	Long: `Processes each sync command in the configuration file in order.
 Manifests are checked to see if a copy is needed, but only log, skip copying.
+A plan is output with the tags to be created, updated, backed up, or pruned,
+and the estimated bytes to transfer.
 No jobs are run in parallel, and the command returns after any error or last
 sync step is finished.`,
 	Args: cobra.RangeArgs(0, 0),
@@ -118,6 +129,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&rootOpts.verbosity, "verbosity", "v", logrus.InfoLevel.String(), "Log level (debug, info, warn, error, fatal, panic)")
 	rootCmd.PersistentFlags().StringArrayVar(&rootOpts.logopts, "logopt", []string{}, "Log options")
 	versionCmd.Flags().StringVarP(&rootOpts.format, "format", "", "{{jsonPretty .}}", "Format output with go template syntax")
+	checkCmd.Flags().StringVarP(&rootOpts.checkFmt, "format", "", "{{printPretty .}}", "Format plan with go template syntax, use \"{{jsonPretty .}}\" for json")
 
 	rootCmd.MarkPersistentFlagFilename("config")
 	serverCmd.MarkPersistentFlagRequired("config")
@@ -211,68 +223,37 @@ func runServer(cmd *cobra.Command, args []string) error {
 	}
 	ctx, cancel := context.WithCancel(cmd.Context())
 	var wg sync.WaitGroup
-	var mainErr error
-	c := cron.New(cron.WithChain(
-		cron.SkipIfStillRunning(cron.DefaultLogger),
-	))
-	for _, s := range conf.Sync {
-		s := s
-		sched := s.Schedule
-		if sched == "" && s.Interval != 0 {
-			sched = "@every " + s.Interval.String()
+	if conf.Defaults.Listen != "" {
+		metrics = metricsNew()
+		mux := metrics.handler()
+		if conf.Defaults.Webhook != nil {
+			mux.Handle("/webhook", &webhook{ctx: ctx, wg: &wg, token: conf.Defaults.Webhook.Token})
 		}
-		if sched != "" {
-			log.WithFields(logrus.Fields{
-				"source": s.Source,
-				"target": s.Target,
-				"type":   s.Type,
-				"sched":  sched,
-			}).Debug("Scheduled task")
-			c.AddFunc(sched, func() {
+		go func() {
+			err := httpServe(ctx, conf.Defaults.Listen, mux)
+			if err != nil {
 				log.WithFields(logrus.Fields{
-					"source": s.Source,
-					"target": s.Target,
-					"type":   s.Type,
-				}).Debug("Running task")
-				wg.Add(1)
-				defer wg.Done()
-				err := s.process(ctx, "copy")
-				if mainErr == nil {
-					mainErr = err
-				}
-			})
-			// immediately copy any images that are missing from target
-			if conf.Defaults.Parallel > 0 {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					err := s.process(ctx, "missing")
-					if err != nil {
-						if mainErr == nil {
-							mainErr = err
-						}
-						return
-					}
-				}()
-			} else {
-				err := s.process(ctx, "missing")
-				if err != nil {
-					if mainErr == nil {
-						mainErr = err
-					}
-				}
+					"listen": conf.Defaults.Listen,
+					"error":  err,
+				}).Error("HTTP listener failed")
 			}
-		} else {
-			log.WithFields(logrus.Fields{
-				"source": s.Source,
-				"target": s.Target,
-				"type":   s.Type,
-			}).Error("No schedule or interval found, ignoring")
-		}
+		}()
+	} else if conf.Defaults.Webhook != nil {
+		log.WithFields(logrus.Fields{}).Warn("Webhook requires listen to be configured, ignoring")
 	}
+	c := cron.New(cron.WithChain(
+		cron.SkipIfStillRunning(cron.DefaultLogger),
+	))
+	sch := schedulerNew(ctx, c, &wg)
+	sch.update(conf.Sync, true)
 	// wait for any initial copies to finish before scheduling
 	wg.Wait()
+	metrics.setReady()
 	c.Start()
+	// reload the config when files change
+	if rootOpts.confFile != "-" {
+		go configWatch(ctx, rootOpts.confFile, sch)
+	}
 	// wait on interrupt signal
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
@@ -283,7 +264,7 @@ func runServer(cmd *cobra.Command, args []string) error {
 	cancel()
 	log.WithFields(logrus.Fields{}).Debug("Waiting on running tasks")
 	wg.Wait()
-	return mainErr
+	return sch.err
 }
 
 // run check is used for a dry-run
@@ -294,6 +275,7 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	}
 	var mainErr error
 	ctx := cmd.Context()
+	plan = planNew()
 	for _, s := range conf.Sync {
 		err := s.process(ctx, "check")
 		if err != nil {
@@ -302,6 +284,10 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			}
 		}
 	}
+	err = template.Writer(os.Stdout, rootOpts.checkFmt, plan.output())
+	if err != nil {
+		return err
+	}
 	return mainErr
 }
 
@@ -313,12 +299,7 @@ func loadConf() error {
 			return err
 		}
 	} else if rootOpts.confFile != "" {
-		r, err := os.Open(rootOpts.confFile)
-		if err != nil {
-			return err
-		}
-		defer r.Close()
-		conf, err = ConfigLoadReader(r)
+		conf, err = ConfigLoadFile(rootOpts.confFile)
 		if err != nil {
 			return err
 		}
@@ -362,13 +343,35 @@ func loadConf() error {
 	if len(rcHosts) > 0 {
 		rcOpts = append(rcOpts, regclient.WithConfigHosts(rcHosts))
 	}
+	if conf.Defaults.BlobCache.Dir != "" {
+		rcOpts = append(rcOpts, regclient.WithBlobCache(conf.Defaults.BlobCache.Dir, conf.Defaults.BlobCache.MaxSize))
+	}
+	if conf.Defaults.UploadState != "" {
+		rcOpts = append(rcOpts, regclient.WithUploadStore(reg.NewUploadStoreDir(conf.Defaults.UploadState)))
+	}
 	rc = regclient.New(rcOpts...)
+	if conf.Defaults.State != "" {
+		state, err = stateLoad(conf.Defaults.State)
+		if err != nil {
+			return err
+		}
+	}
+	if conf.Defaults.Report.File != "" {
+		report, err = reportNew(conf.Defaults.Report.File, conf.Defaults.Report.Format)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // process a sync step
-func (s ConfigSync) process(ctx context.Context, action string) error {
-	var retErr error
+func (s ConfigSync) process(ctx context.Context, action string) (retErr error) {
+	start := time.Now()
+	report.startSync(s, action, start)
+	plan.startSync(s)
+	defer func() { s.recordSync(action, start, retErr) }()
+	ps := &pruneState{}
 	switch s.Type {
 	case "registry":
 		sRepos, err := rc.RepoList(ctx, s.Source)
@@ -415,7 +418,7 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 				retErr = err
 				continue
 			}
-			sTagList, err := s.filterTags(sTagsList)
+			sTagList, err := s.filterTags(ctx, sRepoRef, sTagsList)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					"source": sRepoRef.CommonName(),
@@ -426,16 +429,6 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 				retErr = err
 				continue
 			}
-			if len(sTagList) == 0 {
-				log.WithFields(logrus.Fields{
-					"source":    sRepoRef.CommonName(),
-					"allow":     s.Tags.Allow,
-					"deny":      s.Tags.Deny,
-					"available": sTagsList,
-				}).Info("No matching tags found")
-				retErr = err
-				continue
-			}
 			tRepoRef, err := ref.New(fmt.Sprintf("%s/%s", s.Target, repo))
 			if err != nil {
 				log.WithFields(logrus.Fields{
@@ -445,6 +438,14 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 				}).Error("Failed parsing target")
 				return err
 			}
+			if len(sTagList) == 0 {
+				log.WithFields(logrus.Fields{
+					"source":    sRepoRef.CommonName(),
+					"allow":     s.Tags.Allow,
+					"deny":      s.Tags.Deny,
+					"available": sTagsList,
+				}).Info("No matching tags found")
+			}
 			for _, tag := range sTagList {
 				sRef := sRepoRef
 				sRef.Tag = tag
@@ -459,15 +460,17 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 					}).Error("Failed to sync")
 					retErr = err
 				}
-				err = rc.Close(ctx, tRef)
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"ref":   tRef.CommonName(),
-						"error": err,
-					}).Error("Error closing ref")
-				}
+			}
+			err = s.pruneRepo(ctx, tRepoRef, sTagList, action, ps)
+			if err != nil {
+				retErr = err
 			}
 		}
+		// track the synced repositories and prune any that were removed from the source
+		err = s.pruneRepos(ctx, sRepoList, action, ps)
+		if err != nil {
+			retErr = err
+		}
 	case "repository":
 		sRepoRef, err := ref.New(s.Source)
 		if err != nil {
@@ -493,7 +496,7 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 			}).Error("Failed getting source tags")
 			return err
 		}
-		sTagList, err := s.filterTags(sTagsList)
+		sTagList, err := s.filterTags(ctx, sRepoRef, sTagsList)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"source": sRepoRef.CommonName(),
@@ -503,15 +506,6 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 			}).Error("Failed processing tag filters")
 			return err
 		}
-		if len(sTagList) == 0 {
-			log.WithFields(logrus.Fields{
-				"source":    sRepoRef.CommonName(),
-				"allow":     s.Tags.Allow,
-				"deny":      s.Tags.Deny,
-				"available": sTagsList,
-			}).Warn("No matching tags found")
-			return nil
-		}
 		tRepoRef, err := ref.New(s.Target)
 		if err != nil {
 			log.WithFields(logrus.Fields{
@@ -520,6 +514,15 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 			}).Error("Failed parsing target")
 			return err
 		}
+		if len(sTagList) == 0 {
+			log.WithFields(logrus.Fields{
+				"source":    sRepoRef.CommonName(),
+				"allow":     s.Tags.Allow,
+				"deny":      s.Tags.Deny,
+				"available": sTagsList,
+			}).Warn("No matching tags found")
+			return s.pruneRepo(ctx, tRepoRef, sTagList, action, ps)
+		}
 		for _, tag := range sTagList {
 			sRef := sRepoRef
 			sRef.Tag = tag
@@ -534,13 +537,10 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 				}).Error("Failed to sync")
 				retErr = err
 			}
-			err = rc.Close(ctx, tRef)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"ref":   tRef.CommonName(),
-					"error": err,
-				}).Error("Error closing ref")
-			}
+		}
+		err = s.pruneRepo(ctx, tRepoRef, sTagList, action, ps)
+		if err != nil {
+			retErr = err
 		}
 
 	case "image":
@@ -569,13 +569,6 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 			}).Error("Failed to sync")
 			retErr = err
 		}
-		err = rc.Close(ctx, tRef)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"ref":   tRef.CommonName(),
-				"error": err,
-			}).Error("Error closing ref")
-		}
 
 	default:
 		log.WithFields(logrus.Fields{
@@ -588,7 +581,25 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 }
 
 // process a sync step
-func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action string) error {
+func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action string) (err error) {
+	ri := reportImage{
+		Source: src.CommonName(),
+		Target: tgt.CommonName(),
+		Status: statusSkipped,
+		Start:  time.Now(),
+	}
+	defer func() { s.recordImage(action, ri, err) }()
+	// an ocifile target is only written when closed, so a failed close fails the image
+	defer func() {
+		errC := rc.Close(ctx, tgt)
+		if errC != nil && err == nil {
+			err = fmt.Errorf("failed to close %s: %w", tgt.CommonName(), errC)
+			log.WithFields(logrus.Fields{
+				"ref":   tgt.CommonName(),
+				"error": errC,
+			}).Error("Error closing ref")
+		}
+	}()
 	mSrc, err := rc.ManifestHead(ctx, src)
 	if err != nil && errors.Is(err, types.ErrUnsupportedAPI) {
 		mSrc, err = rc.ManifestGet(ctx, src)
@@ -600,13 +611,32 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		}).Error("Failed to lookup source manifest")
 		return err
 	}
+	ri.SourceDigest = manifest.GetDigest(mSrc).String()
+	metrics.setRateLimit(s, manifest.GetRateLimit(mSrc))
 	mTgt, err := rc.ManifestHead(ctx, tgt)
 	tgtExists := (err == nil)
+	if tgtExists {
+		ri.TargetDigest = manifest.GetDigest(mTgt).String()
+	}
 	tgtMatches := false
 	if err == nil && manifest.GetDigest(mSrc).String() == manifest.GetDigest(mTgt).String() {
 		tgtMatches = true
 	}
-	if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
+	// referrers added to an unchanged image are copied without the image
+	var referMissing []types.Descriptor
+	upToDate := func(dig string) (bool, error) {
+		if !tgtMatches || (s.ForceRecursive != nil && *s.ForceRecursive) {
+			return false, nil
+		}
+		referMissing, err = s.referrersMissing(ctx, src, tgt, dig)
+		if err != nil {
+			return false, err
+		}
+		return len(referMissing) == 0, nil
+	}
+	if ok, err := upToDate(manifest.GetDigest(mSrc).String()); err != nil {
+		return err
+	} else if ok {
 		log.WithFields(logrus.Fields{
 			"source": src.CommonName(),
 			"target": tgt.CommonName(),
@@ -639,6 +669,24 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		return nil
 	}
 
+	// refuse to sync images without a valid signature
+	if s.Verify != nil && s.Verify.Key != "" {
+		vDig, err := verifySource(ctx, src, *s.Verify)
+		if err == nil && vDig != manifest.GetDigest(mSrc) {
+			err = fmt.Errorf("source changed during verification, expected %s, verified %s", manifest.GetDigest(mSrc).String(), vDig.String())
+		}
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"source": src.CommonName(),
+				"target": tgt.CommonName(),
+				"error":  err,
+			}).Error("Source signature verification failed")
+			return err
+		}
+		// pin the source to the verified digest so a moved tag cannot be copied
+		src.Digest = vDig.String()
+	}
+
 	// if platform is defined and source is a list, resolve the source platform
 	if mSrc.IsList() && s.Platform != "" {
 		platDigest, err := getPlatformDigest(ctx, src, s.Platform, mSrc)
@@ -646,10 +694,13 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 			return err
 		}
 		src.Digest = platDigest.String()
+		ri.SourceDigest = src.Digest
 		if tgtExists && platDigest.String() == manifest.GetDigest(mTgt).String() {
 			tgtMatches = true
 		}
-		if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
+		if ok, err := upToDate(src.Digest); err != nil {
+			return err
+		} else if ok {
 			log.WithFields(logrus.Fields{
 				"source":   src.CommonName(),
 				"platform": s.Platform,
@@ -658,7 +709,50 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 			return nil
 		}
 	}
-	if tgtMatches {
+	// a rewritten index is compared using the digests of the selected platforms, a modified index is compared below
+	if mSrc.IsList() && s.PlatformsIndex && len(s.Platforms) > 0 && len(s.Mod) == 0 && tgtExists && !tgtMatches {
+		tgtMatches, err = platformsIndexMatch(ctx, src, tgt, s.Platforms, mSrc)
+		if err != nil {
+			return err
+		}
+		if ok, err := upToDate(manifest.GetDigest(mSrc).String()); err != nil {
+			return err
+		} else if ok {
+			log.WithFields(logrus.Fields{
+				"source":    src.CommonName(),
+				"platforms": s.Platforms,
+				"target":    tgt.CommonName(),
+			}).Debug("Image matches for platforms")
+			return nil
+		}
+	}
+	// a modified image is compared using the source digest annotation
+	srcDigest := manifest.GetDigest(mSrc).String()
+	if src.Digest != "" {
+		srcDigest = src.Digest
+	}
+	if len(s.Mod) > 0 && tgtExists && !tgtMatches {
+		tgtMatches, err = s.modMatch(ctx, tgt, srcDigest)
+		if err != nil {
+			return err
+		}
+		if ok, err := upToDate(srcDigest); err != nil {
+			return err
+		} else if ok {
+			log.WithFields(logrus.Fields{
+				"source": src.CommonName(),
+				"target": tgt.CommonName(),
+			}).Debug("Modified image matches")
+			return nil
+		}
+	}
+	if len(referMissing) > 0 {
+		log.WithFields(logrus.Fields{
+			"source":    src.CommonName(),
+			"target":    tgt.CommonName(),
+			"referrers": len(referMissing),
+		}).Info("Referrer sync needed")
+	} else if tgtMatches {
 		log.WithFields(logrus.Fields{
 			"source": src.CommonName(),
 			"target": tgt.CommonName(),
@@ -670,6 +764,8 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		}).Info("Image sync needed")
 	}
 	if action == "check" {
+		ri.Status = statusNeeded
+		s.planRef(ctx, src, tgt, ri, tgtExists, tgtMatches, referMissing)
 		return nil
 	}
 
@@ -699,6 +795,7 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 			}).Info("Delaying for rate limit")
 			select {
 			case <-ctx.Done():
+				ri.Status = statusRateLimited
 				return ErrCanceled
 			case <-time.After(s.RateLimit.Retry):
 			}
@@ -714,6 +811,7 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 			}
 			rlSrc = manifest.GetRateLimit(mSrc)
 		}
+		metrics.setRateLimit(s, rlSrc)
 		log.WithFields(logrus.Fields{
 			"source":        src.CommonName(),
 			"source-remain": rlSrc.Remain,
@@ -731,39 +829,10 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 
 	// run backup
 	if tgtExists && !tgtMatches && s.Backup != "" {
-		// expand template
-		data := struct {
-			Ref  ref.Ref
-			Step ConfigSync
-			Sync ConfigSync
-		}{Ref: tgt, Step: s, Sync: s}
-		backupStr, err := template.String(s.Backup, data)
+		backupRef, err := s.backupRef(tgt)
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"original":        tgt.CommonName(),
-				"backup-template": s.Backup,
-				"error":           err,
-			}).Error("Failed to expand backup template")
 			return err
 		}
-		backupStr = strings.TrimSpace(backupStr)
-		backupRef := tgt
-		if strings.ContainsAny(backupStr, ":/") {
-			// if the : or / are in the string, parse it as a full reference
-			backupRef, err = ref.New(backupStr)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"original": tgt.CommonName(),
-					"template": s.Backup,
-					"backup":   backupStr,
-					"error":    err,
-				}).Error("Failed to parse backup reference")
-				return err
-			}
-		} else {
-			// else parse backup string as just a tag
-			backupRef.Tag = backupStr
-		}
 		defer rc.Close(ctx, backupRef)
 		// run copy from tgt ref to backup ref
 		log.WithFields(logrus.Fields{
@@ -789,19 +858,35 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 	if s.ForceRecursive != nil && *s.ForceRecursive {
 		opts = append(opts, regclient.ImageWithForceRecursive())
 	}
+	opts = append(opts, s.referrerOpts()...)
 	if s.IncludeExternal != nil && *s.IncludeExternal {
 		opts = append(opts, regclient.ImageWithIncludeExternal())
 	}
 	if len(s.Platforms) > 0 {
 		opts = append(opts, regclient.ImageWithPlatforms(s.Platforms))
+		if s.PlatformsIndex {
+			opts = append(opts, regclient.ImageWithPlatformsIndex())
+		}
 	}
+	if conf.Defaults.ParallelBlobs > 1 {
+		opts = append(opts, regclient.ImageWithConcurrency(conf.Defaults.ParallelBlobs))
+	}
+	progressOpt := regclient.ImageWithCallback(newSyncProgress(s, src.CommonName(), tgt.CommonName()).callback)
+	opts = append(opts, progressOpt)
 
 	// Copy the image
 	log.WithFields(logrus.Fields{
 		"source": src.CommonName(),
 		"target": tgt.CommonName(),
 	}).Debug("Image sync running")
-	err = rc.ImageCopy(ctx, src, tgt, opts...)
+	if len(referMissing) > 0 {
+		// platform filters are not applied to referrers
+		err = s.referrersCopy(ctx, src, tgt, referMissing, append(s.referrerOpts(), progressOpt))
+	} else if len(s.Mod) > 0 {
+		err = s.copyMod(ctx, src, tgt, srcDigest, opts)
+	} else {
+		err = rc.ImageCopy(ctx, src, tgt, opts...)
+	}
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"source": src.CommonName(),
@@ -810,10 +895,55 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		}).Error("Failed to copy image")
 		return err
 	}
+	ri.Status = statusCopied
+	ri.TargetDigest = ri.SourceDigest
+	if len(s.Mod) > 0 || s.PlatformsIndex {
+		if mTgt, err := rc.ManifestHead(ctx, tgt); err == nil {
+			ri.TargetDigest = manifest.GetDigest(mTgt).String()
+		}
+	}
 	return nil
 }
 
-func (s ConfigSync) filterTags(in []string) ([]string, error) {
+// backupRef expands the backup template for the target
+func (s ConfigSync) backupRef(tgt ref.Ref) (ref.Ref, error) {
+	data := struct {
+		Ref  ref.Ref
+		Step ConfigSync
+		Sync ConfigSync
+	}{Ref: tgt, Step: s, Sync: s}
+	backupStr, err := template.String(s.Backup, data)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"original":        tgt.CommonName(),
+			"backup-template": s.Backup,
+			"error":           err,
+		}).Error("Failed to expand backup template")
+		return tgt, err
+	}
+	backupStr = strings.TrimSpace(backupStr)
+	backupRef := tgt
+	if strings.ContainsAny(backupStr, ":/") {
+		// if the : or / are in the string, parse it as a full reference
+		backupRef, err = ref.New(backupStr)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"original": tgt.CommonName(),
+				"template": s.Backup,
+				"backup":   backupStr,
+				"error":    err,
+			}).Error("Failed to parse backup reference")
+			return tgt, err
+		}
+	} else {
+		// else parse backup string as just a tag
+		backupRef.Tag = backupStr
+	}
+	return backupRef, nil
+}
+
+// filterTags applies the regex, semver, and age filters to a list of tags
+func (s ConfigSync) filterTags(ctx context.Context, r ref.Ref, in []string) ([]string, error) {
 	var result []string
 	// apply allow list
 	if len(s.Tags.Allow) > 0 {
@@ -857,9 +987,238 @@ func (s ConfigSync) filterTags(in []string) ([]string, error) {
 		}
 	}
 
+	// semver filters exclude any tag that is not a version
+	if len(s.Tags.SemverRange) > 0 || s.Tags.SemverLatest > 0 {
+		var err error
+		compressed, err = s.filterTagsSemver(compressed)
+		if err != nil {
+			return compressed, err
+		}
+	}
+
+	// age filters are applied last since they query the registry for each tag
+	if s.Tags.MinAge > 0 || s.Tags.MaxAge > 0 {
+		var err error
+		compressed, err = s.filterTagsAge(ctx, r, compressed)
+		if err != nil {
+			return compressed, err
+		}
+	}
+
 	return compressed, nil
 }
 
+// filterTagsSemver keeps tags matching any semver range, and then the latest N versions
+func (s ConfigSync) filterTagsSemver(in []string) ([]string, error) {
+	constraints := make([]semver.Constraint, 0, len(s.Tags.SemverRange))
+	for _, sr := range s.Tags.SemverRange {
+		c, err := semver.ParseConstraint(sr)
+		if err != nil {
+			return in, err
+		}
+		constraints = append(constraints, c)
+	}
+	type tagVer struct {
+		tag string
+		ver semver.Version
+	}
+	matched := []tagVer{}
+	for _, tag := range in {
+		v, err := semver.Parse(tag)
+		if err != nil {
+			continue
+		}
+		match := len(constraints) == 0
+		for _, c := range constraints {
+			if c.Check(v) {
+				match = true
+				break
+			}
+		}
+		if match {
+			matched = append(matched, tagVer{tag: tag, ver: v})
+		}
+	}
+	if s.Tags.SemverLatest > 0 && len(matched) > s.Tags.SemverLatest {
+		// sort newest first, keeping the original order for equal versions (e.g. "v1.2" and "1.2.0")
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].ver.Compare(matched[j].ver) > 0
+		})
+		matched = matched[:s.Tags.SemverLatest]
+	}
+	// return tags in the original order
+	keep := map[string]bool{}
+	for _, tv := range matched {
+		keep[tv.tag] = true
+	}
+	result := make([]string, 0, len(matched))
+	for _, tag := range in {
+		if keep[tag] {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+// filterTagsAge keeps tags with an image config created time within the min and max age.
+// Tags without a created time are excluded.
+// Any other error is returned rather than dropping the tag, since the result is also the keep list for pruning.
+func (s ConfigSync) filterTagsAge(ctx context.Context, r ref.Ref, in []string) ([]string, error) {
+	now := time.Now()
+	result := make([]string, 0, len(in))
+	for _, tag := range in {
+		tr := r
+		tr.Tag = tag
+		created, err := s.getCreatedCached(ctx, tr)
+		if err != nil && errors.Is(err, ErrCreatedMissing) {
+			log.WithFields(logrus.Fields{
+				"source": tr.CommonName(),
+				"error":  err,
+			}).Debug("Image created time not available, skipping tag")
+			continue
+		} else if err != nil {
+			log.WithFields(logrus.Fields{
+				"source": tr.CommonName(),
+				"error":  err,
+			}).Error("Failed to get image created time")
+			return in, fmt.Errorf("failed to get created time for %s: %w", tr.CommonName(), err)
+		}
+		age := now.Sub(created)
+		if (s.Tags.MinAge > 0 && age < s.Tags.MinAge) || (s.Tags.MaxAge > 0 && age > s.Tags.MaxAge) {
+			log.WithFields(logrus.Fields{
+				"source":  tr.CommonName(),
+				"created": created,
+			}).Debug("Tag excluded by age filter")
+			continue
+		}
+		result = append(result, tag)
+	}
+	return result, nil
+}
+
+// getCreatedCached returns the created time using a head request and the state cache, only pulling the image on a cache miss.
+// The created time of an image does not change, so the cache is indexed by the digest and platform.
+func (s ConfigSync) getCreatedCached(ctx context.Context, r ref.Ref) (time.Time, error) {
+	m, err := rc.ManifestHead(ctx, r)
+	if err != nil && errors.Is(err, types.ErrUnsupportedAPI) {
+		return getCreated(ctx, r, s.Platform)
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	dig := manifest.GetDigest(m).String()
+	if dig == "" {
+		return getCreated(ctx, r, s.Platform)
+	}
+	key := dig
+	if m.IsList() && s.Platform != "" {
+		key = dig + " " + s.Platform
+	}
+	if created, ok := state.created(key); ok {
+		if created.IsZero() {
+			return created, ErrCreatedMissing
+		}
+		return created, nil
+	}
+	// the image is pulled on a cache miss, so wait for the rate limit
+	err = s.rateLimitWait(ctx, r, m)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.Digest = dig
+	created, err := getCreated(ctx, r, s.Platform)
+	if err == nil {
+		state.setCreated(key, created)
+	} else if errors.Is(err, ErrCreatedMissing) {
+		state.setCreated(key, time.Time{})
+	}
+	return created, err
+}
+
+// rateLimitWait delays until the rate limit reported by the head request is at least the step minimum
+func (s ConfigSync) rateLimitWait(ctx context.Context, r ref.Ref, m manifest.Manifest) error {
+	rl := manifest.GetRateLimit(m)
+	for s.RateLimit.Min > 0 && rl.Set && rl.Remain < s.RateLimit.Min {
+		log.WithFields(logrus.Fields{
+			"source":        r.CommonName(),
+			"source-remain": rl.Remain,
+			"source-limit":  rl.Limit,
+			"step-min":      s.RateLimit.Min,
+			"sleep":         s.RateLimit.Retry,
+		}).Info("Delaying for rate limit")
+		select {
+		case <-ctx.Done():
+			return ErrCanceled
+		case <-time.After(s.RateLimit.Retry):
+		}
+		m, err := rc.ManifestHead(ctx, r)
+		if err != nil {
+			return err
+		}
+		rl = manifest.GetRateLimit(m)
+	}
+	metrics.setRateLimit(s, rl)
+	return nil
+}
+
+// getCreated returns the created time from the image config.
+// For a manifest list, the platform is used when set, otherwise the first image in the list.
+func getCreated(ctx context.Context, r ref.Ref, platStr string) (time.Time, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if m.IsList() {
+		var d types.Descriptor
+		if platStr != "" {
+			plat, err := platform.Parse(platStr)
+			if err != nil {
+				return time.Time{}, err
+			}
+			dp, err := manifest.GetPlatformDesc(m, &plat)
+			if err != nil {
+				return time.Time{}, err
+			}
+			d = *dp
+		} else {
+			mi, ok := m.(manifest.Indexer)
+			if !ok {
+				return time.Time{}, fmt.Errorf("manifest list not supported: %s: %w", manifest.GetMediaType(m), ErrCreatedMissing)
+			}
+			dl, err := mi.GetManifestList()
+			if err != nil {
+				return time.Time{}, err
+			}
+			if len(dl) == 0 {
+				return time.Time{}, fmt.Errorf("manifest list is empty: %w", ErrCreatedMissing)
+			}
+			d = dl[0]
+		}
+		r.Tag = ""
+		r.Digest = d.Digest.String()
+		m, err = rc.ManifestGet(ctx, r)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	mi, ok := m.(manifest.Imager)
+	if !ok {
+		return time.Time{}, fmt.Errorf("image config not supported: %s: %w", manifest.GetMediaType(m), ErrCreatedMissing)
+	}
+	cd, err := mi.GetConfig()
+	if err != nil {
+		return time.Time{}, err
+	}
+	conf, err := rc.BlobGetOCIConfig(ctx, r, cd)
+	if err != nil {
+		return time.Time{}, err
+	}
+	created := conf.GetConfig().Created
+	if created == nil {
+		return time.Time{}, ErrCreatedMissing
+	}
+	return *created, nil
+}
+
 var manifestCache struct {
 	mu        sync.Mutex
 	manifests map[string]manifest.Manifest
@@ -880,22 +1239,10 @@ func getPlatformDigest(ctx context.Context, r ref.Ref, platStr string, origMan m
 		}).Warn("Could not parse platform")
 		return "", err
 	}
-	// cache manifestGet response
-	manifestCache.mu.Lock()
-	getMan, ok := manifestCache.manifests[manifest.GetDigest(origMan).String()]
-	if !ok {
-		getMan, err = rc.ManifestGet(ctx, r)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"source": r.CommonName(),
-				"error":  err,
-			}).Error("Failed to get source manifest")
-			manifestCache.mu.Unlock()
-			return "", err
-		}
-		manifestCache.manifests[manifest.GetDigest(origMan).String()] = getMan
+	getMan, err := getManifestCached(ctx, r, origMan)
+	if err != nil {
+		return "", err
 	}
-	manifestCache.mu.Unlock()
 	descPlat, err := manifest.GetPlatformDesc(getMan, &plat)
 	if err != nil {
 		pl, _ := manifest.GetPlatformList(getMan)
@@ -913,6 +1260,102 @@ func getPlatformDigest(ctx context.Context, r ref.Ref, platStr string, origMan m
 	return descPlat.Digest, nil
 }
 
+// getManifestCached returns the full manifest for a manifest head, only calling ManifestGet for a new digest
+func getManifestCached(ctx context.Context, r ref.Ref, origMan manifest.Manifest) (manifest.Manifest, error) {
+	manifestCache.mu.Lock()
+	defer manifestCache.mu.Unlock()
+	getMan, ok := manifestCache.manifests[manifest.GetDigest(origMan).String()]
+	if !ok {
+		var err error
+		getMan, err = rc.ManifestGet(ctx, r)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"source": r.CommonName(),
+				"error":  err,
+			}).Error("Failed to get source manifest")
+			return nil, err
+		}
+		manifestCache.manifests[manifest.GetDigest(origMan).String()] = getMan
+	}
+	return getMan, nil
+}
+
+// platformsIndexMatch compares the digests of the selected platforms in the source with the target index
+func platformsIndexMatch(ctx context.Context, src, tgt ref.Ref, platforms []string, origMan manifest.Manifest) (bool, error) {
+	srcMan, err := getManifestCached(ctx, src, origMan)
+	if err != nil {
+		return false, err
+	}
+	tgtMan, err := rc.ManifestGet(ctx, tgt)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"target": tgt.CommonName(),
+			"error":  err,
+		}).Error("Failed to get target manifest")
+		return false, err
+	}
+	srcIdx, ok := srcMan.(manifest.Indexer)
+	if !ok {
+		return false, nil
+	}
+	tgtIdx, ok := tgtMan.(manifest.Indexer)
+	if !ok {
+		return false, nil
+	}
+	srcList, err := srcIdx.GetManifestList()
+	if err != nil {
+		return false, err
+	}
+	tgtList, err := tgtIdx.GetManifestList()
+	if err != nil {
+		return false, err
+	}
+	want := map[string]bool{}
+	for _, d := range srcList {
+		match, err := regclient.ImagePlatformInList(d.Platform, platforms)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			want[d.Digest.String()] = true
+		}
+	}
+	if len(want) != len(tgtList) {
+		return false, nil
+	}
+	for _, d := range tgtList {
+		if !want[d.Digest.String()] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// verifySource checks the source image for a signature from the configured public key, returning the verified digest
+func verifySource(ctx context.Context, src ref.Ref, v ConfigVerify) (digest.Digest, error) {
+	keyBytes, err := os.ReadFile(v.Key)
+	if err != nil {
+		return "", err
+	}
+	pub, err := signature.LoadPublicKey(keyBytes)
+	if err != nil {
+		return "", err
+	}
+	storage, err := signature.ParseStorage(v.Storage)
+	if err != nil {
+		return "", err
+	}
+	opts := []signature.Opts{signature.WithStorage(storage)}
+	if v.SkipIdentity {
+		opts = append(opts, signature.WithSkipIdentity())
+	}
+	p, err := signature.Verify(ctx, rc, src, pub, opts...)
+	if err != nil {
+		return "", err
+	}
+	return p.Critical.Image.DockerManifestDigest, nil
+}
+
 func setupVCSVars() {
 	verS := struct {
 		VCSRef string
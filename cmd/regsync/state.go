@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+)
+
+// stateStore persists the result of each sync step and image between runs
+type stateStore struct {
+	mu       sync.Mutex
+	filename string
+	Syncs    map[string]*stateSync  `json:"syncs"`
+	Images   map[string]*stateImage `json:"images"`
+	Created  map[string]time.Time   `json:"created,omitempty"` // digest and platform -> image created time, zero when not available
+}
+
+// stateSync is the last result of a sync step
+type stateSync struct {
+	Source        string    `json:"source"`
+	Target        string    `json:"target"`
+	Type          string    `json:"type"`
+	LastRun       time.Time `json:"lastRun"`
+	LastSuccess   time.Time `json:"lastSuccess,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+	Failures      int       `json:"failures"`
+	Repos         []string  `json:"repos,omitempty"`
+}
+
+// stateImage is the last result of syncing a single image, indexed by the target
+type stateImage struct {
+	Source        string    `json:"source"`
+	Target        string    `json:"target"`
+	SourceDigest  string    `json:"sourceDigest,omitempty"`
+	TargetDigest  string    `json:"targetDigest,omitempty"`
+	LastSuccess   time.Time `json:"lastSuccess,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+	Failures      int       `json:"failures"`
+}
+
+// stateLoad reads the state file, a missing file returns an empty state
+func stateLoad(filename string) (*stateStore, error) {
+	st := &stateStore{
+		filename: filename,
+		Syncs:    map[string]*stateSync{},
+		Images:   map[string]*stateImage{},
+		Created:  map[string]time.Time{},
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, st)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", filename, err)
+	}
+	if st.Syncs == nil {
+		st.Syncs = map[string]*stateSync{}
+	}
+	if st.Images == nil {
+		st.Images = map[string]*stateImage{}
+	}
+	if st.Created == nil {
+		st.Created = map[string]time.Time{}
+	}
+	return st, nil
+}
+
+// syncKey identifies a sync step in the state and report
+func syncKey(s ConfigSync) string {
+	return fmt.Sprintf("%s -> %s", s.Source, s.Target)
+}
+
+// updateSync records the result of a sync step and returns the count of consecutive failures
+func (st *stateStore) updateSync(s ConfigSync, start time.Time, err error) int {
+	if st == nil {
+		return 0
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := syncKey(s)
+	ss, ok := st.Syncs[key]
+	if !ok {
+		ss = &stateSync{Source: s.Source, Target: s.Target}
+		st.Syncs[key] = ss
+	}
+	ss.Type = s.Type
+	ss.LastRun = start
+	if err != nil {
+		ss.LastError = err.Error()
+		ss.LastErrorTime = time.Now()
+		ss.Failures++
+	} else {
+		ss.LastSuccess = time.Now()
+		ss.Failures = 0
+	}
+	return ss.Failures
+}
+
+// syncRepos returns the repositories previously synced by a registry sync step
+func (st *stateStore) syncRepos(s ConfigSync) []string {
+	if st == nil {
+		return []string{}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ss, ok := st.Syncs[syncKey(s)]
+	if !ok {
+		return []string{}
+	}
+	return append([]string{}, ss.Repos...)
+}
+
+// setSyncRepos records the repositories synced by a registry sync step
+func (st *stateStore) setSyncRepos(s ConfigSync, repos []string) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := syncKey(s)
+	ss, ok := st.Syncs[key]
+	if !ok {
+		ss = &stateSync{Source: s.Source, Target: s.Target}
+		st.Syncs[key] = ss
+	}
+	ss.Repos = repos
+}
+
+// updateImage records the result of syncing an image
+func (st *stateStore) updateImage(ri reportImage) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	si, ok := st.Images[ri.Target]
+	if !ok {
+		si = &stateImage{Target: ri.Target}
+		st.Images[ri.Target] = si
+	}
+	si.Source = ri.Source
+	if ri.SourceDigest != "" {
+		si.SourceDigest = ri.SourceDigest
+	}
+	switch ri.Status {
+	case statusFailed, statusRateLimited:
+		si.LastError = ri.Error
+		si.LastErrorTime = ri.End
+		si.Failures++
+	default:
+		if ri.TargetDigest != "" {
+			si.TargetDigest = ri.TargetDigest
+		}
+		si.LastSuccess = ri.End
+		si.Failures = 0
+	}
+}
+
+// created returns the cached created time of an image
+func (st *stateStore) created(key string) (time.Time, bool) {
+	if st == nil {
+		return time.Time{}, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.Created[key]
+	return t, ok
+}
+
+// setCreated caches the created time of an image
+func (st *stateStore) setCreated(key string, t time.Time) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Created[key] = t
+}
+
+// save writes the state to a temp file and renames it to avoid a partial write
+func (st *stateStore) save() error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(st.filename), filepath.Base(st.filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), st.filename)
+}
+
+// recordSync saves the result of a sync step to the state and report
+func (s ConfigSync) recordSync(action string, start time.Time, err error) {
+	failures := 0
+	if action != "check" {
+		failures = state.updateSync(s, start, err)
+	}
+	metrics.endSync(s, start, err)
+	plan.endSync(s, err)
+	report.endSync(s, failures, err)
+	recordSave(action)
+}
+
+// recordSave writes the state and report files
+func recordSave(action string) {
+	if action != "check" {
+		if serr := state.save(); serr != nil {
+			log.WithFields(logrus.Fields{
+				"file":  conf.Defaults.State,
+				"error": serr,
+			}).Error("Failed to save state")
+		}
+	}
+	if rerr := report.write(); rerr != nil {
+		log.WithFields(logrus.Fields{
+			"file":  conf.Defaults.Report.File,
+			"error": rerr,
+		}).Error("Failed to write report")
+	}
+}
+
+// recordImage saves the result of an image sync to the state and report
+func (s ConfigSync) recordImage(action string, ri reportImage, err error) {
+	ri.End = time.Now()
+	if err != nil {
+		ri.Error = err.Error()
+		if ri.Status != statusRateLimited {
+			ri.Status = statusFailed
+			if errors.Is(err, types.ErrRateLimit) {
+				ri.Status = statusRateLimited
+			}
+		}
+	}
+	if action != "check" {
+		state.updateImage(ri)
+	}
+	metrics.addImage(s, ri.Status)
+	report.addImage(s, ri)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/signature"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pub")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}), 0644)
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	rSigned, _ := ref.New("ocidir://testrepo:v1")
+	rCopy, _ := ref.New("ocidir://test-verify-copy:v1")
+	_, err = signature.Sign(ctx, rc, rSigned, key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	// the signature tag is copied to another repo without changing the identity
+	err = rc.ImageCopy(ctx, rSigned, rCopy, regclient.ImageWithDigestTags())
+	if err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		source       string
+		target       string
+		skipIdentity bool
+		expectErr    bool
+	}{
+		{
+			name:   "signed",
+			source: "ocidir://testrepo:v1",
+			target: "ocidir://test-verify:v1",
+		},
+		{
+			name:      "unsigned",
+			source:    "ocidir://testrepo:v2",
+			target:    "ocidir://test-verify:v2",
+			expectErr: true,
+		},
+		{
+			name:      "identity mismatch",
+			source:    "ocidir://test-verify-copy:v1",
+			target:    "ocidir://test-verify-identity:v1",
+			expectErr: true,
+		},
+		{
+			name:         "identity skipped",
+			source:       "ocidir://test-verify-copy:v1",
+			target:       "ocidir://test-verify-skip:v1",
+			skipIdentity: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ConfigSync{
+				Source: tt.source,
+				Target: tt.target,
+				Type:   "image",
+				Verify: &ConfigVerify{Key: keyFile, SkipIdentity: tt.skipIdentity},
+			}
+			syncSetDefaults(&s, conf.Defaults)
+			err := s.process(ctx, "once")
+			tgt, _ := ref.New(tt.target)
+			_, errHead := rc.ManifestHead(ctx, tgt)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("sync did not fail")
+				}
+				if errHead == nil {
+					t.Errorf("target was copied without a valid signature")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to sync: %v", err)
+			}
+			if errHead != nil {
+				t.Errorf("target missing after sync: %v", errHead)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookMaxBody limits the size of a webhook request
+const webhookMaxBody = 1024 * 1024
+
+// webhook receives push notifications and triggers matching sync steps
+type webhook struct {
+	ctx   context.Context
+	wg    *sync.WaitGroup
+	token string
+}
+
+// webhookPayload accepts either distribution notification events or a generic repository and tag
+type webhookPayload struct {
+	Events     []webhookEvent `json:"events"`
+	Repository string         `json:"repository"`
+	Tag        string         `json:"tag"`
+}
+
+// webhookEvent is a distribution notification event
+type webhookEvent struct {
+	Action string `json:"action"`
+	Target struct {
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+		URL        string `json:"url"`
+	} `json:"target"`
+	Request struct {
+		Host string `json:"host"`
+	} `json:"request"`
+}
+
+// webhookTask is a sync triggered by a webhook
+type webhookTask struct {
+	sync     ConfigSync
+	src, tgt ref.Ref
+	// full runs the entire sync step when a single tag cannot be filtered independently
+	full bool
+}
+
+func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// the config requires a token, an empty token rejects every request
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if wh.token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(wh.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBody))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	refs, err := webhookParse(body)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Invalid webhook payload")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tasks := []webhookTask{}
+	for _, evRef := range refs {
+		tasks = append(tasks, webhookMatch(wh.ctx, evRef)...)
+	}
+	for _, task := range tasks {
+		task := task
+		if wh.ctx.Err() != nil {
+			break
+		}
+		log.WithFields(logrus.Fields{
+			"source": task.src.CommonName(),
+			"target": task.tgt.CommonName(),
+			"full":   task.full,
+		}).Info("Webhook triggered sync")
+		wh.wg.Add(1)
+		go func() {
+			defer wh.wg.Done()
+			task.run(wh.ctx)
+		}()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(struct {
+		Triggered int `json:"triggered"`
+	}{Triggered: len(tasks)})
+}
+
+// webhookParse returns the pushed references from a webhook body
+func webhookParse(body []byte) ([]ref.Ref, error) {
+	p := webhookPayload{}
+	err := json.Unmarshal(body, &p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse payload: %w", err)
+	}
+	refs := []ref.Ref{}
+	if p.Repository != "" {
+		if p.Tag == "" {
+			return nil, fmt.Errorf("tag is required: %w", ErrInvalidInput)
+		}
+		r, err := ref.New(p.Repository + ":" + p.Tag)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	for _, ev := range p.Events {
+		// only pushes by tag trigger a sync
+		if ev.Action != "push" || ev.Target.Tag == "" || ev.Target.Repository == "" {
+			continue
+		}
+		host := ev.Request.Host
+		if host == "" && ev.Target.URL != "" {
+			u, err := url.Parse(ev.Target.URL)
+			if err == nil {
+				host = u.Host
+			}
+		}
+		if host == "" {
+			return nil, fmt.Errorf("registry host missing from event: %w", ErrInvalidInput)
+		}
+		r, err := ref.New(host + "/" + ev.Target.Repository + ":" + ev.Target.Tag)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, nil
+}
+
+// webhookMatch returns the sync steps with a source matching the pushed reference
+func webhookMatch(ctx context.Context, evRef ref.Ref) []webhookTask {
+	tasks := []webhookTask{}
+	confMu.RLock()
+	syncs := conf.Sync
+	confMu.RUnlock()
+	for _, s := range syncs {
+		var srcRepo, tgtRepo ref.Ref
+		var err error
+		switch s.Type {
+		case "image":
+			src, err := ref.New(s.Source)
+			if err != nil || src.Digest != "" || !ref.EqualRepository(src, evRef) || src.Tag != evRef.Tag {
+				continue
+			}
+			tgt, err := ref.New(s.Target)
+			if err != nil {
+				continue
+			}
+			tasks = append(tasks, webhookTask{sync: s, src: src, tgt: tgt})
+			continue
+		case "repository":
+			srcRepo, err = ref.New(s.Source)
+			if err != nil {
+				continue
+			}
+			tgtRepo, err = ref.New(s.Target)
+		case "registry":
+			srcRepo, err = ref.New(fmt.Sprintf("%s/%s", s.Source, evRef.Repository))
+			if err != nil {
+				continue
+			}
+			tgtRepo, err = ref.New(fmt.Sprintf("%s/%s", s.Target, evRef.Repository))
+		default:
+			continue
+		}
+		if err != nil || !ref.EqualRepository(srcRepo, evRef) {
+			continue
+		}
+		if s.Tags.SemverLatest > 0 {
+			// the latest versions depend on every tag in the repository
+			tasks = append(tasks, webhookTask{sync: s, src: srcRepo, tgt: tgtRepo, full: true})
+			continue
+		}
+		tags, err := s.filterTags(ctx, srcRepo, []string{evRef.Tag})
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+		srcRepo.Tag = evRef.Tag
+		tgtRepo.Tag = evRef.Tag
+		tasks = append(tasks, webhookTask{sync: s, src: srcRepo, tgt: tgtRepo})
+	}
+	return tasks
+}
+
+// run processes the triggered sync.
+// A single tag is recorded as an image result, leaving the results of the sync step unchanged.
+func (task webhookTask) run(ctx context.Context) {
+	s := task.sync
+	if task.full {
+		_ = s.process(ctx, "copy")
+		return
+	}
+	err := s.processRef(ctx, task.src, task.tgt, "copy")
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"target": task.tgt.CommonName(),
+			"source": task.src.CommonName(),
+			"error":  err,
+		}).Error("Failed to sync")
+	}
+	recordSave("copy")
+}
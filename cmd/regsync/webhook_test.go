@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	sem = semaphore.NewWeighted(1)
+	conf, err = ConfigLoadReader(bytes.NewReader([]byte(`
+  version: 1
+  defaults:
+    parallel: 1
+  sync:
+  - source: ocidir://testrepo
+    target: ocidir://test-wh
+    type: repository
+    tags:
+      allow:
+      - v1
+      - v2
+  - source: ocidir://testrepo:v2
+    target: ocidir://test-wh-img:v2
+    type: image
+  `)))
+	if err != nil {
+		t.Fatalf("failed parsing config: %v", err)
+	}
+	state, err = stateLoad(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	defer func() { state = nil }()
+	// a failing scheduled run of the repository step is not reset by a webhook
+	stepFailed := time.Now().Add(-1 * time.Hour)
+	state.updateSync(conf.Sync[0], stepFailed, ErrNotFound)
+	var wg sync.WaitGroup
+	wh := &webhook{ctx: ctx, wg: &wg, token: "secret"}
+
+	tests := []struct {
+		name      string
+		method    string
+		token     string
+		body      string
+		expStatus int
+		triggered int
+		exists    []string
+		missing   []string
+	}{
+		{
+			name:      "method",
+			method:    http.MethodGet,
+			token:     "secret",
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:      "unauthorized",
+			method:    http.MethodPost,
+			token:     "wrong",
+			body:      `{"repository":"ocidir://testrepo","tag":"v2"}`,
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "invalid",
+			method:    http.MethodPost,
+			token:     "secret",
+			body:      `{"repository":"ocidir://testrepo"}`,
+			expStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "filtered tag",
+			method:    http.MethodPost,
+			token:     "secret",
+			body:      `{"repository":"ocidir://testrepo","tag":"v3"}`,
+			expStatus: http.StatusAccepted,
+			missing:   []string{"ocidir://test-wh:v3"},
+		},
+		{
+			name:      "generic",
+			method:    http.MethodPost,
+			token:     "secret",
+			body:      `{"repository":"ocidir://testrepo","tag":"v2"}`,
+			expStatus: http.StatusAccepted,
+			triggered: 2,
+			exists:    []string{"ocidir://test-wh:v2", "ocidir://test-wh-img:v2"},
+			missing:   []string{"ocidir://test-wh:v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/webhook", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp := httptest.NewRecorder()
+			wh.ServeHTTP(resp, req)
+			wg.Wait()
+			if resp.Code != tt.expStatus {
+				t.Fatalf("unexpected status, expected %d, received %d", tt.expStatus, resp.Code)
+			}
+			if resp.Code == http.StatusAccepted {
+				result := struct {
+					Triggered int `json:"triggered"`
+				}{}
+				err := json.Unmarshal(resp.Body.Bytes(), &result)
+				if err != nil {
+					t.Fatalf("failed to parse response: %v", err)
+				}
+				if result.Triggered != tt.triggered {
+					t.Errorf("unexpected triggered count, expected %d, received %d", tt.triggered, result.Triggered)
+				}
+			}
+			for _, exist := range tt.exists {
+				r, _ := ref.New(exist)
+				if _, err := rc.ManifestHead(ctx, r); err != nil {
+					t.Errorf("ref does not exist: %s", exist)
+				}
+			}
+			for _, missing := range tt.missing {
+				r, _ := ref.New(missing)
+				if _, err := rc.ManifestHead(ctx, r); err == nil {
+					t.Errorf("ref exists: %s", missing)
+				}
+			}
+		})
+	}
+	ss := state.Syncs[syncKey(conf.Sync[0])]
+	if ss == nil || ss.Failures != 1 || !ss.LastRun.Equal(stepFailed) || !ss.LastSuccess.IsZero() {
+		t.Errorf("sync step state changed by webhook: %+v", ss)
+	}
+	if si := state.Images["ocidir://test-wh:v2"]; si == nil || si.LastSuccess.IsZero() {
+		t.Errorf("webhook image result not recorded: %+v", si)
+	}
+
+	t.Run("no token", func(t *testing.T) {
+		whOpen := &webhook{ctx: ctx, wg: &wg}
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(`{"repository":"ocidir://testrepo","tag":"v1"}`)))
+		resp := httptest.NewRecorder()
+		whOpen.ServeHTTP(resp, req)
+		wg.Wait()
+		if resp.Code != http.StatusUnauthorized {
+			t.Errorf("unexpected status, expected %d, received %d", http.StatusUnauthorized, resp.Code)
+		}
+	})
+}
+
+func TestWebhookConfig(t *testing.T) {
+	_, err := ConfigLoadReader(strings.NewReader(`
+  version: 1
+  defaults:
+    webhook: {}
+  `))
+	if !errors.Is(err, ErrMissingInput) {
+		t.Errorf("webhook without a token did not fail: %v", err)
+	}
+	t.Setenv("REGSYNC_DEFAULTS_WEBHOOK_TOKEN", "secret")
+	c, err := ConfigLoadReader(strings.NewReader(`
+  version: 1
+  defaults:
+    webhook: {}
+  `))
+	if err != nil {
+		t.Fatalf("failed to load config with token from env: %v", err)
+	}
+	if c.Defaults.Webhook.Token != "secret" {
+		t.Errorf("unexpected token: %s", c.Defaults.Webhook.Token)
+	}
+}
+
+func TestWebhookParse(t *testing.T) {
+	body := `{"events": [
+		{"action": "push", "target": {"repository": "library/alpine", "tag": "3"}, "request": {"host": "registry.example.com"}},
+		{"action": "push", "target": {"repository": "app", "tag": "v1", "url": "https://registry.example.org:5000/v2/app/manifests/sha256:abcd"}},
+		{"action": "push", "target": {"repository": "app", "url": "https://registry.example.org:5000/v2/app/manifests/sha256:abcd"}},
+		{"action": "pull", "target": {"repository": "library/alpine", "tag": "3"}, "request": {"host": "registry.example.com"}}
+	]}`
+	refs, err := webhookParse([]byte(body))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	expect := []string{"registry.example.com/library/alpine:3", "registry.example.org:5000/app:v1"}
+	if len(refs) != len(expect) {
+		t.Fatalf("unexpected refs: %v", refs)
+	}
+	for i := range expect {
+		if refs[i].CommonName() != expect[i] {
+			t.Errorf("unexpected ref, expected %s, received %s", expect[i], refs[i].CommonName())
+		}
+	}
+}
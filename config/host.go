@@ -118,6 +118,8 @@ type Host struct {
 	APIOpts     map[string]string `json:"apiOpts,omitempty" yaml:"apiOpts"`       // options for APIs
 	BlobChunk   int64             `json:"blobChunk,omitempty" yaml:"blobChunk"`   // size of each blob chunk
 	BlobMax     int64             `json:"blobMax,omitempty" yaml:"blobMax"`       // threshold to switch to chunked upload, -1 to disable, 0 for regclient.blobMaxPut
+	BlobGetMin  int64             `json:"blobGetMin,omitempty" yaml:"blobGetMin"` // threshold to split a blob download into parallel range requests, 0 for regclient.blobGetMin
+	BlobGetPar  int               `json:"blobGetPar,omitempty" yaml:"blobGetPar"` // number of parallel range requests for large blob downloads, 0 or 1 to disable
 }
 
 type Cred struct {
@@ -427,6 +429,28 @@ func (host *Host) Merge(newHost Host, log *logrus.Logger) error {
 		host.BlobMax = newHost.BlobMax
 	}
 
+	if newHost.BlobGetMin != 0 {
+		if host.BlobGetMin != 0 && host.BlobGetMin != newHost.BlobGetMin {
+			log.WithFields(logrus.Fields{
+				"orig": host.BlobGetMin,
+				"new":  newHost.BlobGetMin,
+				"host": name,
+			}).Warn("Changing blobGetMin settings for registry")
+		}
+		host.BlobGetMin = newHost.BlobGetMin
+	}
+
+	if newHost.BlobGetPar != 0 {
+		if host.BlobGetPar != 0 && host.BlobGetPar != newHost.BlobGetPar {
+			log.WithFields(logrus.Fields{
+				"orig": host.BlobGetPar,
+				"new":  newHost.BlobGetPar,
+				"host": name,
+			}).Warn("Changing blobGetPar settings for registry")
+		}
+		host.BlobGetPar = newHost.BlobGetPar
+	}
+
 	return nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	// crypto libraries included for go-digest
@@ -18,13 +19,17 @@ import (
 
 	digest "github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/docker/schema2"
 	"github.com/regclient/regclient/types/manifest"
 	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -34,6 +39,8 @@ const (
 	ociLayoutFilename      = "oci-layout"
 	annotationRefName      = "org.opencontainers.image.ref.name"
 	annotationImageName    = "io.containerd.image.name"
+	// AnnotationSourceDigest is set on an index rewritten by ImageWithPlatformsIndex to the digest of the source index
+	AnnotationSourceDigest = "io.regclient.source.digest"
 )
 
 // used by import/export to match docker tar expected format
@@ -70,18 +77,39 @@ type tarWriteData struct {
 }
 
 type imageOpt struct {
+	callback        func(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64)
 	child           bool
+	concurrency     int
 	forceRecursive  bool
 	includeExternal bool
 	digestTags      bool
 	platforms       []string
+	platformsIndex  bool
 	referrers       bool
+	referrerOpts    [][]scheme.ReferrerOpts
 	tagList         []string
+	mu              sync.Mutex
+	sem             *semaphore.Weighted
+	blobs           map[digest.Digest]*imageCopyBlobState
+}
+
+// imageCopyBlobState tracks a blob copy shared by parallel copies of the same digest
+type imageCopyBlobState struct {
+	done chan struct{}
+	err  error
 }
 
 // ImageOpts define options for the Image* commands
 type ImageOpts func(*imageOpt)
 
+// ImageWithCallback provides progress data to a callback function.
+// The callback may be called concurrently and should return quickly.
+func ImageWithCallback(callback func(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64)) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.callback = callback
+	}
+}
+
 // ImageWithChild attempts to copy every manifest and blob even if parent manifests already exist.
 func ImageWithChild() ImageOpts {
 	return func(opts *imageOpt) {
@@ -89,6 +117,14 @@ func ImageWithChild() ImageOpts {
 	}
 }
 
+// ImageWithConcurrency copies up to n blobs in parallel, along with the child manifests of an index.
+// Manifests are still pushed after all of their children and blobs have been copied.
+func ImageWithConcurrency(n int) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.concurrency = n
+	}
+}
+
 // ImageWithForceRecursive attempts to copy every manifest and blob even if parent manifests already exist.
 func ImageWithForceRecursive() ImageOpts {
 	return func(opts *imageOpt) {
@@ -112,7 +148,7 @@ func ImageWithDigestTags() ImageOpts {
 }
 
 // ImageWithPlatforms only copies specific platforms from a manifest list.
-// This will result in a failure on many registries that validate manifests.
+// This will result in a failure on many registries that validate manifests, see ImageWithPlatformsIndex.
 // Use the empty string to indicate images without a platform definition should be copied.
 func ImageWithPlatforms(p []string) ImageOpts {
 	return func(opts *imageOpt) {
@@ -120,14 +156,41 @@ func ImageWithPlatforms(p []string) ImageOpts {
 	}
 }
 
+// ImageWithPlatformsIndex rewrites the index to only include the platforms from ImageWithPlatforms.
+// The digest of the source index is added in the AnnotationSourceDigest annotation.
+func ImageWithPlatformsIndex() ImageOpts {
+	return func(opts *imageOpt) {
+		opts.platformsIndex = true
+	}
+}
+
 // ImageWithReferrers recursively includes images that refer to this.
+// Referrer options filter the referrers included, each call adds another filter.
 // EXPERIMENTAL: referrers implementation is considered experimental.
-func ImageWithReferrers() ImageOpts {
+func ImageWithReferrers(rOpts ...scheme.ReferrerOpts) ImageOpts {
 	return func(opts *imageOpt) {
 		opts.referrers = true
+		if len(rOpts) > 0 {
+			opts.referrerOpts = append(opts.referrerOpts, rOpts)
+		}
 	}
 }
 
+// manifestCB reports the state of a manifest to the callback
+func (opt *imageOpt) manifestCB(instance string, state types.CallbackState, cur, total int64) {
+	if opt.callback != nil {
+		opt.callback(types.CallbackManifest, instance, state, cur, total)
+	}
+}
+
+// blobOpts returns the options passed to BlobCopy
+func (opt *imageOpt) blobOpts() []BlobOpts {
+	if opt.callback == nil {
+		return nil
+	}
+	return []BlobOpts{BlobWithCallback(opt.callback)}
+}
+
 // ImageCopy copies an image
 // This will retag an image in the same repository, only pushing and pulling the top level manifest
 // On the same registry, it will attempt to use cross-repository blob mounts to avoid pulling blobs
@@ -137,9 +200,45 @@ func (rc *RegClient) ImageCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.R
 	for _, optFn := range opts {
 		optFn(&opt)
 	}
+	if opt.concurrency > 1 {
+		opt.sem = semaphore.NewWeighted(int64(opt.concurrency))
+		opt.blobs = map[digest.Digest]*imageCopyBlobState{}
+	}
 	return rc.imageCopyOpt(ctx, refSrc, refTgt, types.Descriptor{}, opt.child, &opt)
 }
 
+// imageCopyBlob copies a blob, limiting concurrency and sharing the result of parallel copies of the same digest
+func (rc *RegClient) imageCopyBlob(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opt *imageOpt) error {
+	if opt.sem == nil {
+		return rc.BlobCopy(ctx, refSrc, refTgt, d, opt.blobOpts()...)
+	}
+	opt.mu.Lock()
+	if state, ok := opt.blobs[d.Digest]; ok {
+		opt.mu.Unlock()
+		select {
+		case <-state.done:
+			return state.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	state := &imageCopyBlobState{done: make(chan struct{})}
+	opt.blobs[d.Digest] = state
+	opt.mu.Unlock()
+	defer close(state.done)
+	state.err = opt.sem.Acquire(ctx, 1)
+	if state.err != nil {
+		return state.err
+	}
+	defer opt.sem.Release(1)
+	// acquire may succeed on a canceled context when a slot is free
+	if state.err = ctx.Err(); state.err != nil {
+		return state.err
+	}
+	state.err = rc.BlobCopy(ctx, refSrc, refTgt, d, opt.blobOpts()...)
+	return state.err
+}
+
 func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, child bool, opt *imageOpt) error {
 	mOpts := []ManifestOpts{}
 	if child {
@@ -151,18 +250,17 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 	if err != nil {
 		return fmt.Errorf("failed looking up scheme for %s: %v", refTgt.CommonName(), err)
 	}
-	if tgtSI.ManifestPushFirst {
-		opt.forceRecursive = true
-	}
+	forceRecursive := opt.forceRecursive || tgtSI.ManifestPushFirst
 	// check if source and destination already match
 	mdh, errD := rc.ManifestHead(ctx, refTgt)
-	if opt.forceRecursive {
+	if forceRecursive {
 		// copy forced, unable to run below skips
 	} else if errD == nil && refTgt.Digest != "" && digest.Digest(refTgt.Digest) == mdh.GetDescriptor().Digest {
 		rc.log.WithFields(logrus.Fields{
 			"target": refTgt.Reference,
 			"digest": mdh.GetDescriptor().Digest.String(),
 		}).Info("Copy not needed, target already up to date")
+		opt.manifestCB(mdh.GetDescriptor().Digest.String(), types.CallbackSkipped, mdh.GetDescriptor().Size, mdh.GetDescriptor().Size)
 		return nil
 	} else if errD == nil && refTgt.Digest == "" {
 		msh, errS := rc.ManifestHead(ctx, refSrc)
@@ -172,6 +270,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				"target": refTgt.Reference,
 				"digest": mdh.GetDescriptor().Digest.String(),
 			}).Info("Copy not needed, target already up to date")
+			opt.manifestCB(mdh.GetDescriptor().Digest.String(), types.CallbackSkipped, mdh.GetDescriptor().Size, mdh.GetDescriptor().Size)
 			return nil
 		}
 	}
@@ -183,8 +282,33 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			"ref": refSrc.Reference,
 			"err": err,
 		}).Warn("Failed to get source manifest")
+		// the source digest is only known for child manifests or a source ref by digest
+		instance := d.Digest.String()
+		if instance == "" {
+			instance = refSrc.Digest
+		}
+		opt.manifestCB(instance, types.CallbackFailed, 0, d.Size)
 		return err
 	}
+	srcDigest := m.GetDescriptor().Digest
+	// rewrite the top level index to only include the selected platforms
+	if !child && opt.platformsIndex && len(opt.platforms) > 0 && m.IsList() {
+		m, err = ImagePlatformsIndex(m, opt.platforms)
+		if err != nil {
+			return err
+		}
+		if !forceRecursive && errD == nil && mdh.GetDescriptor().Digest == m.GetDescriptor().Digest {
+			rc.log.WithFields(logrus.Fields{
+				"source": refSrc.Reference,
+				"target": refTgt.Reference,
+				"digest": mdh.GetDescriptor().Digest.String(),
+			}).Info("Copy not needed, target already up to date")
+			opt.manifestCB(mdh.GetDescriptor().Digest.String(), types.CallbackSkipped, mdh.GetDescriptor().Size, mdh.GetDescriptor().Size)
+			return nil
+		}
+	}
+	mDesc := m.GetDescriptor()
+	opt.manifestCB(mDesc.Digest.String(), types.CallbackStarted, 0, mDesc.Size)
 
 	if tgtSI.ManifestPushFirst {
 		// push manifest to target
@@ -194,12 +318,33 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				"target": refTgt.Reference,
 				"err":    err,
 			}).Warn("Failed to push manifest")
+			opt.manifestCB(mDesc.Digest.String(), types.CallbackFailed, 0, mDesc.Size)
 			return err
 		}
 	}
 
 	if !ref.EqualRepository(refSrc, refTgt) {
 		// copy components of the image if the repository is different
+		// with concurrency enabled, child manifests and blobs are copied in parallel
+		var g *errgroup.Group
+		gCtx := ctx
+		if opt.sem != nil {
+			// cancel and wait for any running copies when returning early
+			var cancel context.CancelFunc
+			gCtx, cancel = context.WithCancel(ctx)
+			g, gCtx = errgroup.WithContext(gCtx)
+			defer func() {
+				cancel()
+				_ = g.Wait()
+			}()
+		}
+		run := func(fn func(ctx context.Context) error) error {
+			if g == nil {
+				return fn(gCtx)
+			}
+			g.Go(func() error { return fn(gCtx) })
+			return nil
+		}
 		if mi, ok := m.(manifest.Indexer); ok {
 			// manifest lists need to recursively copy nested images by digest
 			pd, err := mi.GetManifestList()
@@ -207,9 +352,10 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				return err
 			}
 			for _, entry := range pd {
+				entry := entry
 				// skip copy of platforms not specifically included
 				if len(opt.platforms) > 0 {
-					match, err := imagePlatformInList(entry.Platform, opt.platforms)
+					match, err := ImagePlatformInList(entry.Platform, opt.platforms)
 					if err != nil {
 						return err
 					}
@@ -230,26 +376,31 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				entryTgt.Tag = ""
 				entrySrc.Digest = entry.Digest.String()
 				entryTgt.Digest = entry.Digest.String()
-				switch entry.MediaType {
-				case types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned,
-					types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList,
-					types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
-					// known manifest media type
-					err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
-				case types.MediaTypeDocker2ImageConfig, types.MediaTypeOCI1ImageConfig,
-					types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip,
-					types.MediaTypeBuildkitCacheConfig:
-					// known blob media type
-					err = rc.BlobCopy(ctx, entrySrc, entryTgt, entry)
-				default:
-					// unknown media type, first try an image copy
-					err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
-					if err != nil {
-						// fall back to trying to copy a blob
-						err = rc.BlobCopy(ctx, entrySrc, entryTgt, entry)
+				err = run(func(ctx context.Context) error {
+					var err error
+					switch entry.MediaType {
+					case types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned,
+						types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList,
+						types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
+						// known manifest media type
+						err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
+					case types.MediaTypeDocker2ImageConfig, types.MediaTypeOCI1ImageConfig,
+						types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip, types.MediaTypeOCI1LayerZstd,
+						types.MediaTypeBuildkitCacheConfig:
+						// known blob media type
+						err = rc.imageCopyBlob(ctx, entrySrc, entryTgt, entry, opt)
+					default:
+						// unknown media type, first try an image copy
+						err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
+						if err != nil {
+							// fall back to trying to copy a blob
+							err = rc.imageCopyBlob(ctx, entrySrc, entryTgt, entry, opt)
+						}
 					}
-				}
+					return err
+				})
 				if err != nil {
+					opt.manifestCB(mDesc.Digest.String(), types.CallbackFailed, 0, mDesc.Size)
 					return err
 				}
 			}
@@ -273,13 +424,20 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					"target": refTgt.Reference,
 					"digest": cd.Digest.String(),
 				}).Info("Copy config")
-				if err := rc.BlobCopy(ctx, refSrc, refTgt, cd); err != nil {
-					rc.log.WithFields(logrus.Fields{
-						"source": refSrc.Reference,
-						"target": refTgt.Reference,
-						"digest": cd.Digest.String(),
-						"err":    err,
-					}).Warn("Failed to copy config")
+				err = run(func(ctx context.Context) error {
+					if err := rc.imageCopyBlob(ctx, refSrc, refTgt, cd, opt); err != nil {
+						rc.log.WithFields(logrus.Fields{
+							"source": refSrc.Reference,
+							"target": refTgt.Reference,
+							"digest": cd.Digest.String(),
+							"err":    err,
+						}).Warn("Failed to copy config")
+						return err
+					}
+					return nil
+				})
+				if err != nil {
+					opt.manifestCB(mDesc.Digest.String(), types.CallbackFailed, 0, mDesc.Size)
 					return err
 				}
 			}
@@ -290,6 +448,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				return err
 			}
 			for _, layerSrc := range l {
+				layerSrc := layerSrc
 				if len(layerSrc.URLs) > 0 && !opt.includeExternal {
 					// skip blobs where the URLs are defined, these aren't hosted and won't be pulled from the source
 					rc.log.WithFields(logrus.Fields{
@@ -305,19 +464,32 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					"target": refTgt.Reference,
 					"layer":  layerSrc.Digest.String(),
 				}).Info("Copy layer")
-				if err := rc.BlobCopy(ctx, refSrc, refTgt, layerSrc); err != nil {
-					rc.log.WithFields(logrus.Fields{
-						"source": refSrc.Reference,
-						"target": refTgt.Reference,
-						"layer":  layerSrc.Digest.String(),
-						"err":    err,
-					}).Warn("Failed to copy layer")
+				err = run(func(ctx context.Context) error {
+					if err := rc.imageCopyBlob(ctx, refSrc, refTgt, layerSrc, opt); err != nil {
+						rc.log.WithFields(logrus.Fields{
+							"source": refSrc.Reference,
+							"target": refTgt.Reference,
+							"layer":  layerSrc.Digest.String(),
+							"err":    err,
+						}).Warn("Failed to copy layer")
+						return err
+					}
+					return nil
+				})
+				if err != nil {
+					opt.manifestCB(mDesc.Digest.String(), types.CallbackFailed, 0, mDesc.Size)
 					return err
 				}
 			}
 		}
+		// wait for any parallel copies before pushing the manifest
+		if g != nil {
+			if err := g.Wait(); err != nil {
+				opt.manifestCB(mDesc.Digest.String(), types.CallbackFailed, 0, mDesc.Size)
+				return err
+			}
+		}
 	}
-
 	if !tgtSI.ManifestPushFirst {
 		// push manifest to target
 		err = rc.ManifestPut(ctx, refTgt, m, mOpts...)
@@ -326,14 +498,16 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				"target": refTgt.Reference,
 				"err":    err,
 			}).Warn("Failed to push manifest")
+			opt.manifestCB(mDesc.Digest.String(), types.CallbackFailed, 0, mDesc.Size)
 			return err
 		}
 	}
+	opt.manifestCB(mDesc.Digest.String(), types.CallbackFinished, mDesc.Size, mDesc.Size)
 
 	// EXPERIMENTAL support for referrers
 	referTags := []string{}
 	if opt.referrers {
-		rl, err := rc.ReferrerList(ctx, refSrc)
+		rl, err := rc.imageReferrerList(ctx, refSrc, opt.referrerOpts)
 		if err != nil {
 			return err
 		}
@@ -359,9 +533,11 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 
 	// lookup digest tags to include artifacts with image
 	if opt.digestTags {
+		opt.mu.Lock()
 		if len(opt.tagList) == 0 {
 			tl, err := rc.TagList(ctx, refSrc)
 			if err != nil {
+				opt.mu.Unlock()
 				rc.log.WithFields(logrus.Fields{
 					"source": refSrc.Reference,
 					"err":    err,
@@ -370,6 +546,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			}
 			tags, err := tl.GetTags()
 			if err != nil {
+				opt.mu.Unlock()
 				rc.log.WithFields(logrus.Fields{
 					"source": refSrc.Reference,
 					"err":    err,
@@ -378,8 +555,10 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			}
 			opt.tagList = tags
 		}
-		prefix := fmt.Sprintf("%s-%s", m.GetDescriptor().Digest.Algorithm(), m.GetDescriptor().Digest.Encoded())
-		for _, tag := range opt.tagList {
+		tagList := opt.tagList
+		opt.mu.Unlock()
+		prefix := fmt.Sprintf("%s-%s", srcDigest.Algorithm(), srcDigest.Encoded())
+		for _, tag := range tagList {
 			if strings.HasPrefix(tag, prefix) {
 				// skip referrers that were copied above
 				for _, referTag := range referTags {
@@ -421,8 +600,12 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 // index.json: created at top level, single descriptor with org.opencontainers.image.ref.name annotation pointing to the tag
 // manifest.json: created at top level, based on every layer added, only works for a single arch image
 // blobs/$algo/$hash: each content addressable object (manifest, config, or layer), created recursively
-func (rc *RegClient) ImageExport(ctx context.Context, r ref.Ref, outStream io.Writer) error {
+func (rc *RegClient) ImageExport(ctx context.Context, r ref.Ref, outStream io.Writer, opts ...ImageOpts) error {
 	var ociIndex v1.Index
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
 
 	// create tar writer object
 	tw := tar.NewWriter(outStream)
@@ -503,7 +686,7 @@ func (rc *RegClient) ImageExport(ctx context.Context, r ref.Ref, outStream io.Wr
 	}
 
 	// recursively include manifests and nested blobs
-	err = rc.imageExportDescriptor(ctx, r, mDesc, twd)
+	err = rc.imageExportDescriptor(ctx, r, mDesc, twd, &opt)
 	if err != nil {
 		return err
 	}
@@ -512,12 +695,36 @@ func (rc *RegClient) ImageExport(ctx context.Context, r ref.Ref, outStream io.Wr
 }
 
 // imageExportDescriptor pulls a manifest or blob, outputs to a tar file, and recursively processes any nested manifests or blobs
-func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, desc types.Descriptor, twd *tarWriteData) error {
+func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, desc types.Descriptor, twd *tarWriteData, opt *imageOpt) error {
 	tarFilename := tarOCILayoutDescPath(desc)
+	kind := types.CallbackBlob
+	switch desc.MediaType {
+	case types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned, types.MediaTypeDocker2Manifest, types.MediaTypeOCI1Manifest,
+		types.MediaTypeDocker2ManifestList, types.MediaTypeOCI1ManifestList:
+		kind = types.CallbackManifest
+	}
+	cb := func(state types.CallbackState, cur int64) {
+		if opt.callback != nil {
+			opt.callback(kind, desc.Digest.String(), state, cur, desc.Size)
+		}
+	}
 	if twd.files[tarFilename] {
 		// blob has already been imported into tar, skip
+		cb(types.CallbackSkipped, desc.Size)
 		return nil
 	}
+	cb(types.CallbackStarted, 0)
+	err := rc.imageExportDescriptorContent(ctx, ref, desc, twd, opt, tarFilename)
+	if err != nil {
+		cb(types.CallbackFailed, 0)
+		return err
+	}
+	cb(types.CallbackFinished, desc.Size)
+	return nil
+}
+
+// imageExportDescriptorContent writes the content of a descriptor to the tar file, recursing into nested descriptors
+func (rc *RegClient) imageExportDescriptorContent(ctx context.Context, ref ref.Ref, desc types.Descriptor, twd *tarWriteData, opt *imageOpt, tarFilename string) error {
 	switch desc.MediaType {
 	case types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned, types.MediaTypeDocker2Manifest, types.MediaTypeOCI1Manifest:
 		// Handle single platform manifests
@@ -551,7 +758,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 			return err
 		}
 		if err == nil {
-			err = rc.imageExportDescriptor(ctx, ref, confD, twd)
+			err = rc.imageExportDescriptor(ctx, ref, confD, twd, opt)
 			if err != nil {
 				return err
 			}
@@ -565,7 +772,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 		}
 		if err == nil {
 			for _, layerD := range layerDL {
-				err = rc.imageExportDescriptor(ctx, ref, layerD, twd)
+				err = rc.imageExportDescriptor(ctx, ref, layerD, twd, opt)
 				if err != nil {
 					return err
 				}
@@ -602,7 +809,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 			return err
 		}
 		for _, md := range mdl {
-			err = rc.imageExportDescriptor(ctx, ref, md, twd)
+			err = rc.imageExportDescriptor(ctx, ref, md, twd, opt)
 			if err != nil {
 				return err
 			}
@@ -620,7 +827,13 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 		if err != nil {
 			return err
 		}
-		size, err := io.Copy(twd.tw, blobR)
+		var rdr io.Reader = blobR
+		if opt.callback != nil {
+			rdr = &blobProgressReader{r: blobR, cb: func(cur int64) {
+				opt.callback(types.CallbackBlob, desc.Digest.String(), types.CallbackActive, cur, desc.Size)
+			}}
+		}
+		size, err := io.Copy(twd.tw, rdr)
 		if err != nil {
 			return fmt.Errorf("failed to export blob %s: %w", desc.Digest.String(), err)
 		}
@@ -845,7 +1058,7 @@ func (rc *RegClient) imageImportOCIHandleManifest(ctx context.Context, ref ref.R
 					}
 					return rc.imageImportOCIHandleManifest(ctx, ref, md, trd, true, child)
 				case types.MediaTypeDocker2ImageConfig, types.MediaTypeOCI1ImageConfig,
-					types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip,
+					types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip, types.MediaTypeOCI1LayerZstd,
 					types.MediaTypeBuildkitCacheConfig:
 					// known blob media types
 					return rc.imageImportBlob(ctx, ref, d, trd)
@@ -980,7 +1193,9 @@ func (rc *RegClient) imageImportOCIPushManifests(ctx context.Context, ref ref.Re
 	return nil
 }
 
-func imagePlatformInList(target *platform.Platform, list []string) (bool, error) {
+// ImagePlatformInList returns true if the platform matches an entry in the list.
+// An empty entry only matches an unset platform.
+func ImagePlatformInList(target *platform.Platform, list []string) (bool, error) {
 	// special case for an unset platform
 	if target == nil || target.OS == "" {
 		for _, entry := range list {
@@ -1005,6 +1220,82 @@ func imagePlatformInList(target *platform.Platform, list []string) (bool, error)
 	return false, nil
 }
 
+// imageReferrerList returns the referrers matching any of the filters, or all referrers without a filter
+func (rc *RegClient) imageReferrerList(ctx context.Context, r ref.Ref, filters [][]scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	if len(filters) == 0 {
+		return rc.ReferrerList(ctx, r)
+	}
+	rlAll := referrer.ReferrerList{Ref: r}
+	foundDigest := map[digest.Digest]bool{}
+	foundTag := map[string]bool{}
+	for _, rOpts := range filters {
+		rl, err := rc.ReferrerList(ctx, r, rOpts...)
+		if err != nil {
+			return rlAll, err
+		}
+		for _, d := range rl.Descriptors {
+			if !foundDigest[d.Digest] {
+				foundDigest[d.Digest] = true
+				rlAll.Descriptors = append(rlAll.Descriptors, d)
+			}
+		}
+		for _, tag := range rl.Tags {
+			if !foundTag[tag] {
+				foundTag[tag] = true
+				rlAll.Tags = append(rlAll.Tags, tag)
+			}
+		}
+	}
+	return rlAll, nil
+}
+
+// ImagePlatformsIndex returns a copy of an index that only includes entries matching the platform list.
+// The copy is annotated with the source digest, matching the index pushed by [ImageWithPlatformsIndex].
+func ImagePlatformsIndex(m manifest.Manifest, platforms []string) (manifest.Manifest, error) {
+	raw, err := m.RawBody()
+	if err != nil {
+		return nil, err
+	}
+	mNew, err := manifest.New(manifest.WithRaw(raw), manifest.WithDesc(m.GetDescriptor()))
+	if err != nil {
+		return nil, err
+	}
+	mi, ok := mNew.(manifest.Indexer)
+	if !ok {
+		return nil, fmt.Errorf("manifest does not support an index: %w", types.ErrUnsupportedMediaType)
+	}
+	ma, ok := mNew.(manifest.Annotator)
+	if !ok {
+		return nil, fmt.Errorf("manifest does not support annotations: %w", types.ErrUnsupportedMediaType)
+	}
+	dl, err := mi.GetManifestList()
+	if err != nil {
+		return nil, err
+	}
+	dlNew := []types.Descriptor{}
+	for _, d := range dl {
+		match, err := ImagePlatformInList(d.Platform, platforms)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			dlNew = append(dlNew, d)
+		}
+	}
+	if len(dlNew) == 0 {
+		return nil, fmt.Errorf("no platforms matched %v: %w", platforms, types.ErrNotFound)
+	}
+	err = mi.SetManifestList(dlNew)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.SetAnnotation(AnnotationSourceDigest, m.GetDescriptor().Digest.String())
+	if err != nil {
+		return nil, err
+	}
+	return mNew, nil
+}
+
 // tarReadAll processes the tar file in a loop looking for matching filenames in the list of handlers
 // handlers for filenames are added at the top level, and by manifest imports
 func (trd *tarReadData) tarReadAll(rs io.ReadSeeker) error {
@@ -0,0 +1,239 @@
+package regclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestImageCallback(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rTgt, err := ref.New("ocidir://testcb:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	var mu sync.Mutex
+	states := map[types.CallbackKind]map[string]types.CallbackState{
+		types.CallbackManifest: {},
+		types.CallbackBlob:     {},
+	}
+	cb := func(kind types.CallbackKind, instance string, state types.CallbackState, cur, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if cur > total {
+			t.Errorf("%s %s: current %d exceeds total %d", kind, instance, cur, total)
+		}
+		if state != types.CallbackActive {
+			states[kind][instance] = state
+		}
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithCallback(cb))
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if len(states[types.CallbackManifest]) == 0 || len(states[types.CallbackBlob]) == 0 {
+			t.Fatalf("callbacks missing, manifests %d, blobs %d", len(states[types.CallbackManifest]), len(states[types.CallbackBlob]))
+		}
+		finished := 0
+		for kind, instances := range states {
+			for inst, state := range instances {
+				switch state {
+				case types.CallbackFinished:
+					finished++
+				case types.CallbackSkipped:
+					// blobs shared between platforms are only copied once
+				default:
+					t.Errorf("%s %s: unexpected state %s", kind, inst, state)
+				}
+			}
+		}
+		if finished == 0 {
+			t.Errorf("no transfers finished")
+		}
+	})
+
+	t.Run("copy skipped", func(t *testing.T) {
+		states[types.CallbackManifest] = map[string]types.CallbackState{}
+		states[types.CallbackBlob] = map[string]types.CallbackState{}
+		err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithCallback(cb), ImageWithChild())
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		for kind, instances := range states {
+			for inst, state := range instances {
+				if kind == types.CallbackBlob && state != types.CallbackSkipped {
+					t.Errorf("%s %s: unexpected state %s", kind, inst, state)
+				}
+			}
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		states[types.CallbackManifest] = map[string]types.CallbackState{}
+		states[types.CallbackBlob] = map[string]types.CallbackState{}
+		buf := &bytes.Buffer{}
+		err = rc.ImageExport(ctx, rSrc, buf, ImageWithCallback(cb))
+		if err != nil {
+			t.Fatalf("failed to export: %v", err)
+		}
+		if len(states[types.CallbackManifest]) == 0 || len(states[types.CallbackBlob]) == 0 {
+			t.Fatalf("callbacks missing, manifests %d, blobs %d", len(states[types.CallbackManifest]), len(states[types.CallbackBlob]))
+		}
+		for kind, instances := range states {
+			for inst, state := range instances {
+				if state != types.CallbackFinished && state != types.CallbackSkipped {
+					t.Errorf("%s %s: unexpected state %s", kind, inst, state)
+				}
+			}
+		}
+	})
+}
+
+func TestImageConcurrency(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		rTgt, err := ref.New("ocidir://testparallel:v3")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithConcurrency(4), ImageWithReferrers(), ImageWithDigestTags())
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		mSrc, err := rc.ManifestHead(ctx, rSrc)
+		if err != nil {
+			t.Fatalf("failed to head source: %v", err)
+		}
+		mTgt, err := rc.ManifestHead(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("failed to head target: %v", err)
+		}
+		if mSrc.GetDescriptor().Digest != mTgt.GetDescriptor().Digest {
+			t.Errorf("digest mismatch, expected %s, received %s", mSrc.GetDescriptor().Digest, mTgt.GetDescriptor().Digest)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		rTgt, err := ref.New("ocidir://testcancel:v3")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		cCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		err = rc.ImageCopy(cCtx, rSrc, rTgt, ImageWithConcurrency(4))
+		if err == nil {
+			t.Errorf("copy with a canceled context did not fail")
+		} else if !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error, expected %v, received %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestImagePlatformsIndex(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rTgt, err := ref.New("ocidir://testplat:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	mSrc, err := rc.ManifestHead(ctx, rSrc)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	var tgtDigest string
+	t.Run("copy", func(t *testing.T) {
+		err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithPlatforms([]string{"linux/amd64"}), ImageWithPlatformsIndex())
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		m, err := rc.ManifestGet(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("failed to get target: %v", err)
+		}
+		tgtDigest = m.GetDescriptor().Digest.String()
+		dl, err := m.(manifest.Indexer).GetManifestList()
+		if err != nil {
+			t.Fatalf("failed to get manifest list: %v", err)
+		}
+		if len(dl) != 1 || dl[0].Platform == nil || dl[0].Platform.Architecture != "amd64" {
+			t.Errorf("unexpected manifest list: %v", dl)
+		}
+		annot, err := m.(manifest.Annotator).GetAnnotations()
+		if err != nil {
+			t.Fatalf("failed to get annotations: %v", err)
+		}
+		if annot[AnnotationSourceDigest] != mSrc.GetDescriptor().Digest.String() {
+			t.Errorf("unexpected source digest annotation: %v", annot)
+		}
+		for _, d := range dl {
+			rChild := rTgt
+			rChild.Tag = ""
+			rChild.Digest = d.Digest.String()
+			if _, err := rc.ManifestHead(ctx, rChild); err != nil {
+				t.Errorf("child manifest missing: %s", d.Digest.String())
+			}
+		}
+	})
+	t.Run("copy again", func(t *testing.T) {
+		err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithPlatforms([]string{"linux/amd64"}), ImageWithPlatformsIndex())
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		m, err := rc.ManifestHead(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("failed to head target: %v", err)
+		}
+		if m.GetDescriptor().Digest.String() != tgtDigest {
+			t.Errorf("rewritten index changed, expected %s, received %s", tgtDigest, m.GetDescriptor().Digest.String())
+		}
+	})
+	t.Run("no match", func(t *testing.T) {
+		rTgt.Tag = "none"
+		err = rc.ImageCopy(ctx, rSrc, rTgt, ImageWithPlatforms([]string{"windows/amd64"}), ImageWithPlatformsIndex())
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+// Package blobcache stores verified blobs by digest on a local filesystem
+package blobcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	// crypto libraries included for go-digest
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/sirupsen/logrus"
+)
+
+// tmpMaxAge is the age of a temp file removed when the cache is opened,
+// newer files may be in use by another process sharing the cache directory
+const tmpMaxAge = 24 * time.Hour
+
+// Cache is a content addressable store of blobs with LRU eviction
+type Cache struct {
+	fs      rwfs.RWFS
+	dir     string
+	maxSize int64
+	log     *logrus.Logger
+	mu      sync.Mutex
+	size    int64
+	entries map[digest.Digest]*entry
+}
+
+type entry struct {
+	size    int64
+	lastUse time.Time
+	refs    int
+}
+
+// Opts configures the cache
+type Opts func(*Cache)
+
+// WithLog sets the logger
+func WithLog(log *logrus.Logger) Opts {
+	return func(c *Cache) {
+		c.log = log
+	}
+}
+
+// New returns a cache in dir, loading any existing blobs.
+// A maxSize <= 0 disables eviction.
+func New(fsys rwfs.RWFS, dir string, maxSize int64, opts ...Opts) (*Cache, error) {
+	c := &Cache{
+		fs:      fsys,
+		dir:     dir,
+		maxSize: maxSize,
+		log:     &logrus.Logger{Out: io.Discard},
+		entries: map[digest.Digest]*entry{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	err := rwfs.MkdirAll(c.fs, path.Join(c.dir, "tmp"), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob cache %s: %w", dir, err)
+	}
+	// remove old temp files from an interrupted process
+	tmpList, err := fs.ReadDir(c.fs, path.Join(c.dir, "tmp"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob cache %s: %w", dir, err)
+	}
+	for _, tmp := range tmpList {
+		fi, err := tmp.Info()
+		if err != nil || time.Since(fi.ModTime()) < tmpMaxAge {
+			continue
+		}
+		_ = c.fs.Remove(path.Join(c.dir, "tmp", tmp.Name()))
+	}
+	// load existing blobs
+	algList, err := fs.ReadDir(c.fs, path.Join(c.dir, "blobs"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read blob cache %s: %w", dir, err)
+	}
+	for _, alg := range algList {
+		if !alg.IsDir() {
+			continue
+		}
+		blobList, err := fs.ReadDir(c.fs, path.Join(c.dir, "blobs", alg.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob cache %s: %w", dir, err)
+		}
+		for _, b := range blobList {
+			d := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), b.Name())
+			fi, err := b.Info()
+			if err != nil || d.Validate() != nil || fi.IsDir() {
+				continue
+			}
+			c.entries[d] = &entry{size: fi.Size(), lastUse: fi.ModTime()}
+			c.size += fi.Size()
+		}
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Get returns a reader for a cached blob and the size, types.ErrNotFound is returned on a cache miss
+func (c *Cache) Get(d digest.Digest) (io.ReadCloser, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[d]
+	if !ok {
+		return nil, 0, types.ErrNotFound
+	}
+	fh, err := c.fs.Open(c.file(d))
+	if err != nil {
+		// file was removed outside of the cache
+		c.size -= e.size
+		delete(c.entries, d)
+		return nil, 0, types.ErrNotFound
+	}
+	e.refs++
+	e.lastUse = time.Now()
+	return &cacheReader{c: c, d: d, f: fh}, e.size, nil
+}
+
+// Tee returns a reader that saves the content of rdr to the cache.
+// The blob is only added after a full read with a matching digest.
+func (c *Cache) Tee(d digest.Digest, rdr io.ReadCloser) io.ReadCloser {
+	if d.Validate() != nil {
+		return rdr
+	}
+	err := rwfs.MkdirAll(c.fs, path.Join(c.dir, "tmp"), 0700)
+	if err != nil {
+		return rdr
+	}
+	tmp, err := rwfs.CreateTemp(c.fs, path.Join(c.dir, "tmp"), "blob-*")
+	if err != nil {
+		c.log.WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Failed to create blob cache file")
+		return rdr
+	}
+	tmpName, err := tmpFileName(tmp)
+	if err != nil {
+		_ = tmp.Close()
+		return rdr
+	}
+	return &cacheWriter{
+		c:        c,
+		d:        d,
+		rdr:      rdr,
+		tmp:      tmp,
+		tmpName:  path.Join(c.dir, "tmp", tmpName),
+		digester: d.Algorithm().Digester(),
+	}
+}
+
+// commit moves a verified temp file into the cache
+func (c *Cache) commit(d digest.Digest, tmpName string, size int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[d]; ok || (c.maxSize > 0 && size > c.maxSize) {
+		return c.fs.Remove(tmpName)
+	}
+	err := rwfs.MkdirAll(c.fs, path.Join(c.dir, "blobs", d.Algorithm().String()), 0700)
+	if err != nil {
+		_ = c.fs.Remove(tmpName)
+		return err
+	}
+	err = c.fs.Rename(tmpName, c.file(d))
+	if err != nil {
+		_ = c.fs.Remove(tmpName)
+		return err
+	}
+	c.entries[d] = &entry{size: size, lastUse: time.Now()}
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used blobs that are not open until the cache is below the max size.
+// c.mu must be held.
+func (c *Cache) evict() {
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+	dl := make([]digest.Digest, 0, len(c.entries))
+	for d := range c.entries {
+		dl = append(dl, d)
+	}
+	sort.Slice(dl, func(i, j int) bool {
+		return c.entries[dl[i]].lastUse.Before(c.entries[dl[j]].lastUse)
+	})
+	for _, d := range dl {
+		if c.size <= c.maxSize {
+			return
+		}
+		e := c.entries[d]
+		if e.refs > 0 {
+			continue
+		}
+		err := c.fs.Remove(c.file(d))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.log.WithFields(logrus.Fields{
+				"digest": d.String(),
+				"err":    err,
+			}).Warn("Failed to remove blob from cache")
+			continue
+		}
+		c.size -= e.size
+		delete(c.entries, d)
+	}
+}
+
+func (c *Cache) release(d digest.Digest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[d]; ok && e.refs > 0 {
+		e.refs--
+	}
+	c.evict()
+}
+
+func (c *Cache) file(d digest.Digest) string {
+	return path.Join(c.dir, "blobs", d.Algorithm().String(), d.Encoded())
+}
+
+func tmpFileName(f rwfs.RWFile) (string, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return fi.Name(), nil
+}
+
+type cacheReader struct {
+	c      *Cache
+	d      digest.Digest
+	f      fs.File
+	closed bool
+}
+
+func (cr *cacheReader) Read(p []byte) (int, error) {
+	return cr.f.Read(p)
+}
+
+func (cr *cacheReader) Close() error {
+	if cr.closed {
+		return nil
+	}
+	cr.closed = true
+	err := cr.f.Close()
+	cr.c.release(cr.d)
+	return err
+}
+
+type cacheWriter struct {
+	c        *Cache
+	d        digest.Digest
+	rdr      io.ReadCloser
+	tmp      rwfs.RWFile
+	tmpName  string
+	digester digest.Digester
+	size     int64
+	done     bool
+}
+
+func (cw *cacheWriter) Read(p []byte) (int, error) {
+	n, err := cw.rdr.Read(p)
+	if n > 0 && !cw.done {
+		_, _ = cw.digester.Hash().Write(p[:n])
+		if _, errW := cw.tmp.Write(p[:n]); errW != nil {
+			cw.c.log.WithFields(logrus.Fields{
+				"err": errW,
+			}).Warn("Failed to write blob cache file")
+			cw.discard()
+		}
+		cw.size += int64(n)
+	}
+	if err == io.EOF && !cw.done {
+		cw.done = true
+		errC := cw.tmp.Close()
+		if errC != nil || cw.digester.Digest() != cw.d {
+			_ = cw.c.fs.Remove(cw.tmpName)
+		} else if errC = cw.c.commit(cw.d, cw.tmpName, cw.size); errC != nil {
+			cw.c.log.WithFields(logrus.Fields{
+				"digest": cw.d.String(),
+				"err":    errC,
+			}).Warn("Failed to add blob to cache")
+		}
+	}
+	return n, err
+}
+
+func (cw *cacheWriter) Close() error {
+	cw.discard()
+	return cw.rdr.Close()
+}
+
+// discard removes an incomplete temp file
+func (cw *cacheWriter) discard() {
+	if cw.done {
+		return
+	}
+	cw.done = true
+	_ = cw.tmp.Close()
+	_ = cw.c.fs.Remove(cw.tmpName)
+}
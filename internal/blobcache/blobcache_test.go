@@ -0,0 +1,150 @@
+package blobcache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+)
+
+func TestCache(t *testing.T) {
+	blobA := bytes.Repeat([]byte("a"), 100)
+	blobB := bytes.Repeat([]byte("b"), 100)
+	blobC := bytes.Repeat([]byte("c"), 100)
+	dA := digest.FromBytes(blobA)
+	dB := digest.FromBytes(blobB)
+	dC := digest.FromBytes(blobC)
+	fsMem := rwfs.MemNew()
+	c, err := New(fsMem, "cache", 250)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	add := func(t *testing.T, d digest.Digest, b []byte) {
+		t.Helper()
+		rdr := c.Tee(d, io.NopCloser(bytes.NewReader(b)))
+		_, err := io.ReadAll(rdr)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		err = rdr.Close()
+		if err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+	}
+	get := func(t *testing.T, d digest.Digest, expect []byte) {
+		t.Helper()
+		rdr, size, err := c.Get(d)
+		if expect == nil {
+			if !errors.Is(err, types.ErrNotFound) {
+				t.Errorf("expected not found for %s, received %v", d, err)
+			}
+			if err == nil {
+				rdr.Close()
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("failed to get %s: %v", d, err)
+		}
+		defer rdr.Close()
+		if size != int64(len(expect)) {
+			t.Errorf("size mismatch, expected %d, received %d", len(expect), size)
+		}
+		b, err := io.ReadAll(rdr)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if !bytes.Equal(b, expect) {
+			t.Errorf("content mismatch for %s", d)
+		}
+	}
+
+	t.Run("miss", func(t *testing.T) {
+		get(t, dA, nil)
+	})
+	t.Run("add", func(t *testing.T) {
+		add(t, dA, blobA)
+		get(t, dA, blobA)
+	})
+	t.Run("digest mismatch", func(t *testing.T) {
+		add(t, dB, blobC)
+		get(t, dB, nil)
+	})
+	t.Run("partial read", func(t *testing.T) {
+		rdr := c.Tee(dB, io.NopCloser(bytes.NewReader(blobB)))
+		_, err := rdr.Read(make([]byte, 10))
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		rdr.Close()
+		get(t, dB, nil)
+	})
+	t.Run("evict", func(t *testing.T) {
+		add(t, dB, blobB)
+		// use A so B is the least recently used
+		get(t, dA, blobA)
+		add(t, dC, blobC)
+		get(t, dA, blobA)
+		get(t, dB, nil)
+		get(t, dC, blobC)
+	})
+	t.Run("open blobs are not evicted", func(t *testing.T) {
+		rdr, _, err := c.Get(dA)
+		if err != nil {
+			t.Fatalf("failed to get: %v", err)
+		}
+		get(t, dC, blobC)
+		add(t, dB, blobB)
+		get(t, dC, nil)
+		rdr.Close()
+		get(t, dA, blobA)
+		get(t, dB, blobB)
+	})
+	t.Run("reload", func(t *testing.T) {
+		c, err = New(fsMem, "cache", 250)
+		if err != nil {
+			t.Fatalf("failed to create cache: %v", err)
+		}
+		get(t, dA, blobA)
+		get(t, dB, blobB)
+	})
+}
+
+func TestCacheTmp(t *testing.T) {
+	tempDir := t.TempDir()
+	fsOS := rwfs.OSNew(tempDir)
+	err := os.MkdirAll(filepath.Join(tempDir, "cache", "tmp"), 0700)
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	for _, name := range []string{"blob-old", "blob-new"} {
+		err = os.WriteFile(filepath.Join(tempDir, "cache", "tmp", name), []byte("partial"), 0600)
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	old := time.Now().Add(-2 * tmpMaxAge)
+	err = os.Chtimes(filepath.Join(tempDir, "cache", "tmp", "blob-old"), old, old)
+	if err != nil {
+		t.Fatalf("failed to set time: %v", err)
+	}
+	_, err = New(fsOS, "cache", 0)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "cache", "tmp", "blob-old")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("old temp file was not removed: %v", err)
+	}
+	// a recent file may be in use by another process
+	if _, err := os.Stat(filepath.Join(tempDir, "cache", "tmp", "blob-new")); err != nil {
+		t.Errorf("new temp file was removed: %v", err)
+	}
+}
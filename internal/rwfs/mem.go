@@ -7,6 +7,7 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +17,7 @@ import (
 type MemFS struct {
 	base string
 	root *MemDir
+	mu   *sync.RWMutex // shared with any Sub filesystems
 }
 
 type MemChild interface{}
@@ -33,6 +35,7 @@ type MemDirFP struct {
 	closed bool
 	name   string
 	flags  int
+	mu     *sync.RWMutex
 }
 type MemFileFP struct {
 	f      *MemFile
@@ -40,6 +43,7 @@ type MemFileFP struct {
 	closed bool
 	name   string
 	flags  int
+	mu     *sync.RWMutex
 }
 
 func MemNew() *MemFS {
@@ -48,6 +52,7 @@ func MemNew() *MemFS {
 		root: &MemDir{
 			child: map[string]MemChild{},
 		},
+		mu: &sync.RWMutex{},
 	}
 }
 
@@ -59,6 +64,8 @@ func (o *MemFS) Mkdir(name string, perm fs.FileMode) error {
 	if name == "." {
 		return fs.ErrExist
 	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	dir, base := path.Split(name)
 	memDir, err := o.getDir(dir)
 	if err != nil {
@@ -81,6 +88,8 @@ func (o *MemFS) Mkdir(name string, perm fs.FileMode) error {
 }
 
 func (o *MemFS) OpenFile(name string, flags int, perm fs.FileMode) (RWFile, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	dir, file := path.Split(name)
 	memDir, err := o.getDir(dir)
 	if err != nil {
@@ -106,7 +115,7 @@ func (o *MemFS) OpenFile(name string, flags int, perm fs.FileMode) (RWFile, erro
 					Err:  fs.ErrExist,
 				}
 			}
-			fp := MemFileFP{f: v, name: file, flags: flags}
+			fp := MemFileFP{f: v, name: file, flags: flags, mu: o.mu}
 			if flagSet(O_TRUNC, flags) {
 				fp.f.b = []byte{}
 				fp.f.mod = time.Now()
@@ -123,7 +132,7 @@ func (o *MemFS) OpenFile(name string, flags int, perm fs.FileMode) (RWFile, erro
 					Err:  fs.ErrExist,
 				}
 			}
-			return &MemDirFP{f: v, name: file, flags: flags}, nil
+			return &MemDirFP{f: v, name: file, flags: flags, mu: o.mu}, nil
 		default:
 			return nil, &fs.PathError{
 				Op:   "open",
@@ -143,7 +152,7 @@ func (o *MemFS) OpenFile(name string, flags int, perm fs.FileMode) (RWFile, erro
 		memFile := MemFile{mod: time.Now()}
 		memDir.child[file] = &memFile
 		memDir.mod = time.Now()
-		return &MemFileFP{f: &memFile, name: file, flags: flags}, nil
+		return &MemFileFP{f: &memFile, name: file, flags: flags, mu: o.mu}, nil
 	}
 }
 
@@ -159,6 +168,8 @@ func (o *MemFS) Remove(name string) error {
 			Err:  fs.ErrInvalid,
 		}
 	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	dir, file := path.Split(name)
 	memDir, err := o.getDir(dir)
 	if err != nil {
@@ -203,6 +214,8 @@ func (o *MemFS) Remove(name string) error {
 
 // Rename moves a file or directory to a new name
 func (o *MemFS) Rename(oldName, newName string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	dirOld, fileOld := path.Split(oldName)
 	memDirOld, err := o.getDir(dirOld)
 	if err != nil {
@@ -307,6 +320,8 @@ func (o *MemFS) Sub(name string) (*MemFS, error) {
 	if err != nil {
 		return nil, err
 	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 	subRoot, err := o.getDir(name)
 	if err != nil {
 		return nil, err
@@ -314,6 +329,7 @@ func (o *MemFS) Sub(name string) (*MemFS, error) {
 	return &MemFS{
 		base: full,
 		root: subRoot,
+		mu:   o.mu,
 	}, nil
 }
 
@@ -357,6 +373,8 @@ func (mfp *MemFileFP) Close() error {
 }
 
 func (mfp *MemFileFP) Read(b []byte) (int, error) {
+	mfp.mu.RLock()
+	defer mfp.mu.RUnlock()
 	lc := copy(b, mfp.f.b[mfp.cur:])
 	mfp.cur += lc
 	if len(mfp.f.b) <= mfp.cur {
@@ -366,6 +384,8 @@ func (mfp *MemFileFP) Read(b []byte) (int, error) {
 }
 
 func (mfp *MemFileFP) Stat() (fs.FileInfo, error) {
+	mfp.mu.RLock()
+	defer mfp.mu.RUnlock()
 	fi := NewFI(mfp.name, int64(len(mfp.f.b)), time.Time{}, 0)
 	return fi, nil
 }
@@ -374,6 +394,8 @@ func (mfp *MemFileFP) Write(b []byte) (n int, err error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	mfp.mu.Lock()
+	defer mfp.mu.Unlock()
 	// use copy to overwrite existing contents
 	if mfp.cur < len(mfp.f.b) {
 		l := copy(mfp.f.b[mfp.cur:], b)
@@ -404,6 +426,8 @@ func (mdp *MemDirFP) Read(b []byte) (int, error) {
 // TODO: implement func (mdp *MemDirFP) Seek
 
 func (mdp *MemDirFP) ReadDir(n int) ([]fs.DirEntry, error) {
+	mdp.mu.RLock()
+	defer mdp.mu.RUnlock()
 	names := mdp.filenames(mdp.cur, n)
 	mdp.cur += len(names)
 	des := make([]fs.DirEntry, len(names))
@@ -439,6 +463,8 @@ func (mdp *MemDirFP) ReadDir(n int) ([]fs.DirEntry, error) {
 }
 
 func (mdp *MemDirFP) Stat() (fs.FileInfo, error) {
+	mdp.mu.RLock()
+	defer mdp.mu.RUnlock()
 	fi := NewFI(mdp.name, 4096, mdp.f.mod, fs.ModeDir)
 	return fi, nil
 }
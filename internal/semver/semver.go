@@ -0,0 +1,257 @@
+// Package semver parses version tags and compares them against constraints
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidVersion is returned when a string is not a semantic version
+	ErrInvalidVersion = errors.New("invalid version")
+	// ErrInvalidConstraint is returned when a constraint cannot be parsed
+	ErrInvalidConstraint = errors.New("invalid constraint")
+)
+
+// Version is a parsed semantic version
+type Version struct {
+	Major, Minor, Patch uint64
+	Pre                 string
+	Build               string
+	// parts is the number of numeric fields in the original string
+	parts int
+}
+
+// Parse converts a string to a Version.
+// A leading "v" is accepted, and the minor and patch values may be omitted (e.g. "v1.20").
+func Parse(s string) (Version, error) {
+	v := Version{}
+	in := strings.TrimPrefix(s, "v")
+	if i := strings.Index(in, "+"); i >= 0 {
+		v.Build = in[i+1:]
+		in = in[:i]
+	}
+	if i := strings.Index(in, "-"); i >= 0 {
+		v.Pre = in[i+1:]
+		in = in[:i]
+		if v.Pre == "" {
+			return v, fmt.Errorf("%s: %w", s, ErrInvalidVersion)
+		}
+	}
+	fields := strings.Split(in, ".")
+	if len(fields) > 3 {
+		return v, fmt.Errorf("%s: %w", s, ErrInvalidVersion)
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, f := range fields {
+		if f == "" || (len(f) > 1 && f[0] == '0') {
+			return v, fmt.Errorf("%s: %w", s, ErrInvalidVersion)
+		}
+		n, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("%s: %w", s, ErrInvalidVersion)
+		}
+		*nums[i] = n
+	}
+	v.parts = len(fields)
+	return v, nil
+}
+
+// String returns the version without any leading "v"
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0, or 1 when v is less than, equal to, or greater than o.
+// Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	if c := cmpUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := cmpUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := cmpUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+func cmpUint(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// comparePre orders prerelease strings, a version without a prerelease is greater
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	} else if a == "" {
+		return 1
+	} else if b == "" {
+		return -1
+	}
+	aFields := strings.Split(a, ".")
+	bFields := strings.Split(b, ".")
+	for i := 0; i < len(aFields) && i < len(bFields); i++ {
+		aNum, aErr := strconv.ParseUint(aFields[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bFields[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := cmpUint(aNum, bNum); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			// numeric identifiers are lower than alphanumeric
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aFields[i], bFields[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmpUint(uint64(len(aFields)), uint64(len(bFields)))
+}
+
+// Constraint is a parsed set of version comparisons
+type Constraint struct {
+	// or is a list of alternatives, each containing comparisons that must all match
+	or [][]comparison
+	s  string
+}
+
+type comparison struct {
+	op string
+	v  Version
+}
+
+// ParseConstraint parses a constraint string.
+// Comparisons separated by spaces or commas must all match, and "||" separates alternatives.
+// Supported operators are "=", "!=", ">", ">=", "<", "<=", "~" (patch updates), and "^" (minor updates).
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{s: s}
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' })
+		if len(fields) == 0 {
+			return c, fmt.Errorf("%s: %w", s, ErrInvalidConstraint)
+		}
+		// allow a space between the operator and version, e.g. ">= 1.2"
+		joined := []string{}
+		for i := 0; i < len(fields); i++ {
+			if strings.TrimLeft(fields[i], "=!<>~^") == "" && i+1 < len(fields) {
+				joined = append(joined, fields[i]+fields[i+1])
+				i++
+			} else {
+				joined = append(joined, fields[i])
+			}
+		}
+		cmps := []comparison{}
+		for _, f := range joined {
+			op := f[:len(f)-len(strings.TrimLeft(f, "=!<>~^"))]
+			switch op {
+			case "", "=", "!=", ">", ">=", "<", "<=", "~", "^":
+			default:
+				return c, fmt.Errorf("%s: unknown operator %s: %w", s, op, ErrInvalidConstraint)
+			}
+			v, err := Parse(f[len(op):])
+			if err != nil {
+				return c, fmt.Errorf("%s: %w", s, ErrInvalidConstraint)
+			}
+			cmps = append(cmps, comparison{op: op, v: v})
+		}
+		c.or = append(c.or, cmps)
+	}
+	return c, nil
+}
+
+// String returns the original constraint
+func (c Constraint) String() string {
+	return c.s
+}
+
+// Check returns true if the version matches the constraint
+func (c Constraint) Check(v Version) bool {
+	for _, cmps := range c.or {
+		match := true
+		for _, cmp := range cmps {
+			if !cmp.check(v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp comparison) check(v Version) bool {
+	switch cmp.op {
+	case "", "=":
+		// "=1.2" matches any 1.2.x release
+		return v.Compare(cmp.v) >= 0 && v.Compare(cmp.v.next(cmp.v.parts)) < 0
+	case "!=":
+		return !(v.Compare(cmp.v) >= 0 && v.Compare(cmp.v.next(cmp.v.parts)) < 0)
+	case ">":
+		return v.Compare(cmp.v.next(cmp.v.parts)) >= 0
+	case ">=":
+		return v.Compare(cmp.v) >= 0
+	case "<":
+		return v.Compare(cmp.v) < 0
+	case "<=":
+		return v.Compare(cmp.v.next(cmp.v.parts)) < 0
+	case "~":
+		parts := 2
+		if cmp.v.parts == 1 {
+			parts = 1
+		}
+		return v.Compare(cmp.v) >= 0 && v.Compare(cmp.v.next(parts)) < 0
+	case "^":
+		parts := 1
+		if cmp.v.Major == 0 && cmp.v.parts > 1 {
+			parts = 2
+			if cmp.v.Minor == 0 && cmp.v.parts > 2 {
+				parts = 3
+			}
+		}
+		return v.Compare(cmp.v) >= 0 && v.Compare(cmp.v.next(parts)) < 0
+	}
+	return false
+}
+
+// next returns the lowest version above every version matching the first parts fields,
+// e.g. 1.2 with 2 parts returns 1.3.0-0
+func (v Version) next(parts int) Version {
+	n := Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, parts: 3}
+	switch parts {
+	case 1:
+		n.Major, n.Minor, n.Patch = v.Major+1, 0, 0
+	case 2:
+		n.Minor, n.Patch = v.Minor+1, 0
+	default:
+		if v.Pre != "" {
+			// an exact prerelease only matches itself
+			n.Pre = v.Pre + ".0"
+			return n
+		}
+		n.Patch = v.Patch + 1
+	}
+	n.Pre = "0"
+	return n
+}
@@ -0,0 +1,160 @@
+package semver
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect string
+		expErr error
+	}{
+		{in: "1.2.3", expect: "1.2.3"},
+		{in: "v1.20", expect: "1.20.0"},
+		{in: "2", expect: "2.0.0"},
+		{in: "1.2.3-rc.1+build.5", expect: "1.2.3-rc.1+build.5"},
+		{in: "latest", expErr: ErrInvalidVersion},
+		{in: "1.2.3.4", expErr: ErrInvalidVersion},
+		{in: "01.2", expErr: ErrInvalidVersion},
+		{in: "1.2-", expErr: ErrInvalidVersion},
+		{in: "1..2", expErr: ErrInvalidVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := Parse(tt.in)
+			if tt.expErr != nil {
+				if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if v.String() != tt.expect {
+				t.Errorf("unexpected version, expected %s, received %s", tt.expect, v.String())
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{a: "1.2.3", b: "1.2.3", expect: 0},
+		{a: "1.2.3", b: "1.10.0", expect: -1},
+		{a: "2.0.0", b: "1.99.99", expect: 1},
+		{a: "1.0.0-rc.1", b: "1.0.0", expect: -1},
+		{a: "1.0.0-rc.2", b: "1.0.0-rc.10", expect: -1},
+		{a: "1.0.0-1", b: "1.0.0-alpha", expect: -1},
+		{a: "1.0.0-alpha.1", b: "1.0.0-alpha", expect: 1},
+		{a: "1.0.0+a", b: "1.0.0+b", expect: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			a, _ := Parse(tt.a)
+			b, _ := Parse(tt.b)
+			if c := a.Compare(b); c != tt.expect {
+				t.Errorf("unexpected result, expected %d, received %d", tt.expect, c)
+			}
+		})
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		nomatch    []string
+		expErr     error
+	}{
+		{
+			constraint: ">=1.20 <2",
+			match:      []string{"1.20.0", "v1.20", "1.25.3"},
+			nomatch:    []string{"1.19.9", "2.0.0", "2.1"},
+		},
+		{
+			constraint: ">= 1.2, < 1.4",
+			match:      []string{"1.2.0", "1.3.9"},
+			nomatch:    []string{"1.4.0", "1.1"},
+		},
+		{
+			constraint: "1.2",
+			match:      []string{"1.2.0", "1.2.9"},
+			nomatch:    []string{"1.3.0", "1.1.9"},
+		},
+		{
+			constraint: ">1.2 <=1.4",
+			match:      []string{"1.3.0", "1.4.7"},
+			nomatch:    []string{"1.2.5", "1.5.0"},
+		},
+		{
+			constraint: "~1.2.3",
+			match:      []string{"1.2.3", "1.2.10"},
+			nomatch:    []string{"1.3.0", "1.2.2"},
+		},
+		{
+			constraint: "^1.2",
+			match:      []string{"1.2.0", "1.9.0"},
+			nomatch:    []string{"2.0.0", "1.1.0"},
+		},
+		{
+			constraint: "^0.2.3",
+			match:      []string{"0.2.3", "0.2.9"},
+			nomatch:    []string{"0.3.0"},
+		},
+		{
+			constraint: "1.x",
+			expErr:     ErrInvalidConstraint,
+		},
+		{
+			constraint: "<1 || >=3 !=3.1",
+			match:      []string{"0.9.0", "3.0.0", "3.2.0"},
+			nomatch:    []string{"1.0.0", "2.5.0", "3.1.4"},
+		},
+		{
+			constraint: "=>1",
+			expErr:     ErrInvalidConstraint,
+		},
+		{
+			constraint: " || ",
+			expErr:     ErrInvalidConstraint,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if tt.expErr != nil {
+				if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			for _, s := range tt.match {
+				v, err := Parse(s)
+				if err != nil {
+					t.Fatalf("failed to parse %s: %v", s, err)
+				}
+				if !c.Check(v) {
+					t.Errorf("version %s did not match", s)
+				}
+			}
+			for _, s := range tt.nomatch {
+				v, err := Parse(s)
+				if err != nil {
+					t.Fatalf("failed to parse %s: %v", s, err)
+				}
+				if c.Check(v) {
+					t.Errorf("version %s matched", s)
+				}
+			}
+		})
+	}
+}
@@ -11,10 +11,99 @@ import (
 	"strings"
 	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/types/ref"
 )
 
+// WithLayerCompression alters the compression of each layer, updating the media type and config diff_ids
+func WithLayerCompression(ct archive.CompressType) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsLayer = append(dc.stepsLayer, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, rdr io.ReadCloser) (io.ReadCloser, error) {
+			d := dl.desc
+			if dl.mod == replaced && dl.newDesc.Digest != "" {
+				d = dl.newDesc
+			}
+			if !layerMediaTypeKnown(d.MediaType) || layerCompression(d.MediaType) == ct {
+				return rdr, nil
+			}
+			mt, err := layerMediaType(d.MediaType, ct)
+			if err != nil {
+				return rdr, err
+			}
+			defer rdr.Close()
+			dr, err := archive.Decompress(rdr)
+			if err != nil {
+				return nil, err
+			}
+			// write the recompressed layer to a temp file, tracking both digests
+			fh, err := os.CreateTemp("", "regclient-mod-")
+			if err != nil {
+				return nil, err
+			}
+			tf := &tempFile{File: fh}
+			success := false
+			defer func() {
+				if !success {
+					tf.Close()
+				}
+			}()
+			digRaw := digest.Canonical.Digester()
+			digUC := digest.Canonical.Digester()
+			cw, err := archive.CompressWriter(io.MultiWriter(fh, digRaw.Hash()), ct)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(io.MultiWriter(cw, digUC.Hash()), dr)
+			if err != nil {
+				cw.Close()
+				return nil, err
+			}
+			err = cw.Close()
+			if err != nil {
+				return nil, err
+			}
+			l, err := fh.Seek(0, 1)
+			if err != nil {
+				return nil, err
+			}
+			_, err = fh.Seek(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			dl.newDesc = d
+			dl.newDesc.MediaType = mt
+			dl.newDesc.Digest = digRaw.Digest()
+			dl.newDesc.Size = l
+			dl.ucDigest = digUC.Digest()
+			_, err = rc.BlobPut(c, r, dl.newDesc, fh)
+			if err != nil {
+				return nil, err
+			}
+			dl.mod = replaced
+			// the recompressed content is passed to any following steps
+			_, err = fh.Seek(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			success = true
+			return tf, nil
+		})
+	}
+}
+
+// tempFile removes the temp file when closed
+type tempFile struct {
+	*os.File
+}
+
+func (tf *tempFile) Close() error {
+	err := tf.File.Close()
+	os.Remove(tf.File.Name())
+	return err
+}
+
 // WithLayerRmCreatedBy deletes a layer based on a regex of the created by field
 // in the config history for that layer
 func WithLayerRmCreatedBy(re regexp.Regexp) Opts {
@@ -3,8 +3,8 @@ package mod
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"os"
 
@@ -32,7 +32,7 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 	dc := dagConfig{
 		stepsManifest:  []func(context.Context, *regclient.RegClient, ref.Ref, *dagManifest) error{},
 		stepsOCIConfig: []func(context.Context, *regclient.RegClient, ref.Ref, *dagOCIConfig) error{},
-		stepsLayer:     []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer) error{},
+		stepsLayer:     []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, io.ReadCloser) (io.ReadCloser, error){},
 		stepsLayerFile: []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, io.Reader) (*tar.Header, io.Reader, changes, error){},
 		maxDataSize:    -1, // unchanged, if a data field exists, preserve it
 	}
@@ -86,9 +86,15 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 			if err != nil {
 				return nil, err
 			}
-			defer br.Close()
+			// each layer step receives the current layer content and returns the content for the next step
+			var rdr io.ReadCloser = br
+			defer func() {
+				if rdr != nil {
+					rdr.Close()
+				}
+			}()
 			for _, sl := range dc.stepsLayer {
-				err = sl(ctx, rc, r, dl)
+				rdr, err = sl(ctx, rc, r, dl, rdr)
 				if err != nil {
 					return nil, err
 				}
@@ -97,7 +103,7 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 				changed := false
 				empty := true
 				// setup tar reader to process layer
-				dr, err := archive.Decompress(br)
+				dr, err := archive.Decompress(rdr)
 				if err != nil {
 					return nil, err
 				}
@@ -111,14 +117,20 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 				defer os.Remove(fh.Name())
 				// create tar writer, optional recompress
 				var tw *tar.Writer
-				var gw *gzip.Writer
+				var cw io.WriteCloser
 				digRaw := digest.Canonical.Digester() // raw/compressed digest
 				digUC := digest.Canonical.Digester()  // uncompressed digest
-				if dl.desc.MediaType == types.MediaTypeDocker2LayerGzip || dl.desc.MediaType == types.MediaTypeOCI1LayerGzip {
-					cw := io.MultiWriter(fh, digRaw.Hash())
-					gw = gzip.NewWriter(cw)
-					defer gw.Close()
-					ucw := io.MultiWriter(gw, digUC.Hash())
+				mt := dl.desc.MediaType
+				if dl.mod == replaced && dl.newDesc.MediaType != "" {
+					mt = dl.newDesc.MediaType
+				}
+				if ct := layerCompression(mt); ct != archive.CompressNone {
+					cw, err = archive.CompressWriter(io.MultiWriter(fh, digRaw.Hash()), ct)
+					if err != nil {
+						return nil, err
+					}
+					defer cw.Close()
+					ucw := io.MultiWriter(cw, digUC.Hash())
 					tw = tar.NewWriter(ucw)
 				} else {
 					dw := io.MultiWriter(fh, digRaw.Hash(), digUC.Hash())
@@ -165,8 +177,8 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 						}
 					}
 				}
-				br.Close()
-				br = nil
+				rdr.Close()
+				rdr = nil
 				if empty || dl.mod == deleted {
 					dl.mod = deleted
 					return dl, nil
@@ -174,8 +186,8 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 				if changed {
 					// if modified, push blob
 					tw.Close()
-					if gw != nil {
-						gw.Close()
+					if cw != nil {
+						cw.Close()
 					}
 					// get the file size
 					l, err := fh.Seek(0, 1)
@@ -183,6 +195,7 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 						return nil, err
 					}
 					dl.newDesc = dl.desc
+					dl.newDesc.MediaType = mt
 					dl.newDesc.Digest = digRaw.Digest()
 					dl.newDesc.Size = l
 					dl.ucDigest = digUC.Digest()
@@ -215,6 +228,47 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 	return rMod, nil
 }
 
+// layerCompression returns the compression used by a layer media type
+func layerCompression(mt string) archive.CompressType {
+	switch mt {
+	case types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1LayerGzip,
+		types.MediaTypeDocker2ForeignLayer, types.MediaTypeOCI1ForeignLayerGzip:
+		return archive.CompressGzip
+	case types.MediaTypeOCI1LayerZstd, types.MediaTypeOCI1ForeignLayerZstd:
+		return archive.CompressZstd
+	}
+	return archive.CompressNone
+}
+
+// layerMediaTypeKnown returns true for tar layer media types that can be recompressed
+func layerMediaTypeKnown(mt string) bool {
+	switch mt {
+	case types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1Layer,
+		types.MediaTypeOCI1LayerGzip, types.MediaTypeOCI1LayerZstd:
+		return true
+	}
+	return false
+}
+
+// layerMediaType returns the layer media type for a compression, preserving the docker or OCI media type
+func layerMediaType(mt string, ct archive.CompressType) (string, error) {
+	if mt == types.MediaTypeDocker2LayerGzip {
+		if ct != archive.CompressGzip {
+			return "", fmt.Errorf("docker layers only support gzip compression, convert the image to OCI first: %s", ct.String())
+		}
+		return mt, nil
+	}
+	switch ct {
+	case archive.CompressNone:
+		return types.MediaTypeOCI1Layer, nil
+	case archive.CompressGzip:
+		return types.MediaTypeOCI1LayerGzip, nil
+	case archive.CompressZstd:
+		return types.MediaTypeOCI1LayerZstd, nil
+	}
+	return "", fmt.Errorf("unsupported layer compression: %s", ct.String())
+}
+
 // WithData sets the descriptor data field max size.
 // This also strips the data field off descriptors above the max size.
 func WithData(maxDataSize int64) Opts {
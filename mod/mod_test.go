@@ -11,6 +11,8 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
@@ -208,6 +210,37 @@ func TestMod(t *testing.T) {
 			},
 			ref: "ocidir://testrepo:v3",
 		},
+		{
+			name: "Layer Compression zstd",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressZstd),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Layer Compression none with Trim File",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressNone),
+				WithLayerStripFile("/layer2"),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Layer Compression gzip unchanged",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressGzip),
+			},
+			ref:      "ocidir://testrepo:v3",
+			wantSame: true,
+		},
+		{
+			name: "Layer Compression bzip2 unsupported",
+			opts: []Opts{
+				WithLayerCompression(archive.CompressBzip2),
+			},
+			ref:     "ocidir://testrepo:v3",
+			wantErr: fmt.Errorf("unsupported layer compression: bzip2"),
+		},
 		{
 			name: "Layer Remove by index from Index",
 			opts: []Opts{
@@ -326,3 +359,77 @@ func TestMod(t *testing.T) {
 		})
 	}
 }
+
+func TestLayerCompression(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rMod, err := Apply(ctx, rc, r, WithLayerCompression(archive.CompressZstd))
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	ml, err := rc.ManifestGet(ctx, rMod)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	dl, err := ml.(manifest.Indexer).GetManifestList()
+	if err != nil || len(dl) == 0 {
+		t.Fatalf("failed to get manifest list: %v", err)
+	}
+	for _, d := range dl {
+		rPlat := rMod
+		rPlat.Tag = ""
+		rPlat.Digest = d.Digest.String()
+		m, err := rc.ManifestGet(ctx, rPlat)
+		if err != nil {
+			t.Fatalf("failed to get manifest %s: %v", d.Digest, err)
+		}
+		mi := m.(manifest.Imager)
+		layers, err := mi.GetLayers()
+		if err != nil {
+			t.Fatalf("failed to get layers: %v", err)
+		}
+		cd, err := mi.GetConfig()
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		conf, err := rc.BlobGetOCIConfig(ctx, rPlat, cd)
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		diffIDs := conf.GetConfig().RootFS.DiffIDs
+		if len(diffIDs) != len(layers) {
+			t.Fatalf("diff ids length mismatch, expected %d, received %d", len(layers), len(diffIDs))
+		}
+		for i, l := range layers {
+			if l.MediaType != types.MediaTypeOCI1LayerZstd {
+				t.Errorf("unexpected media type for layer %d: %s", i, l.MediaType)
+			}
+			br, err := rc.BlobGet(ctx, rPlat, l)
+			if err != nil {
+				t.Fatalf("failed to get layer %d: %v", i, err)
+			}
+			dr, err := archive.Decompress(br)
+			if err != nil {
+				t.Fatalf("failed to decompress layer %d: %v", i, err)
+			}
+			dig, err := digest.Canonical.FromReader(dr)
+			br.Close()
+			if err != nil {
+				t.Fatalf("failed to read layer %d: %v", i, err)
+			}
+			if dig != diffIDs[i] {
+				t.Errorf("diff id mismatch for layer %d, expected %s, received %s", i, dig, diffIDs[i])
+			}
+		}
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 // CompressType identifies the detected compression type
@@ -20,6 +24,8 @@ const (
 	CompressGzip
 	// CompressXz compression
 	CompressXz
+	// CompressZstd compression
+	CompressZstd
 )
 
 // compressHeaders are used to detect the compression type
@@ -27,43 +33,72 @@ var compressHeaders = map[CompressType][]byte{
 	CompressBzip2: []byte("\x42\x5A\x68"),
 	CompressGzip:  []byte("\x1F\x8B\x08"),
 	CompressXz:    []byte("\xFD\x37\x7A\x58\x5A\x00"),
+	CompressZstd:  []byte("\x28\xB5\x2F\xFD"),
 }
 
+// Compress converts the reader to the requested compression type.
+// Input that is already compressed with a different algorithm is first decompressed.
 func Compress(r io.Reader, oComp CompressType) (io.Reader, error) {
 	br := bufio.NewReader(r)
 	head, err := br.Peek(10)
-	if err != nil {
+	if err != nil && !errors.Is(err, io.EOF) {
 		return br, err
 	}
 	rComp := DetectCompression(head)
 	if rComp == oComp {
 		return br, nil
 	}
+	// verify the output compression is supported before decompressing
 	switch oComp {
-	case CompressGzip:
-		switch rComp {
-		case CompressNone:
-			return compressGzip(br)
-		case CompressBzip2:
-			return compressGzip(bzip2.NewReader(br))
+	case CompressNone, CompressGzip, CompressXz, CompressZstd:
+	default:
+		return nil, ErrUnknownType
+	}
+	var ucr io.Reader = br
+	if rComp != CompressNone {
+		ucr, err = decompressType(br, rComp)
+		if err != nil {
+			return nil, err
 		}
 	}
-	// No other types currently supported
-	return nil, ErrUnknownType
-}
-
-func compressGzip(src io.Reader) (io.Reader, error) {
+	if oComp == CompressNone {
+		return ucr, nil
+	}
 	pipeR, pipeW := io.Pipe()
 	go func() {
-		defer pipeW.Close()
-		gzipW := gzip.NewWriter(pipeW)
-		defer gzipW.Close()
-		_, _ = io.Copy(gzipW, src)
+		cw, err := CompressWriter(pipeW, oComp)
+		if err != nil {
+			pipeW.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(cw, ucr)
+		if err != nil {
+			cw.Close()
+			pipeW.CloseWithError(err)
+			return
+		}
+		pipeW.CloseWithError(cw.Close())
 	}()
 	return pipeR, nil
 }
 
-// Decompress extracts gzip and bzip streams
+// CompressWriter returns a writer that compresses content with the requested algorithm.
+// Close must be called on the returned writer to flush the compressed data, the underlying writer is not closed.
+func CompressWriter(w io.Writer, oComp CompressType) (io.WriteCloser, error) {
+	switch oComp {
+	case CompressNone:
+		return nopWriteCloser{Writer: w}, nil
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressXz:
+		return xz.NewWriter(w)
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, ErrUnknownType
+}
+
+// Decompress extracts bzip2, gzip, xz, and zstd streams
 func Decompress(r io.Reader) (io.Reader, error) {
 	// create bufio to peak on first few bytes
 	br := bufio.NewReader(r)
@@ -73,15 +108,25 @@ func Decompress(r io.Reader) (io.Reader, error) {
 	}
 
 	// compare peaked data against known compression types
-	switch DetectCompression(head) {
+	return decompressType(br, DetectCompression(head))
+}
+
+func decompressType(r io.Reader, ct CompressType) (io.Reader, error) {
+	switch ct {
 	case CompressBzip2:
-		return bzip2.NewReader(br), nil
+		return bzip2.NewReader(r), nil
 	case CompressGzip:
-		return gzip.NewReader(br)
+		return gzip.NewReader(r)
 	case CompressXz:
-		return br, ErrXzUnsupported
+		return xz.NewReader(r)
+	case CompressZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
 	default:
-		return br, nil
+		return r, nil
 	}
 }
 
@@ -95,6 +140,13 @@ func DetectCompression(head []byte) CompressType {
 	return CompressNone
 }
 
+// ParseCompressType converts a string to a CompressType
+func ParseCompressType(s string) (CompressType, error) {
+	var ct CompressType
+	err := ct.UnmarshalText([]byte(s))
+	return ct, err
+}
+
 func (ct CompressType) String() string {
 	switch ct {
 	case CompressNone:
@@ -105,6 +157,44 @@ func (ct CompressType) String() string {
 		return "gzip"
 	case CompressXz:
 		return "xz"
+	case CompressZstd:
+		return "zstd"
 	}
 	return "unknown"
 }
+
+// MarshalText converts the CompressType to a string
+func (ct CompressType) MarshalText() ([]byte, error) {
+	s := ct.String()
+	if s == "unknown" {
+		return nil, ErrUnknownType
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText converts a string to a CompressType
+func (ct *CompressType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "none", "uncompressed", "":
+		*ct = CompressNone
+	case "bzip2":
+		*ct = CompressBzip2
+	case "gzip":
+		*ct = CompressGzip
+	case "xz":
+		*ct = CompressXz
+	case "zstd":
+		*ct = CompressZstd
+	default:
+		return ErrUnknownType
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
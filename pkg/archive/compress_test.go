@@ -0,0 +1,70 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("hello world\n"), 1000)
+	tests := []CompressType{CompressNone, CompressGzip, CompressXz, CompressZstd}
+	for _, ctIn := range tests {
+		for _, ctOut := range tests {
+			t.Run(ctIn.String()+"-"+ctOut.String(), func(t *testing.T) {
+				in, err := Compress(bytes.NewReader(data), ctIn)
+				if err != nil {
+					t.Fatalf("failed to compress input: %v", err)
+				}
+				out, err := Compress(in, ctOut)
+				if err != nil {
+					t.Fatalf("failed to compress output: %v", err)
+				}
+				b, err := io.ReadAll(out)
+				if err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+				if ct := DetectCompression(b); ct != ctOut {
+					t.Errorf("unexpected compression, expected %s, received %s", ctOut, ct)
+				}
+				dr, err := Decompress(bytes.NewReader(b))
+				if err != nil {
+					t.Fatalf("failed to decompress: %v", err)
+				}
+				b, err = io.ReadAll(dr)
+				if err != nil {
+					t.Fatalf("failed to read decompressed data: %v", err)
+				}
+				if !bytes.Equal(b, data) {
+					t.Errorf("data mismatch after decompress")
+				}
+			})
+		}
+	}
+	t.Run("bzip2-output", func(t *testing.T) {
+		_, err := Compress(bytes.NewReader(data), CompressBzip2)
+		if err != ErrUnknownType {
+			t.Errorf("unexpected error, expected %v, received %v", ErrUnknownType, err)
+		}
+	})
+}
+
+func TestCompressTypeText(t *testing.T) {
+	for _, ct := range []CompressType{CompressNone, CompressBzip2, CompressGzip, CompressXz, CompressZstd} {
+		b, err := ct.MarshalText()
+		if err != nil {
+			t.Fatalf("failed to marshal %d: %v", ct, err)
+		}
+		var ct2 CompressType
+		err = ct2.UnmarshalText(b)
+		if err != nil {
+			t.Fatalf("failed to unmarshal %s: %v", string(b), err)
+		}
+		if ct != ct2 {
+			t.Errorf("mismatch, expected %s, received %s", ct, ct2)
+		}
+	}
+	if _, err := ParseCompressType("invalid"); err != ErrUnknownType {
+		t.Errorf("unexpected error parsing invalid type: %v", err)
+	}
+}
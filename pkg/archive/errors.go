@@ -7,7 +7,8 @@ var (
 	ErrNotImplemented = errors.New("this archive routine is not implemented yet")
 	// ErrUnknownType used for unknown compression types
 	ErrUnknownType = errors.New("unknown compression type")
-	// ErrXzUnsupported because there isn't a Go package for this and I'm
-	// avoiding dependencies on external binaries
+	// ErrXzUnsupported is no longer returned, xz is supported by Decompress
+	//
+	// Deprecated: xz compression is now supported
 	ErrXzUnsupported = errors.New("xz compression is currently unsupported")
 )
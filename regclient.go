@@ -12,9 +12,11 @@ import (
 	"fmt"
 
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/blobcache"
 	"github.com/regclient/regclient/internal/rwfs"
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/scheme/ocidir"
+	"github.com/regclient/regclient/scheme/ocifile"
 	"github.com/regclient/regclient/scheme/reg"
 	"github.com/sirupsen/logrus"
 )
@@ -55,6 +57,10 @@ type RegClient struct {
 	schemes   map[string]scheme.API
 	userAgent string
 	fs        rwfs.RWFS
+	// blobCache is only created when blobCacheDir is set
+	blobCache    *blobcache.Cache
+	blobCacheDir string
+	blobCacheMax int64
 }
 
 // Opt functions are used to configure NewRegClient
@@ -95,12 +101,34 @@ func New(opts ...Opt) *RegClient {
 		reg.WithUserAgent(rc.userAgent),
 	)
 
-	// setup scheme's
-	rc.schemes["reg"] = reg.New(rc.regOpts...)
-	rc.schemes["ocidir"] = ocidir.New(
-		ocidir.WithLog(rc.log),
-		ocidir.WithFS(rc.fs),
-	)
+	// setup scheme's, skipping any replaced with WithScheme
+	if _, ok := rc.schemes["reg"]; !ok {
+		rc.schemes["reg"] = reg.New(rc.regOpts...)
+	}
+	if _, ok := rc.schemes["ocidir"]; !ok {
+		rc.schemes["ocidir"] = ocidir.New(
+			ocidir.WithLog(rc.log),
+			ocidir.WithFS(rc.fs),
+		)
+	}
+	if _, ok := rc.schemes["ocifile"]; !ok {
+		rc.schemes["ocifile"] = ocifile.New(
+			ocifile.WithLog(rc.log),
+			ocifile.WithFS(rc.fs),
+		)
+	}
+
+	if rc.blobCacheDir != "" {
+		bc, err := blobcache.New(rc.fs, rc.blobCacheDir, rc.blobCacheMax, blobcache.WithLog(rc.log))
+		if err != nil {
+			rc.log.WithFields(logrus.Fields{
+				"dir": rc.blobCacheDir,
+				"err": err,
+			}).Warn("Failed to setup blob cache")
+		} else {
+			rc.blobCache = bc
+		}
+	}
 
 	rc.log.WithFields(logrus.Fields{
 		"VCSRef": VCSRef,
@@ -149,6 +177,15 @@ func WithConfigHost(configHost config.Host) Opt {
 	return WithConfigHosts([]config.Host{configHost})
 }
 
+// WithBlobCache stores blobs pulled from registries in a local directory, reusing them for later requests.
+// The least recently used blobs are removed when the cache exceeds maxSize bytes, 0 disables the limit.
+func WithBlobCache(dir string, maxSize int64) Opt {
+	return func(rc *RegClient) {
+		rc.blobCacheDir = dir
+		rc.blobCacheMax = maxSize
+	}
+}
+
 // WithBlobSize overrides default blob sizes
 func WithBlobSize(chunk, max int64) Opt {
 	return func(rc *RegClient) {
@@ -156,7 +193,7 @@ func WithBlobSize(chunk, max int64) Opt {
 	}
 }
 
-// WithFS overrides the backing filesystem (used by ocidir)
+// WithFS overrides the backing filesystem (used by ocidir and ocifile)
 func WithFS(fs rwfs.RWFS) Opt {
 	return func(rc *RegClient) {
 		rc.fs = fs
@@ -184,6 +221,23 @@ func WithRetryLimit(retryLimit int) Opt {
 	}
 }
 
+// WithScheme adds a scheme implementation, or replaces a built in scheme.
+// References using a custom scheme must have a parser registered with ref.RegisterScheme.
+// If the scheme implements scheme.Closer, Close will be called by RegClient.Close.
+func WithScheme(name string, api scheme.API) Opt {
+	return func(rc *RegClient) {
+		rc.schemes[name] = api
+	}
+}
+
+// WithUploadStore saves the state of chunked blob uploads to registries.
+// An interrupted upload of the same blob to the same repository resumes from the last accepted byte.
+func WithUploadStore(store reg.UploadStore) Opt {
+	return func(rc *RegClient) {
+		rc.regOpts = append(rc.regOpts, reg.WithUploadStore(store))
+	}
+}
+
 // WithUserAgent specifies the User-Agent http header
 func WithUserAgent(ua string) Opt {
 	return func(rc *RegClient) {
@@ -216,6 +270,8 @@ func (rc *RegClient) hostLoad(src string, hosts []config.Host) {
 			"api":        configHost.API,
 			"blobMax":    configHost.BlobMax,
 			"blobChunk":  configHost.BlobChunk,
+			"blobGetMin": configHost.BlobGetMin,
+			"blobGetPar": configHost.BlobGetPar,
 		}).Debugf("Loading %s config", src)
 		err := rc.hostSet(configHost)
 		if err != nil {
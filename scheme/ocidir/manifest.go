@@ -19,6 +19,7 @@ import (
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 )
@@ -55,25 +56,19 @@ func (o *OCIDir) ManifestDelete(ctx context.Context, r ref.Ref, opts ...scheme.M
 		}
 	}
 
-	// get index
-	changed := false
-	index, err := o.readIndex(r)
-	if err != nil {
-		return fmt.Errorf("failed to read index: %w", err)
-	}
-	for i := len(index.Manifests) - 1; i >= 0; i-- {
-		// remove matching entry from index
-		if r.Digest != "" && index.Manifests[i].Digest.String() == r.Digest {
-			changed = true
-			index.Manifests = append(index.Manifests[:i], index.Manifests[i+1:]...)
-		}
-	}
-	// push manifest back out
-	if changed {
-		err = o.writeIndex(r, index)
-		if err != nil {
-			return fmt.Errorf("failed to write index: %w", err)
+	// remove matching entries from the index
+	err := o.updateIndex(r, false, func(index *v1.Index) (bool, error) {
+		changed := false
+		for i := len(index.Manifests) - 1; i >= 0; i-- {
+			if r.Digest != "" && index.Manifests[i].Digest.String() == r.Digest {
+				changed = true
+				index.Manifests = append(index.Manifests[:i], index.Manifests[i+1:]...)
+			}
 		}
+		return changed, nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// delete from filesystem like a registry would do
@@ -198,12 +193,6 @@ func (o *OCIDir) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest
 		r.Tag = "latest"
 	}
 
-	indexChanged := false
-	index, err := o.readIndex(r)
-	if err != nil {
-		index = indexCreate()
-		indexChanged = true
-	}
 	desc := m.GetDescriptor()
 	b, err := m.RawBody()
 	if err != nil {
@@ -234,20 +223,19 @@ func (o *OCIDir) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest
 	if err != nil {
 		return fmt.Errorf("failed to write manifest: %w", err)
 	}
-	// replace existing tag or create a new entry
-	if !config.Child {
-		err := indexSet(&index, r, desc)
-		if err != nil {
-			return fmt.Errorf("failed to update index: %w", err)
+	// replace existing tag or create a new entry, writing the index.json and oci-layout if changed
+	err = o.updateIndex(r, true, func(index *v1.Index) (bool, error) {
+		if config.Child {
+			return false, nil
 		}
-		indexChanged = true
-	}
-	// write the index.json and oci-layout if it's been changed
-	if indexChanged {
-		err = o.writeIndex(r, index)
+		err := indexSet(index, r, desc)
 		if err != nil {
-			return fmt.Errorf("failed to write index: %w", err)
+			return false, fmt.Errorf("failed to update index: %w", err)
 		}
+		return true, nil
+	})
+	if err != nil {
+		return err
 	}
 	o.refMod(r)
 	o.log.WithFields(logrus.Fields{
@@ -33,6 +33,7 @@ type OCIDir struct {
 	gc      bool
 	modRefs map[string]ref.Ref
 	mu      sync.Mutex
+	muIndex sync.Mutex // serializes updates to index.json
 }
 
 type ociConf struct {
@@ -115,6 +116,33 @@ func (o *OCIDir) readIndex(r ref.Ref) (v1.Index, error) {
 	return index, nil
 }
 
+// updateIndex runs fn on the index and writes any changes, serializing concurrent updates.
+// When create is set, a missing or invalid index is replaced with a new index.
+func (o *OCIDir) updateIndex(r ref.Ref, create bool, fn func(*v1.Index) (bool, error)) error {
+	o.muIndex.Lock()
+	defer o.muIndex.Unlock()
+	changed := false
+	index, err := o.readIndex(r)
+	if err != nil {
+		if !create {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+		index = indexCreate()
+		changed = true
+	}
+	fnChanged, err := fn(&index)
+	if err != nil {
+		return err
+	}
+	if changed || fnChanged {
+		err = o.writeIndex(r, index)
+		if err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	return nil
+}
+
 func (o *OCIDir) writeIndex(r ref.Ref, i v1.Index) error {
 	err := rwfs.MkdirAll(o.fs, r.Path, 0777)
 	if err != nil && !errors.Is(err, fs.ErrExist) {
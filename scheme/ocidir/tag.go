@@ -9,6 +9,7 @@ import (
 
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
+	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/regclient/regclient/types/tag"
 )
@@ -18,26 +19,22 @@ func (o *OCIDir) TagDelete(ctx context.Context, r ref.Ref) error {
 	if r.Tag == "" {
 		return types.ErrMissingTag
 	}
-	// get index
-	index, err := o.readIndex(r)
-	if err != nil {
-		return fmt.Errorf("failed to read index: %w", err)
-	}
-	changed := false
-	for i, desc := range index.Manifests {
-		if t, ok := desc.Annotations[aOCIRefName]; ok && t == r.Tag {
-			// remove matching entry from index
-			index.Manifests = append(index.Manifests[:i], index.Manifests[i+1:]...)
-			changed = true
+	err := o.updateIndex(r, false, func(index *v1.Index) (bool, error) {
+		changed := false
+		for i, desc := range index.Manifests {
+			if t, ok := desc.Annotations[aOCIRefName]; ok && t == r.Tag {
+				// remove matching entry from index
+				index.Manifests = append(index.Manifests[:i], index.Manifests[i+1:]...)
+				changed = true
+			}
 		}
-	}
-	if !changed {
-		return fmt.Errorf("failed deleting %s: %w", r.CommonName(), types.ErrNotFound)
-	}
-	// push manifest back out
-	err = o.writeIndex(r, index)
+		if !changed {
+			return false, fmt.Errorf("failed deleting %s: %w", r.CommonName(), types.ErrNotFound)
+		}
+		return true, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to write index: %w", err)
+		return err
 	}
 	o.refMod(r)
 	return nil
@@ -0,0 +1,35 @@
+package ocifile
+
+import (
+	"context"
+	"io"
+
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/blob"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// BlobDelete removes a blob from the repository
+func (o *OCIFile) BlobDelete(ctx context.Context, r ref.Ref, d types.Descriptor) error {
+	return o.get(r).dir.BlobDelete(ctx, r, d)
+}
+
+// BlobGet retrieves a blob, returning a reader
+func (o *OCIFile) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	return o.get(r).dir.BlobGet(ctx, r, d)
+}
+
+// BlobHead verifies the existence of a blob, the reader contains the headers but no body to read
+func (o *OCIFile) BlobHead(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	return o.get(r).dir.BlobHead(ctx, r, d)
+}
+
+// BlobMount attempts to perform a server side copy of the blob
+func (o *OCIFile) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+	return types.ErrUnsupported
+}
+
+// BlobPut sends a blob to the repository, returns the digest and size when successful
+func (o *OCIFile) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+	return o.get(r).dir.BlobPut(ctx, r, d, rdr)
+}
@@ -0,0 +1,34 @@
+package ocifile
+
+import (
+	"context"
+	"path"
+
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// Close runs garbage collection on any modified content and writes the changes to the tar file
+func (o *OCIFile) Close(ctx context.Context, r ref.Ref) error {
+	file := path.Clean(r.Path)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	of, ok := o.files[file]
+	if !ok {
+		return nil
+	}
+	err := of.dir.Close(ctx, r)
+	if err != nil {
+		return err
+	}
+	o.log.WithFields(logrus.Fields{
+		"ref":  r.CommonName(),
+		"file": file,
+	}).Debug("closing tar file")
+	err = of.tfs.flush()
+	if err != nil {
+		return err
+	}
+	delete(o.files, file)
+	return nil
+}
@@ -0,0 +1,29 @@
+package ocifile
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// ManifestDelete removes a manifest, including all tags that point to that manifest
+func (o *OCIFile) ManifestDelete(ctx context.Context, r ref.Ref, opts ...scheme.ManifestOpts) error {
+	return o.get(r).dir.ManifestDelete(ctx, r, opts...)
+}
+
+// ManifestGet retrieves a manifest from a repository
+func (o *OCIFile) ManifestGet(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	return o.get(r).dir.ManifestGet(ctx, r)
+}
+
+// ManifestHead gets metadata about the manifest (existence, digest, mediatype, size)
+func (o *OCIFile) ManifestHead(ctx context.Context, r ref.Ref) (manifest.Manifest, error) {
+	return o.get(r).dir.ManifestHead(ctx, r)
+}
+
+// ManifestPut sends a manifest to the repository
+func (o *OCIFile) ManifestPut(ctx context.Context, r ref.Ref, m manifest.Manifest, opts ...scheme.ManifestOpts) error {
+	return o.get(r).dir.ManifestPut(ctx, r, m, opts...)
+}
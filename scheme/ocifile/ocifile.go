@@ -0,0 +1,117 @@
+// Package ocifile implements the OCI Image Layout scheme with a tar file
+// The tar file may optionally be compressed with gzip.
+// Content is streamed from the tar file when read.
+// Any changes are spooled to a temp directory and written to the tar file when Close is called.
+package ocifile
+
+import (
+	"io/ioutil"
+	"path"
+	"sync"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/scheme/ocidir"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	imageLayoutFile = "oci-layout"
+	indexFile       = "index.json"
+)
+
+// OCIFile is used for accessing OCI Image Layouts packed in a tar file
+type OCIFile struct {
+	fs    rwfs.RWFS
+	log   *logrus.Logger
+	gc    bool
+	files map[string]*ociFile
+	mu    sync.Mutex
+}
+
+// ociFile tracks the state of a single tar file
+type ociFile struct {
+	tfs *tarFS
+	dir *ocidir.OCIDir
+}
+
+type ociConf struct {
+	fs  rwfs.RWFS
+	gc  bool
+	log *logrus.Logger
+}
+
+// Opts are used for passing options to ocifile
+type Opts func(*ociConf)
+
+// New creates a new OCIFile with options
+func New(opts ...Opts) *OCIFile {
+	conf := ociConf{
+		log: &logrus.Logger{Out: ioutil.Discard},
+		gc:  true,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if conf.fs == nil {
+		conf.fs = rwfs.OSNew("")
+	}
+	return &OCIFile{
+		fs:    conf.fs,
+		log:   conf.log,
+		gc:    conf.gc,
+		files: map[string]*ociFile{},
+	}
+}
+
+// WithFS allows the rwfs to be replaced
+// The default is to use the OS, this can be used to sandbox within a folder
+// This can also be used to pass an in-memory filesystem for testing or special use cases
+func WithFS(fs rwfs.RWFS) Opts {
+	return func(c *ociConf) {
+		c.fs = fs
+	}
+}
+
+// WithGC configures the garbage collection setting
+// This defaults to enabled
+func WithGC(gc bool) Opts {
+	return func(c *ociConf) {
+		c.gc = gc
+	}
+}
+
+// WithLog provides a logrus logger
+// By default logging is disabled
+func WithLog(log *logrus.Logger) Opts {
+	return func(c *ociConf) {
+		c.log = log
+	}
+}
+
+// Info is experimental, do not use
+func (o *OCIFile) Info() scheme.Info {
+	return scheme.Info{ManifestPushFirst: true}
+}
+
+// get returns the OCI Layout handler for the tar file in a reference
+func (o *OCIFile) get(r ref.Ref) *ociFile {
+	file := path.Clean(r.Path)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if of, ok := o.files[file]; ok {
+		return of
+	}
+	tfs := newTarFS(o.fs, file)
+	of := &ociFile{
+		tfs: tfs,
+		dir: ocidir.New(
+			ocidir.WithFS(tfs),
+			ocidir.WithGC(o.gc),
+			ocidir.WithLog(o.log),
+		),
+	}
+	o.files[file] = of
+	return of
+}
@@ -0,0 +1,340 @@
+package ocifile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// tarFromDir packs a directory from the testdata into a tar file on the rwfs
+func tarFromDir(t *testing.T, srcFS fs.FS, srcDir string, tgtFS rwfs.RWFS, tgtFile string, gz bool) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var gw *gzip.Writer
+	if gz {
+		gw = gzip.NewWriter(buf)
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+	err := fs.WalkDir(srcFS, srcDir, func(name string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := name[len(srcDir):]
+		if rel == "" {
+			return nil
+		}
+		rel = rel[1:]
+		if de.IsDir() {
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./" + rel + "/", Mode: 0755})
+		}
+		b, err := fs.ReadFile(srcFS, name)
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "./" + rel, Mode: 0644, Size: int64(len(b))})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to walk %s: %v", srcDir, err)
+	}
+	tw.Close()
+	if gw != nil {
+		gw.Close()
+	}
+	err = rwfs.WriteFile(tgtFS, tgtFile, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", tgtFile, err)
+	}
+}
+
+func TestOCIFile(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	tarFromDir(t, fsOS, "../../testdata/testrepo", fsMem, "testrepo.tar", false)
+	tarFromDir(t, fsOS, "../../testdata/testrepo", fsMem, "testrepo.tar.gz", true)
+
+	for _, file := range []string{"testrepo.tar", "testrepo.tar.gz"} {
+		t.Run(file, func(t *testing.T) {
+			o := New(WithFS(fsMem))
+			r, err := ref.New("ocifile://" + file + ":v1")
+			if err != nil {
+				t.Fatalf("failed to parse ref: %v", err)
+			}
+			tl, err := o.TagList(ctx, r)
+			if err != nil {
+				t.Fatalf("failed to list tags: %v", err)
+			}
+			tags, _ := tl.GetTags()
+			if len(tags) != 4 {
+				t.Errorf("unexpected tag list: %v", tags)
+			}
+			mh, err := o.ManifestHead(ctx, r)
+			if err != nil {
+				t.Fatalf("manifest head: %v", err)
+			}
+			ml, err := o.ManifestGet(ctx, r)
+			if err != nil {
+				t.Fatalf("manifest get: %v", err)
+			}
+			if mh.GetDescriptor().Digest != ml.GetDescriptor().Digest {
+				t.Errorf("digest mismatch, head %s, get %s", mh.GetDescriptor().Digest, ml.GetDescriptor().Digest)
+			}
+			mli, ok := ml.(manifest.Indexer)
+			if !ok {
+				t.Fatalf("manifest is not an index")
+			}
+			dl, err := mli.GetManifestList()
+			if err != nil || len(dl) == 0 {
+				t.Fatalf("failed to get manifest list: %v", err)
+			}
+			rc := r
+			rc.Tag = ""
+			rc.Digest = dl[0].Digest.String()
+			m, err := o.ManifestGet(ctx, rc)
+			if err != nil {
+				t.Fatalf("failed to get child manifest: %v", err)
+			}
+			mi, ok := m.(manifest.Imager)
+			if !ok {
+				t.Fatalf("child manifest is not an image")
+			}
+			layers, err := mi.GetLayers()
+			if err != nil || len(layers) == 0 {
+				t.Fatalf("failed to get layers: %v", err)
+			}
+			br, err := o.BlobGet(ctx, rc, layers[0])
+			if err != nil {
+				t.Fatalf("failed to get blob: %v", err)
+			}
+			_, err = io.ReadAll(br)
+			if err != nil {
+				t.Errorf("failed to read blob: %v", err)
+			}
+			err = br.Close()
+			if err != nil {
+				t.Errorf("failed to close blob: %v", err)
+			}
+			if br.GetDescriptor().Digest != layers[0].Digest {
+				t.Errorf("blob digest mismatch, expected %s, received %s", layers[0].Digest, br.GetDescriptor().Digest)
+			}
+			// unmodified close should not rewrite the file
+			before, err := rwfs.ReadFile(fsMem, file)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", file, err)
+			}
+			err = o.Close(ctx, r)
+			if err != nil {
+				t.Errorf("failed to close: %v", err)
+			}
+			after, err := rwfs.ReadFile(fsMem, file)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", file, err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Errorf("file modified on close without changes")
+			}
+		})
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		o := New(WithFS(fsMem))
+		rSrc, err := ref.New("ocifile://testrepo.tar:v1")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		rTgt, err := ref.New("ocifile://out/copy.tar.gz:copy")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		err = rwfs.MkdirAll(fsMem, "out", 0755)
+		if err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		ml, err := o.ManifestGet(ctx, rSrc)
+		if err != nil {
+			t.Fatalf("manifest get: %v", err)
+		}
+		// push manifest first, then the children, matching ImageCopy
+		err = o.ManifestPut(ctx, rTgt, ml)
+		if err != nil {
+			t.Fatalf("manifest put: %v", err)
+		}
+		dl, _ := ml.(manifest.Indexer).GetManifestList()
+		for _, d := range dl {
+			rcSrc := rSrc
+			rcSrc.Tag = ""
+			rcSrc.Digest = d.Digest.String()
+			rcTgt := rTgt
+			rcTgt.Tag = ""
+			rcTgt.Digest = d.Digest.String()
+			m, err := o.ManifestGet(ctx, rcSrc)
+			if err != nil {
+				t.Fatalf("manifest get %s: %v", rcSrc.CommonName(), err)
+			}
+			err = o.ManifestPut(ctx, rcTgt, m, scheme.WithManifestChild())
+			if err != nil {
+				t.Fatalf("manifest put %s: %v", rcTgt.CommonName(), err)
+			}
+			mi := m.(manifest.Imager)
+			cd, _ := mi.GetConfig()
+			layers, _ := mi.GetLayers()
+			for _, bd := range append([]types.Descriptor{cd}, layers...) {
+				br, err := o.BlobGet(ctx, rcSrc, bd)
+				if err != nil {
+					t.Fatalf("blob get %s: %v", bd.Digest, err)
+				}
+				_, err = o.BlobPut(ctx, rcTgt, bd, br)
+				br.Close()
+				if err != nil {
+					t.Fatalf("blob put %s: %v", bd.Digest, err)
+				}
+			}
+		}
+		// content is available before close
+		_, err = o.ManifestHead(ctx, rTgt)
+		if err != nil {
+			t.Errorf("manifest head before close: %v", err)
+		}
+		_, err = rwfs.Stat(fsMem, rTgt.Path)
+		if err == nil {
+			t.Errorf("tar file created before close")
+		}
+		err = o.Close(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+		// verify the tar file is gzip compressed and contains the layout
+		raw, err := rwfs.ReadFile(fsMem, rTgt.Path)
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		gr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("tar is not gzip compressed: %v", err)
+		}
+		tr := tar.NewReader(gr)
+		found := map[string]bool{}
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatalf("failed to read tar: %v", err)
+			}
+			found[path.Clean(hdr.Name)] = true
+		}
+		for _, name := range []string{imageLayoutFile, indexFile, "blobs/" + ml.GetDescriptor().Digest.Algorithm().String() + "/" + ml.GetDescriptor().Digest.Encoded()} {
+			if !found[name] {
+				t.Errorf("missing %s in tar", name)
+			}
+		}
+		// reopen and verify the image
+		o2 := New(WithFS(fsMem))
+		m2, err := o2.ManifestGet(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("manifest get after close: %v", err)
+		}
+		if m2.GetDescriptor().Digest != ml.GetDescriptor().Digest {
+			t.Errorf("digest mismatch after copy, expected %s, received %s", ml.GetDescriptor().Digest, m2.GetDescriptor().Digest)
+		}
+		// delete the tag, close, and verify the gc removed the blobs
+		err = o2.TagDelete(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("tag delete: %v", err)
+		}
+		err = o2.Close(ctx, rTgt)
+		if err != nil {
+			t.Fatalf("close after delete: %v", err)
+		}
+		o3 := New(WithFS(fsMem))
+		_, err = o3.ManifestHead(ctx, rTgt)
+		if err == nil {
+			t.Errorf("manifest head succeeded after tag delete")
+		}
+		rDig := rTgt
+		rDig.Tag = ""
+		rDig.Digest = dl[0].Digest.String()
+		_, err = o3.ManifestGet(ctx, rDig)
+		if err == nil {
+			t.Errorf("child manifest was not garbage collected")
+		}
+	})
+}
+
+func TestTarFSIndex(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsTmp := rwfs.OSNew(t.TempDir())
+	tarFromDir(t, fsOS, "../../testdata/testrepo", fsTmp, "testrepo.tar", false)
+	o := New(WithFS(fsTmp))
+	r, err := ref.New("ocifile://testrepo.tar:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	ml, err := o.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("manifest get: %v", err)
+	}
+	tfs := o.get(r).tfs
+	if len(tfs.offsets) == 0 || len(tfs.offsets) != len(tfs.entries) {
+		t.Errorf("tar entries not indexed, %d offsets for %d entries", len(tfs.offsets), len(tfs.entries))
+	}
+	// read each child manifest using the index
+	dl, _ := ml.(manifest.Indexer).GetManifestList()
+	for _, d := range dl {
+		rc := r
+		rc.Tag = ""
+		rc.Digest = d.Digest.String()
+		m, err := o.ManifestGet(ctx, rc)
+		if err != nil {
+			t.Fatalf("manifest get %s: %v", rc.CommonName(), err)
+		}
+		if m.GetDescriptor().Digest != d.Digest {
+			t.Errorf("digest mismatch, expected %s, received %s", d.Digest, m.GetDescriptor().Digest)
+		}
+	}
+	// writes are spooled to a temp dir that is removed on close
+	rTgt := r
+	rTgt.Tag = "copy"
+	err = o.ManifestPut(ctx, rTgt, ml)
+	if err != nil {
+		t.Fatalf("manifest put: %v", err)
+	}
+	overlayDir := tfs.overlayDir
+	if overlayDir == "" {
+		t.Fatalf("overlay temp dir not created")
+	}
+	err = o.Close(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if _, err := os.Stat(overlayDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("overlay temp dir not removed: %v", err)
+	}
+	o2 := New(WithFS(fsTmp))
+	_, err = o2.ManifestHead(ctx, rTgt)
+	if err != nil {
+		t.Errorf("manifest head after close: %v", err)
+	}
+	_ = o2.Close(ctx, rTgt)
+}
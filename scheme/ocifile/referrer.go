@@ -0,0 +1,15 @@
+package ocifile
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/referrer"
+)
+
+// ReferrerList returns a list of referrers to a given reference
+// This is EXPERIMENTAL
+func (o *OCIFile) ReferrerList(ctx context.Context, r ref.Ref, opts ...scheme.ReferrerOpts) (referrer.ReferrerList, error) {
+	return o.get(r).dir.ReferrerList(ctx, r, opts...)
+}
@@ -0,0 +1,19 @@
+package ocifile
+
+import (
+	"context"
+
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/tag"
+)
+
+// TagDelete removes a tag from the repository
+func (o *OCIFile) TagDelete(ctx context.Context, r ref.Ref) error {
+	return o.get(r).dir.TagDelete(ctx, r)
+}
+
+// TagList returns a list of tags from the repository
+func (o *OCIFile) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts) (*tag.List, error) {
+	return o.get(r).dir.TagList(ctx, r, opts...)
+}
@@ -0,0 +1,867 @@
+package ocifile
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+)
+
+// tarFS presents the contents of a tar file as a read-write filesystem.
+// Files are streamed from the tar when read, and new content is spooled to an overlay in a temp directory.
+// Changes are only written back to the tar file when flush is called.
+type tarFS struct {
+	fs         rwfs.RWFS // filesystem containing the tar file
+	file       string    // name of the tar file within fs
+	mu         sync.Mutex
+	loaded     bool
+	comp       archive.CompressType
+	entries    map[string]int64 // regular files in the tar, mapped to their size
+	offsets    map[string]int64 // offset of the file content within an uncompressed tar
+	dirs       map[string]bool  // directories in the tar or created in the overlay
+	removed    map[string]bool  // files in the tar that have been removed or replaced by the overlay
+	overlay    rwfs.RWFS
+	overlayDir string // temp directory backing the overlay
+	changed    bool
+}
+
+type tarFile struct {
+	t      *tarFS
+	name   string
+	size   int64
+	offset int64 // offset of the content in the tar, or -1 when the tar must be scanned
+	rdr    io.Reader
+	fh     fs.File
+}
+
+type tarDir struct {
+	t    *tarFS
+	name string
+	des  []fs.DirEntry
+	cur  int
+}
+
+func newTarFS(fsys rwfs.RWFS, file string) *tarFS {
+	return &tarFS{
+		fs:   fsys,
+		file: path.Clean(file),
+	}
+}
+
+// Create creates a new file in the overlay
+func (t *tarFS) Create(name string) (rwfs.WFile, error) {
+	return t.OpenFile(name, rwfs.O_RDWR|rwfs.O_CREATE|rwfs.O_TRUNC, 0666)
+}
+
+// Mkdir creates a directory in the overlay
+func (t *tarFS) Mkdir(name string, perm fs.FileMode) error {
+	rel, ok := t.rel(name)
+	if !ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.load()
+	if err != nil {
+		return err
+	}
+	if t.exists(rel) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if dir := path.Dir(rel); dir != "." && !t.dirs[dir] {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+	}
+	err = rwfs.MkdirAll(t.overlay, rel, perm)
+	if err != nil {
+		return err
+	}
+	t.dirs[rel] = true
+	t.changed = true
+	return nil
+}
+
+// Open opens a file or directory for reading
+func (t *tarFS) Open(name string) (fs.File, error) {
+	rel, ok := t.rel(name)
+	if !ok {
+		// parent directories of the tar file are reported as empty directories to support MkdirAll
+		if t.isParent(name) {
+			return &tarDir{t: t, name: path.Base(name), des: []fs.DirEntry{}}, nil
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.load()
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." || t.dirs[rel] {
+		des, err := t.readDir(rel)
+		if err != nil {
+			return nil, err
+		}
+		return &tarDir{t: t, name: path.Base(rel), des: des}, nil
+	}
+	if fh, err := t.overlay.Open(rel); err == nil {
+		return fh, nil
+	}
+	if size, ok := t.entries[rel]; ok && !t.removed[rel] {
+		return t.tarFile(rel, size), nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// OpenFile opens a file with the requested flags, any writes are made to the overlay
+func (t *tarFS) OpenFile(name string, flags int, perm fs.FileMode) (rwfs.RWFile, error) {
+	if flags&(rwfs.O_WRONLY|rwfs.O_RDWR|rwfs.O_CREATE|rwfs.O_APPEND|rwfs.O_TRUNC) == 0 {
+		fh, err := t.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if rwfh, ok := fh.(rwfs.RWFile); ok {
+			return rwfh, nil
+		}
+		return &readOnlyFile{File: fh}, nil
+	}
+	rel, ok := t.rel(name)
+	if !ok || rel == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.load()
+	if err != nil {
+		return nil, err
+	}
+	if t.dirs[rel] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	if dir := path.Dir(rel); dir != "." && !t.dirs[dir] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	err = t.overlayMkdir(path.Dir(rel))
+	if err != nil {
+		return nil, err
+	}
+	// copy existing content from the tar into the overlay when it will not be truncated
+	if _, ok := t.entries[rel]; ok && !t.removed[rel] && flags&rwfs.O_TRUNC == 0 {
+		if _, err := rwfs.Stat(t.overlay, rel); err != nil {
+			err = t.copyToOverlay(rel)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	fh, err := t.overlay.OpenFile(rel, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := t.entries[rel]; ok {
+		t.removed[rel] = true
+	}
+	t.changed = true
+	return fh, nil
+}
+
+// ReadDir returns the combined directory listing from the tar and the overlay
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	rel, ok := t.rel(name)
+	if !ok {
+		if t.isParent(name) {
+			return []fs.DirEntry{}, nil
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.load()
+	if err != nil {
+		return nil, err
+	}
+	if rel != "." && !t.dirs[rel] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return t.readDir(rel)
+}
+
+// Remove deletes a file or empty directory
+func (t *tarFS) Remove(name string) error {
+	rel, ok := t.rel(name)
+	if !ok || rel == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.load()
+	if err != nil {
+		return err
+	}
+	if !t.exists(rel) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if t.dirs[rel] {
+		des, err := t.readDir(rel)
+		if err != nil {
+			return err
+		}
+		if len(des) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+		}
+		delete(t.dirs, rel)
+	}
+	if _, err := rwfs.Stat(t.overlay, rel); err == nil {
+		err = t.overlay.Remove(rel)
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := t.entries[rel]; ok {
+		t.removed[rel] = true
+	}
+	t.changed = true
+	return nil
+}
+
+// Rename moves a file to a new name
+func (t *tarFS) Rename(oldName, newName string) error {
+	oldRel, ok := t.rel(oldName)
+	if !ok || oldRel == "." {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	newRel, ok := t.rel(newName)
+	if !ok || newRel == "." {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrInvalid}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.load()
+	if err != nil {
+		return err
+	}
+	if !t.exists(oldRel) {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	if t.dirs[oldRel] || t.dirs[newRel] {
+		// directory renames are not needed by ocidir
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	if dir := path.Dir(newRel); dir != "." && !t.dirs[dir] {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrNotExist}
+	}
+	err = t.overlayMkdir(path.Dir(newRel))
+	if err != nil {
+		return err
+	}
+	if _, err := rwfs.Stat(t.overlay, oldRel); err != nil {
+		err = t.overlayMkdir(path.Dir(oldRel))
+		if err != nil {
+			return err
+		}
+		err = t.copyToOverlay(oldRel)
+		if err != nil {
+			return err
+		}
+	}
+	err = t.overlay.Rename(oldRel, newRel)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.entries[oldRel]; ok {
+		t.removed[oldRel] = true
+	}
+	if _, ok := t.entries[newRel]; ok {
+		t.removed[newRel] = true
+	}
+	t.changed = true
+	return nil
+}
+
+// flush writes any changes back to the tar file and resets the overlay
+func (t *tarFS) flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.loaded {
+		return nil
+	}
+	if !t.changed {
+		return t.reset()
+	}
+	var gzipW *gzip.Writer
+	switch t.comp {
+	case archive.CompressNone, archive.CompressGzip:
+	default:
+		return fmt.Errorf("unable to write %s with %s compression: %w", t.file, t.comp.String(), archive.ErrUnknownType)
+	}
+	tmpName := t.file + ".tmp"
+	fh, err := t.fs.OpenFile(tmpName, rwfs.O_WRONLY|rwfs.O_CREATE|rwfs.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpName, err)
+	}
+	// cleanup the temp file on any failure
+	success := false
+	defer func() {
+		if !success {
+			_ = fh.Close()
+			_ = t.fs.Remove(tmpName)
+		}
+	}()
+	var w io.Writer = fh
+	if t.comp == archive.CompressGzip {
+		gzipW = gzip.NewWriter(fh)
+		w = gzipW
+	}
+	tw := tar.NewWriter(w)
+	dirs := map[string]bool{}
+	written := map[string]bool{}
+	writeFile := func(name string, size int64, rdr io.Reader) error {
+		// add any parent directories not yet in the tar
+		parents := []string{}
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			err := tw.WriteHeader(&tar.Header{
+				Format:   tar.FormatPAX,
+				Typeflag: tar.TypeDir,
+				Name:     dir + "/",
+				Mode:     0755,
+			})
+			if err != nil {
+				return err
+			}
+			dirs[dir] = true
+		}
+		err := tw.WriteHeader(&tar.Header{
+			Format:   tar.FormatPAX,
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     size,
+			Mode:     0644,
+		})
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(tw, rdr)
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return fmt.Errorf("size mismatch writing %s, expected %d, received %d", name, size, n)
+		}
+		written[name] = true
+		return nil
+	}
+	writeOverlay := func(name string) error {
+		ofh, err := t.overlay.Open(name)
+		if err != nil {
+			return err
+		}
+		defer ofh.Close()
+		fi, err := ofh.Stat()
+		if err != nil {
+			return err
+		}
+		return writeFile(name, fi.Size(), ofh)
+	}
+
+	// the layout and index are written first to simplify streaming imports
+	for _, name := range []string{imageLayoutFile, indexFile} {
+		if _, err := rwfs.Stat(t.overlay, name); err == nil {
+			err = writeOverlay(name)
+			if err != nil {
+				return err
+			}
+		} else if size, ok := t.entries[name]; ok && !t.removed[name] {
+			tf := t.tarFile(name, size)
+			err = writeFile(name, size, tf)
+			tf.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// stream the remaining unmodified entries from the existing tar
+	if len(t.entries) > 0 {
+		rfh, err := t.fs.Open(t.file)
+		if err != nil {
+			return err
+		}
+		defer rfh.Close()
+		rdr, _, err := tarReader(rfh)
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(rdr)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+			name := tarClean(hdr.Name)
+			if hdr.Typeflag != tar.TypeReg || written[name] || t.removed[name] {
+				continue
+			}
+			if _, err := rwfs.Stat(t.overlay, name); err == nil {
+				continue
+			}
+			err = writeFile(name, hdr.Size, tr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// add new files from the overlay
+	err = t.walkOverlay(".", func(name string) error {
+		if written[name] {
+			return nil
+		}
+		return writeOverlay(name)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	if gzipW != nil {
+		err = gzipW.Close()
+		if err != nil {
+			return err
+		}
+	}
+	err = fh.Close()
+	if err != nil {
+		return err
+	}
+	err = t.fs.Rename(tmpName, t.file)
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %w", t.file, err)
+	}
+	success = true
+	return t.reset()
+}
+
+// reset removes the overlay and forces the next access to reload the tar, must be called with the lock held
+func (t *tarFS) reset() error {
+	t.loaded = false
+	t.overlay = nil
+	t.changed = false
+	if t.overlayDir != "" {
+		dir := t.overlayDir
+		t.overlayDir = ""
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return fmt.Errorf("failed to remove temp directory %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// tarFile returns a handle to read a file from the tar, must be called with the lock held
+func (t *tarFS) tarFile(rel string, size int64) *tarFile {
+	offset, ok := t.offsets[rel]
+	if !ok {
+		offset = -1
+	}
+	return &tarFile{t: t, name: rel, size: size, offset: offset}
+}
+
+// copyToOverlay copies a file from the tar into the overlay
+func (t *tarFS) copyToOverlay(rel string) error {
+	size := t.entries[rel]
+	tf := t.tarFile(rel, size)
+	defer tf.Close()
+	ofh, err := t.overlay.Create(rel)
+	if err != nil {
+		return err
+	}
+	defer ofh.Close()
+	_, err = io.Copy(ofh, tf)
+	return err
+}
+
+// overlayMkdir creates a directory in the overlay, must be called with the lock held
+func (t *tarFS) overlayMkdir(rel string) error {
+	if rel == "." {
+		return nil
+	}
+	err := rwfs.MkdirAll(t.overlay, rel, 0755)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// exists checks for a file or directory, must be called with the lock held
+func (t *tarFS) exists(rel string) bool {
+	if rel == "." || t.dirs[rel] {
+		return true
+	}
+	if _, err := rwfs.Stat(t.overlay, rel); err == nil {
+		return true
+	}
+	if _, ok := t.entries[rel]; ok && !t.removed[rel] {
+		return true
+	}
+	return false
+}
+
+// isParent returns true if name is one of the directories containing the tar file
+func (t *tarFS) isParent(name string) bool {
+	name = path.Clean(name)
+	for dir := path.Dir(t.file); ; dir = path.Dir(dir) {
+		if name == dir {
+			return true
+		}
+		if dir == "." || dir == "/" {
+			return false
+		}
+	}
+}
+
+// load scans the tar file for the list of entries, must be called with the lock held
+func (t *tarFS) load() error {
+	if t.loaded {
+		return nil
+	}
+	t.entries = map[string]int64{}
+	t.offsets = map[string]int64{}
+	t.dirs = map[string]bool{}
+	t.removed = map[string]bool{}
+	t.changed = false
+	if t.overlayDir == "" {
+		dir, err := os.MkdirTemp("", "regclient-ocifile-")
+		if err != nil {
+			return fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		t.overlayDir = dir
+	}
+	t.overlay = rwfs.OSNew(t.overlayDir)
+	fh, err := t.fs.Open(t.file)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		// new files are compressed based on the filename extension
+		t.comp = archive.CompressNone
+		if strings.HasSuffix(t.file, ".gz") || strings.HasSuffix(t.file, ".tgz") {
+			t.comp = archive.CompressGzip
+		}
+		t.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fh.Close()
+	rdr, comp, err := tarReader(fh)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.file, err)
+	}
+	// track the position in an uncompressed tar to index the file content
+	var pr *posReader
+	if rs, ok := rdr.(io.ReadSeeker); ok {
+		pr = &posReader{rs: rs}
+		rdr = pr
+	}
+	tr := tar.NewReader(rdr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", t.file, err)
+		}
+		name := tarClean(hdr.Name)
+		if name == "." {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			t.dirs[name] = true
+		case tar.TypeReg:
+			t.entries[name] = hdr.Size
+			if pr != nil && !tarSparse(hdr) {
+				t.offsets[name] = pr.pos
+			} else {
+				delete(t.offsets, name)
+			}
+		default:
+			continue
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			t.dirs[dir] = true
+		}
+	}
+	t.comp = comp
+	t.loaded = true
+	return nil
+}
+
+// readDir lists the contents of a directory, must be called with the lock held
+func (t *tarFS) readDir(rel string) ([]fs.DirEntry, error) {
+	prefix := ""
+	if rel != "." {
+		prefix = rel + "/"
+	}
+	found := map[string]fs.DirEntry{}
+	for name := range t.dirs {
+		if strings.HasPrefix(name, prefix) && !strings.Contains(name[len(prefix):], "/") {
+			base := name[len(prefix):]
+			found[base] = rwfs.NewDE(base, fs.ModeDir, rwfs.NewFI(base, 4096, time.Time{}, fs.ModeDir))
+		}
+	}
+	for name, size := range t.entries {
+		if t.removed[name] {
+			continue
+		}
+		if strings.HasPrefix(name, prefix) && !strings.Contains(name[len(prefix):], "/") {
+			base := name[len(prefix):]
+			found[base] = rwfs.NewDE(base, 0, rwfs.NewFI(base, size, time.Time{}, 0))
+		}
+	}
+	if ode, err := fs.ReadDir(t.overlay, rel); err == nil {
+		for _, de := range ode {
+			found[de.Name()] = de
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	des := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		des[i] = found[name]
+	}
+	return des, nil
+}
+
+// rel converts a name into a path relative to the root of the tar
+func (t *tarFS) rel(name string) (string, bool) {
+	name = path.Clean(name)
+	if name == t.file {
+		return ".", true
+	}
+	prefix := t.file + "/"
+	if t.file == "." {
+		prefix = ""
+	}
+	if strings.HasPrefix(name, prefix) {
+		return name[len(prefix):], true
+	}
+	return "", false
+}
+
+// walkOverlay calls fn on each file in the overlay, sorted by name
+func (t *tarFS) walkOverlay(dir string, fn func(name string) error) error {
+	des, err := fs.ReadDir(t.overlay, dir)
+	if err != nil {
+		return err
+	}
+	for _, de := range des {
+		name := path.Join(dir, de.Name())
+		if de.IsDir() {
+			err = t.walkOverlay(name, fn)
+		} else {
+			err = fn(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the underlying tar file
+func (tf *tarFile) Close() error {
+	if tf.fh != nil {
+		err := tf.fh.Close()
+		tf.fh = nil
+		return err
+	}
+	return nil
+}
+
+// Read returns the contents of the file, seeking to the entry in the tar on the first read
+func (tf *tarFile) Read(b []byte) (int, error) {
+	if tf.rdr == nil {
+		err := tf.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return tf.rdr.Read(b)
+}
+
+// Stat returns the file details from the tar header
+func (tf *tarFile) Stat() (fs.FileInfo, error) {
+	return rwfs.NewFI(path.Base(tf.name), tf.size, time.Time{}, 0), nil
+}
+
+// Write is not supported on files read from the tar
+func (tf *tarFile) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: tf.name, Err: fs.ErrPermission}
+}
+
+func (tf *tarFile) open() error {
+	fh, err := tf.t.fs.Open(tf.t.file)
+	if err != nil {
+		return err
+	}
+	// seek directly to indexed content, otherwise scan the tar for the entry
+	if tf.offset >= 0 {
+		if s, ok := fh.(io.Seeker); ok {
+			if _, err := s.Seek(tf.offset, io.SeekStart); err == nil {
+				tf.fh = fh
+				tf.rdr = io.LimitReader(fh, tf.size)
+				return nil
+			}
+		}
+	}
+	rdr, _, err := tarReader(fh)
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	tr := tar.NewReader(rdr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			fh.Close()
+			return &fs.PathError{Op: "open", Path: tf.name, Err: fs.ErrNotExist}
+		} else if err != nil {
+			fh.Close()
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg && tarClean(hdr.Name) == tf.name {
+			tf.fh = fh
+			tf.rdr = tr
+			return nil
+		}
+	}
+}
+
+// Close is a noop for directories
+func (td *tarDir) Close() error {
+	return nil
+}
+
+// Read is not valid on a directory
+func (td *tarDir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: td.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the directory entries
+func (td *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		des := td.des[td.cur:]
+		td.cur = len(td.des)
+		return des, nil
+	}
+	if td.cur >= len(td.des) {
+		return []fs.DirEntry{}, io.EOF
+	}
+	end := td.cur + n
+	if end > len(td.des) {
+		end = len(td.des)
+	}
+	des := td.des[td.cur:end]
+	td.cur = end
+	return des, nil
+}
+
+// Stat returns details of the directory
+func (td *tarDir) Stat() (fs.FileInfo, error) {
+	return rwfs.NewFI(td.name, 4096, time.Time{}, fs.ModeDir), nil
+}
+
+// Write is not valid on a directory
+func (td *tarDir) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: td.name, Err: fs.ErrInvalid}
+}
+
+// readOnlyFile wraps an fs.File to satisfy rwfs.RWFile
+type readOnlyFile struct {
+	fs.File
+}
+
+func (rof *readOnlyFile) Write(b []byte) (int, error) {
+	return 0, fs.ErrPermission
+}
+
+// tarClean normalizes filenames found in a tar header
+func tarClean(name string) string {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// tarSparse returns true for sparse files, where the content in the tar does not match the file
+func tarSparse(hdr *tar.Header) bool {
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// posReader tracks the current offset of a ReadSeeker
+type posReader struct {
+	rs  io.ReadSeeker
+	pos int64
+}
+
+func (pr *posReader) Read(b []byte) (int, error) {
+	n, err := pr.rs.Read(b)
+	pr.pos += int64(n)
+	return n, err
+}
+
+func (pr *posReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := pr.rs.Seek(offset, whence)
+	if err == nil {
+		pr.pos = pos
+	}
+	return pos, err
+}
+
+// tarReader returns a reader for the tar content, decompressing when needed
+func tarReader(fh fs.File) (io.Reader, archive.CompressType, error) {
+	br := bufio.NewReader(fh)
+	head, err := br.Peek(10)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, archive.CompressNone, err
+	}
+	comp := archive.DetectCompression(head)
+	if comp == archive.CompressNone {
+		// when possible, read from the file directly to allow the tar reader to seek past entries
+		if s, ok := fh.(io.Seeker); ok {
+			if _, err := s.Seek(0, io.SeekStart); err == nil {
+				return fh, comp, nil
+			}
+		}
+		return br, comp, nil
+	}
+	rdr, err := archive.Decompress(br)
+	if err != nil {
+		return nil, comp, err
+	}
+	return rdr, comp, nil
+}
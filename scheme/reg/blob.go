@@ -8,6 +8,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	// crypto libraries included for go-digest
 	_ "crypto/sha256"
@@ -45,6 +49,26 @@ func (reg *Reg) BlobDelete(ctx context.Context, r ref.Ref, d types.Descriptor) e
 
 // BlobGet retrieves a blob from the repository, returning a blob reader
 func (reg *Reg) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
+	// split large blobs into parallel range requests when configured
+	host := reg.hostGet(r.Registry)
+	if host.BlobGetPar > 1 && d.Size > 0 && d.Digest != "" {
+		getMin := host.BlobGetMin
+		if getMin <= 0 {
+			getMin = reg.blobGetMin
+		}
+		if d.Size >= getMin {
+			b, err := reg.blobGetParallel(ctx, r, d, host.BlobGetPar)
+			if err == nil {
+				return b, nil
+			}
+			reg.log.WithFields(logrus.Fields{
+				"ref":    r.CommonName(),
+				"digest": d.Digest.String(),
+				"err":    err,
+			}).Debug("Parallel blob get failed, falling back to a single request")
+		}
+	}
+
 	// build/send request
 	req := &reghttp.Req{
 		Host: r.Registry,
@@ -100,6 +124,212 @@ func (reg *Reg) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blo
 	return b, nil
 }
 
+// blobGetParallel pulls a blob with concurrent range requests into a temp file
+func (reg *Reg) blobGetParallel(ctx context.Context, r ref.Ref, d types.Descriptor, par int) (blob.Reader, error) {
+	partSize := (d.Size + int64(par) - 1) / int64(par)
+	if partSize > blobGetPartMax {
+		partSize = blobGetPartMax
+	}
+	// the first range request verifies the registry supports ranges before creating the temp file
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := reg.blobGetRange(ctx, r, d, 0, partSize)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "regclient-blob-")
+	if err != nil {
+		resp.Close()
+		cancel()
+		return nil, err
+	}
+	pr := &blobParallelReader{
+		f:      f,
+		cancel: cancel,
+	}
+	for start := int64(0); start < d.Size; start += partSize {
+		size := partSize
+		if start+size > d.Size {
+			size = d.Size - start
+		}
+		pr.parts = append(pr.parts, &blobParallelPart{
+			start: start,
+			size:  size,
+			done:  make(chan struct{}),
+		})
+	}
+	// workers pull the remaining parts in order, the first part reuses the initial response
+	next := make(chan *blobParallelPart, len(pr.parts))
+	for _, p := range pr.parts[1:] {
+		next <- p
+	}
+	close(next)
+	pr.wg.Add(1)
+	go func() {
+		defer pr.wg.Done()
+		p := pr.parts[0]
+		p.err = reg.blobParallelFetch(ctx, r, d, f, p, resp)
+		close(p.done)
+	}()
+	for i := 1; i < par && i < len(pr.parts); i++ {
+		pr.wg.Add(1)
+		go func() {
+			defer pr.wg.Done()
+			for p := range next {
+				p.err = reg.blobParallelFetch(ctx, r, d, f, p, nil)
+				close(p.done)
+			}
+		}()
+	}
+
+	b := blob.NewReader(
+		blob.WithRef(r),
+		blob.WithReader(pr),
+		blob.WithDesc(types.Descriptor{
+			Digest: d.Digest,
+			Size:   d.Size,
+		}),
+		blob.WithHeader(resp.HTTPResponse().Header),
+	)
+	return b, nil
+}
+
+// blobGetRange sends a range request for part of a blob
+func (reg *Reg) blobGetRange(ctx context.Context, r ref.Ref, d types.Descriptor, start, size int64) (reghttp.Resp, error) {
+	req := &reghttp.Req{
+		Host: r.Registry,
+		APIs: map[string]reghttp.ReqAPI{
+			"": {
+				Method:     "GET",
+				Repository: r.Repository,
+				Path:       "blobs/" + d.Digest.String(),
+				Headers: http.Header{
+					"Range": {fmt.Sprintf("bytes=%d-%d", start, start+size-1)},
+				},
+			},
+		},
+	}
+	resp, err := reg.reghttp.Do(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob range, digest %s, ref %s: %w", d.Digest.String(), r.CommonName(), err)
+	}
+	if resp.HTTPResponse().StatusCode != http.StatusPartialContent {
+		resp.Close()
+		return nil, fmt.Errorf("failed to get blob range, digest %s, ref %s: %w", d.Digest.String(), r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+	}
+	return resp, nil
+}
+
+// blobParallelFetch writes a part of the blob to the temp file.
+// A failed request is retried with a new range request for the bytes not yet written.
+// An initial response for the part may be provided, otherwise a new range request is sent.
+func (reg *Reg) blobParallelFetch(ctx context.Context, r ref.Ref, d types.Descriptor, f *os.File, p *blobParallelPart, resp reghttp.Resp) error {
+	written := int64(0)
+	for try := 0; ; try++ {
+		var err error
+		if resp == nil {
+			resp, err = reg.blobGetRange(ctx, r, d, p.start+written, p.size-written)
+		}
+		if err == nil {
+			var n int64
+			n, err = blobParallelWrite(f, resp, p.start+written, p.size-written)
+			resp.Close()
+			resp = nil
+			written += n
+		}
+		if err == nil || try >= blobGetPartRetry || ctx.Err() != nil {
+			return err
+		}
+		reg.log.WithFields(logrus.Fields{
+			"ref":    r.CommonName(),
+			"digest": d.Digest.String(),
+			"offset": p.start + written,
+			"err":    err,
+		}).Debug("Retrying blob range")
+	}
+}
+
+// blobParallelWrite copies a range response into the temp file at the offset, returning the bytes written
+func blobParallelWrite(f *os.File, rdr io.Reader, start, size int64) (int64, error) {
+	n, err := io.Copy(&blobOffsetWriter{f: f, off: start}, io.LimitReader(rdr, size))
+	if err != nil {
+		return n, err
+	}
+	if n != size {
+		return n, fmt.Errorf("short read on blob range at offset %d, expected %d, received %d: %w", start, size, n, io.ErrUnexpectedEOF)
+	}
+	return n, nil
+}
+
+type blobOffsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (ow *blobOffsetWriter) Write(b []byte) (int, error) {
+	n, err := ow.f.WriteAt(b, ow.off)
+	ow.off += int64(n)
+	return n, err
+}
+
+type blobParallelPart struct {
+	start, size int64
+	done        chan struct{}
+	err         error
+}
+
+// blobParallelReader returns each part of the temp file in order as it is completed
+type blobParallelReader struct {
+	f      *os.File
+	parts  []*blobParallelPart
+	cur    int
+	rdr    io.Reader
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func (pr *blobParallelReader) Read(b []byte) (int, error) {
+	for {
+		if pr.rdr == nil {
+			if pr.cur >= len(pr.parts) {
+				return 0, io.EOF
+			}
+			p := pr.parts[pr.cur]
+			<-p.done
+			if p.err != nil {
+				return 0, p.err
+			}
+			pr.rdr = io.NewSectionReader(pr.f, p.start, p.size)
+		}
+		n, err := pr.rdr.Read(b)
+		if err == io.EOF {
+			pr.rdr = nil
+			pr.cur++
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (pr *blobParallelReader) Close() error {
+	if pr.closed {
+		return nil
+	}
+	pr.closed = true
+	pr.cancel()
+	pr.wg.Wait()
+	name := pr.f.Name()
+	err := pr.f.Close()
+	if errRm := os.Remove(name); errRm != nil && err == nil {
+		err = errRm
+	}
+	return err
+}
+
 // BlobHead is used to verify if a blob exists and is accessible
 func (reg *Reg) BlobHead(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
 	// build/send request
@@ -171,6 +401,7 @@ func (reg *Reg) BlobMount(ctx context.Context, rSrc ref.Ref, rTgt ref.Ref, d typ
 // This will attempt an anonymous blob mount first which some registries may support.
 // It will then try doing a full put of the blob without chunking (most widely supported).
 // If the full put fails, it will fall back to a chunked upload (useful for flaky networks).
+// With an upload store, blobs larger than a chunk are always sent with a chunked upload that can be resumed.
 func (reg *Reg) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
 	var putURL *url.URL
 	var err error
@@ -179,6 +410,19 @@ func (reg *Reg) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr
 		d.Size = -1
 	}
 
+	// resume a previously interrupted chunked upload
+	if reg.uploadStore != nil && d.Digest != "" {
+		resumeURL, offset, err := reg.blobUploadResume(ctx, r, d)
+		if err == nil {
+			return reg.blobPutUploadChunked(ctx, r, d, resumeURL, offset, rdr)
+		}
+		reg.log.WithFields(logrus.Fields{
+			"ref":    r.CommonName(),
+			"digest": d.Digest.String(),
+			"err":    err,
+		}).Debug("Unable to resume upload")
+	}
+
 	// attempt an anonymous blob mount
 	if d.Digest != "" && d.Size > 0 {
 		putURL, _, err = reg.blobMount(ctx, r, d, ref.Ref{})
@@ -208,6 +452,14 @@ func (reg *Reg) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr
 		if maxPut > 0 && d.Size > maxPut {
 			tryPut = false
 		}
+		// upload state is only saved between chunks, so blobs larger than a chunk skip the full put to be resumable
+		chunkSize := host.BlobChunk
+		if chunkSize <= 0 {
+			chunkSize = reg.blobChunkSize
+		}
+		if reg.uploadStore != nil && d.Size > chunkSize {
+			tryPut = false
+		}
 	}
 	if tryPut {
 		err = reg.blobPutUploadFull(ctx, r, d, putURL, rdr)
@@ -226,7 +478,7 @@ func (reg *Reg) BlobPut(ctx context.Context, r ref.Ref, d types.Descriptor, rdr
 	}
 
 	// send a chunked upload if full upload not possible or too large
-	return reg.blobPutUploadChunked(ctx, r, putURL, rdr)
+	return reg.blobPutUploadChunked(ctx, r, d, putURL, 0, rdr)
 }
 
 func (reg *Reg) blobGetUploadURL(ctx context.Context, r ref.Ref) (*url.URL, error) {
@@ -378,7 +630,7 @@ func (reg *Reg) blobPutUploadFull(ctx context.Context, r ref.Ref, d types.Descri
 	return nil
 }
 
-func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url.URL, rdr io.Reader) (types.Descriptor, error) {
+func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, dIn types.Descriptor, putURL *url.URL, offset int64, rdr io.Reader) (types.Descriptor, error) {
 	host := reg.hostGet(r.Registry)
 	bufSize := host.BlobChunk
 	if bufSize <= 0 {
@@ -393,6 +645,18 @@ func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url
 	digestRdr := io.TeeReader(rdr, digester.Hash())
 	finalChunk := false
 	chunkStart := int64(0)
+	// skip content already accepted by the registry, it is still included in the digest
+	if offset > 0 {
+		n, err := io.CopyN(io.Discard, digestRdr, offset)
+		if err != nil {
+			return types.Descriptor{}, fmt.Errorf("failed to skip resumed content, ref %s, read %d of %d bytes: %w", r.CommonName(), n, offset, err)
+		}
+		chunkStart = offset
+	}
+	uploadKey := ""
+	if reg.uploadStore != nil && dIn.Digest != "" {
+		uploadKey = uploadKeyRef(r, dIn.Digest)
+	}
 	bodyFunc := func() (io.ReadCloser, error) {
 		// reset to the start on every new read
 		_, err := bufRdr.Seek(0, io.SeekStart)
@@ -477,6 +741,15 @@ func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url
 				}
 				chunkURL = *parseURL
 			}
+			if uploadKey != "" {
+				err = reg.uploadStore.Set(uploadKey, UploadState{Location: chunkURL.String(), Offset: chunkStart})
+				if err != nil {
+					reg.log.WithFields(logrus.Fields{
+						"ref": r.CommonName(),
+						"err": err,
+					}).Warn("Failed to save upload state")
+				}
+			}
 		}
 	}
 
@@ -516,10 +789,96 @@ func (reg *Reg) blobPutUploadChunked(ctx context.Context, r ref.Ref, putURL *url
 	if resp.HTTPResponse().StatusCode != 201 && resp.HTTPResponse().StatusCode != 204 {
 		return types.Descriptor{}, fmt.Errorf("failed to send blob (chunk digest), digest %s, ref %s: %w", d, r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
 	}
+	if uploadKey != "" {
+		err = reg.uploadStore.Delete(uploadKey)
+		if err != nil {
+			reg.log.WithFields(logrus.Fields{
+				"ref": r.CommonName(),
+				"err": err,
+			}).Warn("Failed to delete upload state")
+		}
+	}
 
 	return types.Descriptor{Digest: d, Size: chunkStart}, nil
 }
 
+// blobUploadResume queries the registry for the progress of a saved upload session
+func (reg *Reg) blobUploadResume(ctx context.Context, r ref.Ref, d types.Descriptor) (*url.URL, int64, error) {
+	key := uploadKeyRef(r, d.Digest)
+	state, err := reg.uploadStore.Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	// any failure discards the saved state, the upload restarts from the beginning
+	offset, resumeURL, err := func() (int64, *url.URL, error) {
+		stateURL, err := url.Parse(state.Location)
+		if err != nil {
+			return 0, nil, err
+		}
+		req := &reghttp.Req{
+			Host: r.Registry,
+			APIs: map[string]reghttp.ReqAPI{
+				"": {
+					Method:     "GET",
+					Repository: r.Repository,
+					DirectURL:  stateURL,
+				},
+			},
+			NoMirrors: true,
+		}
+		resp, err := reg.reghttp.Do(ctx, req)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to get upload status, ref %s: %w", r.CommonName(), err)
+		}
+		defer resp.Close()
+		if resp.HTTPResponse().StatusCode != 204 {
+			return 0, nil, fmt.Errorf("failed to get upload status, ref %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+		}
+		offset, err := blobUploadOffset(resp.HTTPResponse().Header.Get("Range"), state.Offset)
+		if err != nil {
+			return 0, nil, err
+		}
+		if location := resp.HTTPResponse().Header.Get("Location"); location != "" {
+			stateURL, err = resp.HTTPResponse().Request.URL.Parse(location)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		return offset, stateURL, nil
+	}()
+	if err != nil {
+		_ = reg.uploadStore.Delete(key)
+		return nil, 0, err
+	}
+	reg.log.WithFields(logrus.Fields{
+		"ref":    r.CommonName(),
+		"digest": d.Digest.String(),
+		"offset": offset,
+	}).Info("Resuming blob upload")
+	return resumeURL, offset, nil
+}
+
+// blobUploadOffset parses the Range header of an upload status, returning the next byte to send.
+// Registries report "0-0" for a session without any data, so that range is only trusted when the saved offset is 1.
+func blobUploadOffset(rangeHeader string, saved int64) (int64, error) {
+	if rangeHeader == "" {
+		return 0, fmt.Errorf("missing range header")
+	}
+	rangeHeader = strings.TrimPrefix(rangeHeader, "bytes=")
+	rSplit := strings.SplitN(rangeHeader, "-", 2)
+	if len(rSplit) < 2 || rSplit[0] != "0" {
+		return 0, fmt.Errorf("invalid range header: %s", rangeHeader)
+	}
+	end, err := strconv.ParseInt(rSplit[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid range header: %s: %w", rangeHeader, err)
+	}
+	if end == 0 && saved != 1 {
+		return 0, nil
+	}
+	return end + 1, nil
+}
+
 // TODO: just take a putURL rather than the uuid and call a delete on that url
 func (reg *Reg) blobUploadCancel(ctx context.Context, r ref.Ref, uuid string) error {
 	if uuid == "" {
@@ -546,42 +905,3 @@ func (reg *Reg) blobUploadCancel(ctx context.Context, r ref.Ref, uuid string) er
 	}
 	return nil
 }
-
-// // blobUploadStatus provides a response with headers indicating the progress of an upload
-// func (reg *Reg) blobUploadStatus(ctx context.Context, r ref.Ref, putURL *url.URL) (*http.Response, error) {
-// 	req := &reghttp.Req{
-// 		Host: r.Registry,
-// 		APIs: map[string]reghttp.ReqAPI{
-// 			"": {
-// 				Method:     "GET",
-// 				Repository: r.Repository,
-// 				DirectURL:  putURL,
-// 			},
-// 		},
-// 		NoMirrors: true,
-// 	}
-// 	resp, err := reg.reghttp.Do(ctx, req)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("failed to get upload status: %v", err)
-// 	}
-// 	defer resp.Close()
-// 	if resp.HTTPResponse().StatusCode != 204 {
-// 		return resp.HTTPResponse(), fmt.Errorf("failed to get upload status: %v", reghttp.HttpError(resp.HTTPResponse().StatusCode))
-// 	}
-// 	return resp.HTTPResponse(), nil
-// }
-
-// func blobUploadCurBytes(resp *http.Response) (int64, error) {
-// 	if resp == nil {
-// 		return 0, fmt.Errorf("Missing response")
-// 	}
-// 	r := resp.Header.Get("Range")
-// 	if r == "" {
-// 		return 0, fmt.Errorf("Missing range header")
-// 	}
-// 	rSplit := strings.SplitN(r, "-", 2)
-// 	if len(rSplit) < 2 {
-// 		return 0, fmt.Errorf("Missing offset in range header")
-// 	}
-// 	return strconv.ParseInt(rSplit[2], 10, 64)
-// }
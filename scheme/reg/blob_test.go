@@ -6,12 +6,15 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/google/uuid"
@@ -361,6 +364,155 @@ func TestBlobGet(t *testing.T) {
 
 }
 
+func TestBlobGetParallel(t *testing.T) {
+	rangeRepo := "/proj/range"
+	noRangeRepo := "/proj/norange"
+	retryRepo := "/proj/retry"
+	ctx := context.Background()
+	seed := time.Now().UTC().Unix()
+	t.Logf("Using seed %d", seed)
+	blobLen := 4096
+	partLen := 1024
+	d1, blob1 := reqresp.NewRandomBlob(blobLen, seed)
+	rangeEntry := func(repo string, start, end int) reqresp.ReqResp {
+		return reqresp.ReqResp{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   fmt.Sprintf("GET range %d-%d", start, end),
+				Method: "GET",
+				Path:   "/v2" + repo + "/blobs/" + d1.String(),
+				Headers: http.Header{
+					"Range": {fmt.Sprintf("bytes=%d-%d", start, end)},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusPartialContent,
+				Body:   blob1[start : end+1],
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", end-start+1)},
+					"Content-Range":  {fmt.Sprintf("bytes %d-%d/%d", start, end, blobLen)},
+					"Content-Type":   {"application/octet-stream"},
+				},
+			},
+		}
+	}
+	rrs := []reqresp.ReqResp{}
+	// the second part stops early once, and the retry requests the remaining bytes
+	shortLen := partLen / 2
+	rrs = append(rrs, reqresp.ReqResp{
+		ReqEntry: reqresp.ReqEntry{
+			Name:     "GET range short read",
+			DelOnUse: true,
+			Method:   "GET",
+			Path:     "/v2" + retryRepo + "/blobs/" + d1.String(),
+			Headers: http.Header{
+				"Range": {fmt.Sprintf("bytes=%d-%d", partLen, partLen*2-1)},
+			},
+		},
+		RespEntry: reqresp.RespEntry{
+			Status: http.StatusPartialContent,
+			Body:   blob1[partLen : partLen+shortLen],
+			Headers: http.Header{
+				"Content-Length": {fmt.Sprintf("%d", partLen)},
+				"Content-Range":  {fmt.Sprintf("bytes %d-%d/%d", partLen, partLen*2-1, blobLen)},
+				"Content-Type":   {"application/octet-stream"},
+			},
+		},
+	})
+	rrs = append(rrs, rangeEntry(retryRepo, partLen+shortLen, partLen*2-1))
+	for start := 0; start < blobLen; start += partLen {
+		end := start + partLen - 1
+		rrs = append(rrs, rangeEntry(rangeRepo, start, end))
+		if start != partLen {
+			rrs = append(rrs, rangeEntry(retryRepo, start, end))
+		}
+	}
+	rrs = append(rrs, reqresp.ReqResp{
+		ReqEntry: reqresp.ReqEntry{
+			Name:   "GET ignoring range",
+			Method: "GET",
+			Path:   "/v2" + noRangeRepo + "/blobs/" + d1.String(),
+		},
+		RespEntry: reqresp.RespEntry{
+			Status: http.StatusOK,
+			Body:   blob1,
+			Headers: http.Header{
+				"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+				"Content-Type":          {"application/octet-stream"},
+				"Docker-Content-Digest": {d1.String()},
+			},
+		},
+	})
+	rrs = append(rrs, reqresp.BaseEntries...)
+	// create a server
+	ts := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer ts.Close()
+	// setup the reg
+	tsURL, _ := url.Parse(ts.URL)
+	tsHost := tsURL.Host
+	rcHosts := []*config.Host{
+		{
+			Name:       tsHost,
+			Hostname:   tsHost,
+			TLS:        config.TLSDisabled,
+			BlobGetMin: int64(partLen),
+			BlobGetPar: 4,
+		},
+	}
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.WarnLevel,
+	}
+	delayInit, _ := time.ParseDuration("0.05s")
+	delayMax, _ := time.ParseDuration("0.10s")
+	reg := New(
+		WithConfigHosts(rcHosts),
+		WithLog(log),
+		WithDelay(delayInit, delayMax),
+	)
+
+	tests := []struct {
+		name string
+		repo string
+	}{
+		{
+			name: "Range",
+			repo: rangeRepo,
+		},
+		{
+			name: "Fallback",
+			repo: noRangeRepo,
+		},
+		{
+			name: "Retry",
+			repo: retryRepo,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ref.New(tsURL.Host + tt.repo)
+			if err != nil {
+				t.Fatalf("Failed creating ref: %v", err)
+			}
+			br, err := reg.BlobGet(ctx, r, types.Descriptor{Digest: d1, Size: int64(blobLen)})
+			if err != nil {
+				t.Fatalf("Failed running BlobGet: %v", err)
+			}
+			brBlob, err := ioutil.ReadAll(br)
+			if err != nil {
+				t.Fatalf("Failed reading blob: %v", err)
+			}
+			if err := br.Close(); err != nil {
+				t.Errorf("Failed closing blob: %v", err)
+			}
+			if !bytes.Equal(blob1, brBlob) {
+				t.Errorf("Blob does not match")
+			}
+		})
+	}
+}
+
 func TestBlobPut(t *testing.T) {
 	blobRepo := "/proj/repo"
 	// privateRepo := "/proj/private"
@@ -857,3 +1009,522 @@ func TestBlobPut(t *testing.T) {
 	})
 
 }
+
+func TestBlobPutResume(t *testing.T) {
+	blobRepo := "/proj/resume"
+	staleRepo := "/proj/stale"
+	emptyRepo := "/proj/empty"
+	noRangeRepo := "/proj/norange"
+	interruptRepo := "/proj/interrupt"
+	ctx := context.Background()
+	seed := time.Now().UTC().Unix()
+	t.Logf("Using seed %d", seed)
+	blobChunk := 512
+	blobLen := 1024
+	d1, blob1 := reqresp.NewRandomBlob(blobLen, seed)
+	uuid1 := uuid.New()
+	uuid2 := uuid.New()
+	uuidStale := uuid.New()
+	uuidEmpty := uuid.New()
+	uuidNoRange := uuid.New()
+	uuid3 := uuid.New()
+	uuidInterrupt := uuid.New()
+	rrs := []reqresp.ReqResp{
+		// upload status for the interrupted session
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET status for d1",
+				Method: "GET",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid1.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNoContent,
+				Headers: http.Header{
+					"Range":    {fmt.Sprintf("0-%d", blobChunk-1)},
+					"Location": {uuid1.String() + "?chunk=2"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 2 for d1",
+				Method: "PATCH",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid1.String(),
+				Query: map[string][]string{
+					"chunk": {"2"},
+				},
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobLen-blobChunk)},
+					"Content-Range":  {fmt.Sprintf("%d-%d", blobChunk, blobLen-1)},
+				},
+				Body: blob1[blobChunk:],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid1.String() + "?chunk=3"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for patched d1",
+				Method: "PUT",
+				Path:   "/v2" + blobRepo + "/blobs/uploads/" + uuid1.String(),
+				Query: map[string][]string{
+					"digest": {d1.String()},
+					"chunk":  {"3"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+				Headers: http.Header{
+					"Content-Length":        {"0"},
+					"Location":              {"/v2" + blobRepo + "/blobs/" + d1.String()},
+					"Docker-Content-Digest": {d1.String()},
+				},
+			},
+		},
+		// a session without any data reports a range of 0-0
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET status for empty",
+				Method: "GET",
+				Path:   "/v2" + emptyRepo + "/blobs/uploads/" + uuidEmpty.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNoContent,
+				Headers: http.Header{
+					"Range":    {"0-0"},
+					"Location": {uuidEmpty.String() + "?chunk=1"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 1 for empty",
+				Method: "PATCH",
+				Path:   "/v2" + emptyRepo + "/blobs/uploads/" + uuidEmpty.String(),
+				Query: map[string][]string{
+					"chunk": {"1"},
+				},
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobChunk)},
+					"Content-Range":  {fmt.Sprintf("0-%d", blobChunk-1)},
+				},
+				Body: blob1[:blobChunk],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuidEmpty.String() + "?chunk=2"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PATCH 2 for empty",
+				Method: "PATCH",
+				Path:   "/v2" + emptyRepo + "/blobs/uploads/" + uuidEmpty.String(),
+				Query: map[string][]string{
+					"chunk": {"2"},
+				},
+				Headers: http.Header{
+					"Content-Length": {fmt.Sprintf("%d", blobLen-blobChunk)},
+					"Content-Range":  {fmt.Sprintf("%d-%d", blobChunk, blobLen-1)},
+				},
+				Body: blob1[blobChunk:],
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuidEmpty.String() + "?chunk=3"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for empty",
+				Method: "PUT",
+				Path:   "/v2" + emptyRepo + "/blobs/uploads/" + uuidEmpty.String(),
+				Query: map[string][]string{
+					"digest": {d1.String()},
+					"chunk":  {"3"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+				Headers: http.Header{
+					"Content-Length":        {"0"},
+					"Location":              {"/v2" + emptyRepo + "/blobs/" + d1.String()},
+					"Docker-Content-Digest": {d1.String()},
+				},
+			},
+		},
+		// a status without a range header cannot be trusted and restarts the upload
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET status for norange",
+				Method: "GET",
+				Path:   "/v2" + noRangeRepo + "/blobs/uploads/" + uuidNoRange.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNoContent,
+				Headers: http.Header{
+					"Location": {uuidNoRange.String() + "?chunk=2"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST for norange",
+				Method: "POST",
+				Path:   "/v2" + noRangeRepo + "/blobs/uploads/",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid3.String()},
+				},
+			},
+		},
+		// the stale session is unknown to the registry and restarts the upload
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET status for stale",
+				Method: "GET",
+				Path:   "/v2" + staleRepo + "/blobs/uploads/" + uuidStale.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNotFound,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST for stale",
+				Method: "POST",
+				Path:   "/v2" + staleRepo + "/blobs/uploads/",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusAccepted,
+				Headers: http.Header{
+					"Content-Length": {"0"},
+					"Location":       {uuid2.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "PUT for stale",
+				Method: "PUT",
+				Path:   "/v2" + staleRepo + "/blobs/uploads/" + uuid2.String(),
+				Query: map[string][]string{
+					"digest": {d1.String()},
+				},
+				Body: blob1,
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+				Headers: http.Header{
+					"Content-Length":        {"0"},
+					"Location":              {"/v2" + staleRepo + "/blobs/" + d1.String()},
+					"Docker-Content-Digest": {d1.String()},
+				},
+			},
+		},
+	}
+	// a restarted upload is sent in chunks so it can be resumed again
+	chunkEntries := func(name, repo, uuid string) []reqresp.ReqResp {
+		return []reqresp.ReqResp{
+			{
+				ReqEntry: reqresp.ReqEntry{
+					Name:   "PATCH 1 for " + name,
+					Method: "PATCH",
+					Path:   "/v2" + repo + "/blobs/uploads/" + uuid,
+					Headers: http.Header{
+						"Content-Length": {fmt.Sprintf("%d", blobChunk)},
+						"Content-Range":  {fmt.Sprintf("0-%d", blobChunk-1)},
+					},
+					Body: blob1[:blobChunk],
+				},
+				RespEntry: reqresp.RespEntry{
+					Status: http.StatusAccepted,
+					Headers: http.Header{
+						"Content-Length": {"0"},
+						"Location":       {uuid + "?chunk=2"},
+					},
+				},
+			},
+			{
+				ReqEntry: reqresp.ReqEntry{
+					Name:   "PATCH 2 for " + name,
+					Method: "PATCH",
+					Path:   "/v2" + repo + "/blobs/uploads/" + uuid,
+					Query: map[string][]string{
+						"chunk": {"2"},
+					},
+					Headers: http.Header{
+						"Content-Length": {fmt.Sprintf("%d", blobLen-blobChunk)},
+						"Content-Range":  {fmt.Sprintf("%d-%d", blobChunk, blobLen-1)},
+					},
+					Body: blob1[blobChunk:],
+				},
+				RespEntry: reqresp.RespEntry{
+					Status: http.StatusAccepted,
+					Headers: http.Header{
+						"Content-Length": {"0"},
+						"Location":       {uuid + "?chunk=3"},
+					},
+				},
+			},
+			{
+				ReqEntry: reqresp.ReqEntry{
+					Name:   "PUT for " + name,
+					Method: "PUT",
+					Path:   "/v2" + repo + "/blobs/uploads/" + uuid,
+					Query: map[string][]string{
+						"digest": {d1.String()},
+						"chunk":  {"3"},
+					},
+				},
+				RespEntry: reqresp.RespEntry{
+					Status: http.StatusCreated,
+					Headers: http.Header{
+						"Content-Length":        {"0"},
+						"Location":              {"/v2" + repo + "/blobs/" + d1.String()},
+						"Docker-Content-Digest": {d1.String()},
+					},
+				},
+			},
+		}
+	}
+	rrs = append(rrs, chunkEntries("norange", noRangeRepo, uuid3.String())...)
+	rrs = append(rrs, chunkEntries("stale", staleRepo, uuid2.String())...)
+	// an interrupted upload saves the state after each chunk and resumes on the next put
+	rrs = append(rrs, reqresp.ReqResp{
+		ReqEntry: reqresp.ReqEntry{
+			Name:   "POST for interrupt",
+			Method: "POST",
+			Path:   "/v2" + interruptRepo + "/blobs/uploads/",
+		},
+		RespEntry: reqresp.RespEntry{
+			Status: http.StatusAccepted,
+			Headers: http.Header{
+				"Content-Length": {"0"},
+				"Location":       {uuidInterrupt.String()},
+			},
+		},
+	}, reqresp.ReqResp{
+		ReqEntry: reqresp.ReqEntry{
+			Name:   "GET status for interrupt",
+			Method: "GET",
+			Path:   "/v2" + interruptRepo + "/blobs/uploads/" + uuidInterrupt.String(),
+			Query: map[string][]string{
+				"chunk": {"2"},
+			},
+		},
+		RespEntry: reqresp.RespEntry{
+			Status: http.StatusNoContent,
+			Headers: http.Header{
+				"Range":    {fmt.Sprintf("0-%d", blobChunk-1)},
+				"Location": {uuidInterrupt.String() + "?chunk=2"},
+			},
+		},
+	})
+	rrs = append(rrs, chunkEntries("interrupt", interruptRepo, uuidInterrupt.String())...)
+	rrs = append(rrs, reqresp.BaseEntries...)
+	// create a server
+	ts := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer ts.Close()
+	// setup the reg
+	tsURL, _ := url.Parse(ts.URL)
+	tsHost := tsURL.Host
+	rcHosts := []*config.Host{
+		{
+			Name:      tsHost,
+			Hostname:  tsHost,
+			TLS:       config.TLSDisabled,
+			BlobChunk: int64(blobChunk),
+			BlobMax:   int64(-1),
+		},
+	}
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.WarnLevel,
+	}
+	delayInit, _ := time.ParseDuration("0.05s")
+	delayMax, _ := time.ParseDuration("0.10s")
+	store := NewUploadStoreDir(t.TempDir())
+	reg := New(
+		WithConfigHosts(rcHosts),
+		WithLog(log),
+		WithDelay(delayInit, delayMax),
+		WithUploadStore(store),
+	)
+
+	tests := []struct {
+		name   string
+		repo   string
+		uuid   string
+		offset int64
+	}{
+		{
+			name:   "Resume",
+			repo:   blobRepo,
+			uuid:   uuid1.String(),
+			offset: int64(blobChunk),
+		},
+		{
+			name: "Empty",
+			repo: emptyRepo,
+			uuid: uuidEmpty.String(),
+		},
+		{
+			name:   "NoRange",
+			repo:   noRangeRepo,
+			uuid:   uuidNoRange.String(),
+			offset: int64(blobChunk),
+		},
+		{
+			name:   "Stale",
+			repo:   staleRepo,
+			uuid:   uuidStale.String(),
+			offset: int64(blobChunk),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ref.New(tsURL.Host + tt.repo)
+			if err != nil {
+				t.Fatalf("Failed creating ref: %v", err)
+			}
+			key := uploadKeyRef(r, d1)
+			err = store.Set(key, UploadState{
+				Location: ts.URL + "/v2" + tt.repo + "/blobs/uploads/" + tt.uuid,
+				Offset:   tt.offset,
+			})
+			if err != nil {
+				t.Fatalf("Failed to set upload state: %v", err)
+			}
+			dp, err := reg.BlobPut(ctx, r, types.Descriptor{Digest: d1, Size: int64(blobLen)}, bytes.NewReader(blob1))
+			if err != nil {
+				t.Fatalf("Failed running BlobPut: %v", err)
+			}
+			if dp.Digest != d1 {
+				t.Errorf("Digest mismatch, expected %s, received %s", d1.String(), dp.Digest.String())
+			}
+			if dp.Size != int64(blobLen) {
+				t.Errorf("Content length mismatch, expected %d, received %d", blobLen, dp.Size)
+			}
+			if _, err := store.Get(key); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Upload state not removed: %v", err)
+			}
+		})
+	}
+	t.Run("Interrupt", func(t *testing.T) {
+		r, err := ref.New(tsURL.Host + interruptRepo)
+		if err != nil {
+			t.Fatalf("Failed creating ref: %v", err)
+		}
+		key := uploadKeyRef(r, d1)
+		// the source fails after the first chunk, a reader that cannot seek cannot retry with a full put
+		rdr := io.MultiReader(bytes.NewReader(blob1[:blobChunk]), iotest.ErrReader(errors.New("connection reset")))
+		_, err = reg.BlobPut(ctx, r, types.Descriptor{Digest: d1, Size: int64(blobLen)}, rdr)
+		if err == nil {
+			t.Fatalf("BlobPut did not fail")
+		}
+		state, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Upload state not saved: %v", err)
+		}
+		if state.Offset != int64(blobChunk) || state.Location != ts.URL+"/v2"+interruptRepo+"/blobs/uploads/"+uuidInterrupt.String()+"?chunk=2" {
+			t.Errorf("Unexpected upload state: %v", state)
+		}
+		dp, err := reg.BlobPut(ctx, r, types.Descriptor{Digest: d1, Size: int64(blobLen)}, bytes.NewReader(blob1))
+		if err != nil {
+			t.Fatalf("Failed running BlobPut: %v", err)
+		}
+		if dp.Digest != d1 || dp.Size != int64(blobLen) {
+			t.Errorf("Descriptor mismatch, expected %s/%d, received %s/%d", d1.String(), blobLen, dp.Digest.String(), dp.Size)
+		}
+		if _, err := store.Get(key); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Upload state not removed: %v", err)
+		}
+	})
+}
+
+func TestBlobUploadOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		saved   int64
+		expect  int64
+		wantErr bool
+	}{
+		{
+			name:    "missing",
+			header:  "",
+			saved:   512,
+			wantErr: true,
+		},
+		{
+			name:   "chunk",
+			header: "0-511",
+			saved:  512,
+			expect: 512,
+		},
+		{
+			name:   "bytes prefix",
+			header: "bytes=0-511",
+			saved:  512,
+			expect: 512,
+		},
+		{
+			name:   "empty session",
+			header: "0-0",
+			saved:  0,
+			expect: 0,
+		},
+		{
+			name:   "single byte",
+			header: "0-0",
+			saved:  1,
+			expect: 1,
+		},
+		{
+			name:    "invalid start",
+			header:  "1-511",
+			saved:   512,
+			wantErr: true,
+		},
+		{
+			name:    "invalid end",
+			header:  "0-abc",
+			saved:   512,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := blobUploadOffset(tt.header, tt.saved)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("did not receive expected error, offset %d", offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if offset != tt.expect {
+				t.Errorf("offset mismatch, expected %d, received %d", tt.expect, offset)
+			}
+		})
+	}
+}
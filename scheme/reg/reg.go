@@ -17,6 +17,12 @@ const (
 	DefaultBlobChunk = 1024 * 1024
 	// DefaultBlobMax is disabled to support registries without chunked upload support
 	DefaultBlobMax = -1
+	// DefaultBlobGetMin is the blob size before a pull is split into parallel range requests
+	DefaultBlobGetMin = 100 * 1024 * 1024
+	// blobGetPartMax limits the size of each range request in a parallel pull
+	blobGetPartMax = 256 * 1024 * 1024
+	// blobGetPartRetry is the number of times a failed range request in a parallel pull is retried
+	blobGetPartRetry = 3
 )
 
 // Reg is used for interacting with remote registry servers
@@ -27,6 +33,8 @@ type Reg struct {
 	hosts         map[string]*config.Host
 	blobChunkSize int64
 	blobMaxPut    int64
+	blobGetMin    int64
+	uploadStore   UploadStore
 	mu            sync.Mutex
 }
 
@@ -39,6 +47,7 @@ func New(opts ...Opts) *Reg {
 		reghttpOpts:   []reghttp.Opts{},
 		blobChunkSize: DefaultBlobChunk,
 		blobMaxPut:    DefaultBlobMax,
+		blobGetMin:    DefaultBlobGetMin,
 		hosts:         map[string]*config.Host{},
 	}
 	for _, opt := range opts {
@@ -144,6 +153,13 @@ func WithTransport(t *http.Transport) Opts {
 	}
 }
 
+// WithUploadStore saves the state of chunked uploads to resume after an interruption
+func WithUploadStore(store UploadStore) Opts {
+	return func(r *Reg) {
+		r.uploadStore = store
+	}
+}
+
 // WithUserAgent sets a user agent header
 func WithUserAgent(ua string) Opts {
 	return func(r *Reg) {
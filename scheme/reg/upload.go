@@ -0,0 +1,110 @@
+package reg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// UploadState is the progress of a chunked blob upload
+type UploadState struct {
+	Location string `json:"location"` // url of the upload session
+	Offset   int64  `json:"offset"`   // number of bytes accepted by the registry
+}
+
+// UploadStore persists the state of chunked uploads so they may be resumed after an interruption.
+// Keys are unique to the registry, repository, and digest of the blob.
+type UploadStore interface {
+	Get(key string) (UploadState, error)
+	Set(key string, state UploadState) error
+	Delete(key string) error
+}
+
+type uploadStoreDir struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewUploadStoreDir returns an UploadStore saving each upload in a json file within dir
+func NewUploadStoreDir(dir string) UploadStore {
+	return &uploadStoreDir{dir: dir}
+}
+
+// Get returns the upload state, fs.ErrNotExist is returned for an unknown key
+func (u *uploadStoreDir) Get(key string) (UploadState, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	state := UploadState{}
+	b, err := os.ReadFile(u.file(key))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return state, fmt.Errorf("failed to parse upload state %s: %w", key, err)
+	}
+	return state, nil
+}
+
+// Set saves the upload state
+func (u *uploadStoreDir) Set(key string, state UploadState) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(u.dir, 0700)
+	if err != nil {
+		return err
+	}
+	// write to a temp file and rename to avoid a partial state file
+	f, err := os.CreateTemp(u.dir, "upload-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	_, err = f.Write(b)
+	errC := f.Close()
+	if err == nil {
+		err = errC
+	}
+	if err == nil {
+		err = os.Rename(tmpName, u.file(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the upload state
+func (u *uploadStoreDir) Delete(key string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	err := os.Remove(u.file(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (u *uploadStoreDir) file(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(u.dir, hex.EncodeToString(h[:])+".json")
+}
+
+// uploadKeyRef returns the key used to track an upload in the UploadStore
+func uploadKeyRef(r ref.Ref, d digest.Digest) string {
+	return r.Registry + "/" + r.Repository + "@" + d.String()
+}
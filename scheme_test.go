@@ -0,0 +1,66 @@
+package regclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/scheme/ocidir"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestWithScheme(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	err = ref.RegisterScheme("custom", nil)
+	if err != nil {
+		t.Fatalf("failed to register scheme: %v", err)
+	}
+	defer ref.UnregisterScheme("custom")
+	fsCustom := rwfs.MemNew()
+	rc := New(
+		WithFS(fsMem),
+		WithScheme("custom", ocidir.New(ocidir.WithFS(fsCustom))),
+	)
+	rSrc, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rTgt, err := ref.New("custom://copy:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	err = rc.ImageCopy(ctx, rSrc, rTgt)
+	if err != nil {
+		t.Fatalf("failed to copy to custom scheme: %v", err)
+	}
+	mSrc, err := rc.ManifestHead(ctx, rSrc)
+	if err != nil {
+		t.Fatalf("failed to head source: %v", err)
+	}
+	mTgt, err := rc.ManifestHead(ctx, rTgt)
+	if err != nil {
+		t.Fatalf("failed to head target: %v", err)
+	}
+	if mSrc.GetDescriptor().Digest != mTgt.GetDescriptor().Digest {
+		t.Errorf("digest mismatch, expected %s, received %s", mSrc.GetDescriptor().Digest, mTgt.GetDescriptor().Digest)
+	}
+	err = rc.Close(ctx, rTgt)
+	if err != nil {
+		t.Errorf("failed to close: %v", err)
+	}
+	// verify content was written to the custom scheme's filesystem
+	_, err = rwfs.Stat(fsCustom, "copy/index.json")
+	if err != nil {
+		t.Errorf("index missing from custom scheme: %v", err)
+	}
+	_, err = rwfs.Stat(fsMem, "copy/index.json")
+	if err == nil {
+		t.Errorf("custom scheme wrote to the regclient filesystem")
+	}
+}
@@ -0,0 +1,58 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// LoadPrivateKey parses a PEM encoded ECDSA or ed25519 private key.
+// Encrypted keys are not supported.
+func LoadPrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", ErrKeyUnsupported)
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		}
+		return nil, fmt.Errorf("private key type %T: %w", key, ErrKeyUnsupported)
+	}
+	return nil, fmt.Errorf("private key block \"%s\": %w", block.Type, ErrKeyUnsupported)
+}
+
+// LoadPublicKey parses a PEM encoded ECDSA or ed25519 public key
+func LoadPublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", ErrKeyUnsupported)
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("public key block \"%s\": %w", block.Type, ErrKeyUnsupported)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return k, nil
+	case ed25519.PublicKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("public key type %T: %w", key, ErrKeyUnsupported)
+}
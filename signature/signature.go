@@ -0,0 +1,436 @@
+// Package signature signs and verifies images using the cosign simple signing format.
+// Keys are loaded from local files, keyless signing and transparency logs are not supported.
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+)
+
+const (
+	// MediaTypeSimpleSigning is the media type of a cosign signature payload
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// ArtifactTypeSignature is the artifact type of cosign signatures pushed as a referrer
+	ArtifactTypeSignature = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	// AnnotationSignature contains the base64 encoded signature on each payload descriptor
+	AnnotationSignature = "dev.cosignproject.cosign/signature"
+	// PayloadType is the type field of the critical section in a signature payload
+	PayloadType = "cosign container image signature"
+	// payloadMax limits the size of a payload pulled for verification
+	payloadMax = 1024 * 1024
+)
+
+var (
+	// ErrKeyUnsupported is returned for unknown key formats or algorithms
+	ErrKeyUnsupported = errors.New("key unsupported")
+	// ErrNotSigned is returned when no signatures were found
+	ErrNotSigned = errors.New("no signatures found")
+	// ErrVerifyFailed is returned when signatures were found but none were valid
+	ErrVerifyFailed = errors.New("signature verification failed")
+)
+
+// Storage selects where signatures are saved
+type Storage int
+
+const (
+	// StorageTag saves signatures in a digest tag, "sha256-<hex>.sig", used by cosign
+	StorageTag Storage = iota
+	// StorageReferrers saves each signature as an artifact referring to the image
+	StorageReferrers
+	// StorageAny checks both the digest tag and referrers when verifying
+	StorageAny
+)
+
+// Payload is the signed content of a cosign simple signing signature
+type Payload struct {
+	Critical Critical               `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// Critical contains the fields that must be verified
+type Critical struct {
+	Identity Identity `json:"identity"`
+	Image    Image    `json:"image"`
+	Type     string   `json:"type"`
+}
+
+// Identity is the repository of the signed image
+type Identity struct {
+	DockerReference string `json:"docker-reference"`
+}
+
+// Image is the digest of the signed image
+type Image struct {
+	DockerManifestDigest digest.Digest `json:"docker-manifest-digest"`
+}
+
+type config struct {
+	storage      Storage
+	annotations  map[string]string
+	skipIdentity bool
+}
+
+// Opts configures Sign and Verify
+type Opts func(*config)
+
+// WithAnnotations adds optional fields to the signed payload
+func WithAnnotations(annotations map[string]string) Opts {
+	return func(c *config) {
+		c.annotations = annotations
+	}
+}
+
+// WithSkipIdentity disables the check that the identity in the payload matches the verified repository.
+// This is needed when verifying a copy of an image signed in another repository.
+func WithSkipIdentity() Opts {
+	return func(c *config) {
+		c.skipIdentity = true
+	}
+}
+
+// WithStorage selects where signatures are pushed or pulled.
+// Sign defaults to StorageTag, Verify defaults to StorageAny.
+func WithStorage(s Storage) Opts {
+	return func(c *config) {
+		c.storage = s
+	}
+}
+
+// ParseStorage converts a string (tag, referrers, or any) to a Storage value
+func ParseStorage(s string) (Storage, error) {
+	switch s {
+	case "tag":
+		return StorageTag, nil
+	case "referrers":
+		return StorageReferrers, nil
+	case "any", "":
+		return StorageAny, nil
+	}
+	return StorageAny, fmt.Errorf("unknown signature storage: %s", s)
+}
+
+// Sign creates a signature for the image and pushes it to the image repository
+func Sign(ctx context.Context, rc *regclient.RegClient, r ref.Ref, key crypto.Signer, opts ...Opts) (types.Descriptor, error) {
+	c := config{storage: StorageTag}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	d, err := imageDigest(ctx, rc, r)
+	if err != nil {
+		return types.Descriptor{}, err
+	}
+	p := Payload{
+		Critical: Critical{
+			Identity: Identity{DockerReference: identity(r)},
+			Image:    Image{DockerManifestDigest: d.Digest},
+			Type:     PayloadType,
+		},
+	}
+	if len(c.annotations) > 0 {
+		p.Optional = map[string]interface{}{}
+		for k, v := range c.annotations {
+			p.Optional[k] = v
+		}
+	}
+	pBytes, err := json.Marshal(p)
+	if err != nil {
+		return types.Descriptor{}, err
+	}
+	sig, err := signPayload(key, pBytes)
+	if err != nil {
+		return types.Descriptor{}, err
+	}
+	rRepo := r
+	rRepo.Tag = ""
+	rRepo.Digest = ""
+	pDesc, err := rc.BlobPut(ctx, rRepo, types.Descriptor{Digest: digest.FromBytes(pBytes), Size: int64(len(pBytes))}, bytes.NewReader(pBytes))
+	if err != nil {
+		return types.Descriptor{}, fmt.Errorf("failed to push signature payload: %w", err)
+	}
+	pDesc.MediaType = MediaTypeSimpleSigning
+	pDesc.Annotations = map[string]string{
+		AnnotationSignature: base64.StdEncoding.EncodeToString(sig),
+	}
+
+	switch c.storage {
+	case StorageTag:
+		return signTag(ctx, rc, rRepo, d, pDesc)
+	case StorageReferrers:
+		return signReferrer(ctx, rc, rRepo, d, pDesc)
+	}
+	return types.Descriptor{}, fmt.Errorf("unsupported storage for signing: %d", c.storage)
+}
+
+// signTag appends the signature to the digest tag manifest
+func signTag(ctx context.Context, rc *regclient.RegClient, rRepo ref.Ref, d types.Descriptor, pDesc types.Descriptor) (types.Descriptor, error) {
+	rTag := rRepo
+	rTag.Tag = sigTag(d.Digest)
+	layers := []types.Descriptor{}
+	mExisting, err := rc.ManifestGet(ctx, rTag)
+	if err == nil {
+		if mOrig, ok := mExisting.GetOrig().(v1.Manifest); ok {
+			layers = mOrig.Layers
+		}
+	}
+	layers = append(layers, pDesc)
+	// cosign images include a config with a diff_id for each payload
+	conf := v1.Image{
+		RootFS: v1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{},
+		},
+	}
+	for _, l := range layers {
+		conf.RootFS.DiffIDs = append(conf.RootFS.DiffIDs, l.Digest)
+	}
+	confBytes, err := json.Marshal(conf)
+	if err != nil {
+		return types.Descriptor{}, err
+	}
+	confDesc, err := rc.BlobPut(ctx, rRepo, types.Descriptor{Digest: digest.FromBytes(confBytes), Size: int64(len(confBytes))}, bytes.NewReader(confBytes))
+	if err != nil {
+		return types.Descriptor{}, fmt.Errorf("failed to push signature config: %w", err)
+	}
+	confDesc.MediaType = types.MediaTypeOCI1ImageConfig
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config:    confDesc,
+		Layers:    layers,
+	}))
+	if err != nil {
+		return types.Descriptor{}, err
+	}
+	err = rc.ManifestPut(ctx, rTag, m)
+	if err != nil {
+		return types.Descriptor{}, fmt.Errorf("failed to push signature %s: %w", rTag.CommonName(), err)
+	}
+	return m.GetDescriptor(), nil
+}
+
+// signReferrer pushes the signature as an artifact referring to the image
+func signReferrer(ctx context.Context, rc *regclient.RegClient, rRepo ref.Ref, d types.Descriptor, pDesc types.Descriptor) (types.Descriptor, error) {
+	m, err := manifest.New(manifest.WithOrig(v1.ArtifactManifest{
+		MediaType:    types.MediaTypeOCI1Artifact,
+		ArtifactType: ArtifactTypeSignature,
+		Blobs:        []types.Descriptor{pDesc},
+		Refers:       &d,
+	}))
+	if err != nil {
+		return types.Descriptor{}, err
+	}
+	rArt := rRepo
+	rArt.Digest = m.GetDescriptor().Digest.String()
+	err = rc.ManifestPut(ctx, rArt, m)
+	if err != nil {
+		return types.Descriptor{}, fmt.Errorf("failed to push signature %s: %w", rArt.CommonName(), err)
+	}
+	return m.GetDescriptor(), nil
+}
+
+// Verify checks for a valid signature on the image from the public key, returning the verified payload.
+// The payload identity must match the repository of the image unless WithSkipIdentity is set.
+// Callers should use the digest in the payload to access the image rather than resolving the tag again.
+func Verify(ctx context.Context, rc *regclient.RegClient, r ref.Ref, pub crypto.PublicKey, opts ...Opts) (Payload, error) {
+	c := config{storage: StorageAny}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	d, err := imageDigest(ctx, rc, r)
+	if err != nil {
+		return Payload{}, err
+	}
+	rRepo := r
+	rRepo.Tag = ""
+	rRepo.Digest = ""
+	sigDescs := []types.Descriptor{}
+	if c.storage == StorageTag || c.storage == StorageAny {
+		rTag := rRepo
+		rTag.Tag = sigTag(d.Digest)
+		m, err := rc.ManifestGet(ctx, rTag)
+		if err == nil {
+			sigDescs = append(sigDescs, sigLayers(m)...)
+		} else if !errors.Is(err, types.ErrNotFound) && c.storage == StorageTag {
+			return Payload{}, fmt.Errorf("failed to get signature %s: %w", rTag.CommonName(), err)
+		}
+	}
+	if c.storage == StorageReferrers || c.storage == StorageAny {
+		rDig := rRepo
+		rDig.Digest = d.Digest.String()
+		rl, err := rc.ReferrerList(ctx, rDig, scheme.WithReferrerAT(ArtifactTypeSignature))
+		if err != nil && c.storage == StorageReferrers {
+			return Payload{}, fmt.Errorf("failed to list referrers %s: %w", rDig.CommonName(), err)
+		}
+		if err == nil {
+			for _, rd := range rl.Descriptors {
+				rArt := rRepo
+				rArt.Digest = rd.Digest.String()
+				m, err := rc.ManifestGet(ctx, rArt, regclient.WithManifestDesc(rd))
+				if err != nil {
+					continue
+				}
+				sigDescs = append(sigDescs, sigLayers(m)...)
+			}
+		}
+	}
+	if len(sigDescs) == 0 {
+		return Payload{}, fmt.Errorf("%s: %w", r.CommonName(), ErrNotSigned)
+	}
+	errs := []error{}
+	for _, sd := range sigDescs {
+		p, err := verifyDesc(ctx, rc, rRepo, d.Digest, sd, pub)
+		if err == nil && !c.skipIdentity && !identityMatch(r, p.Critical.Identity.DockerReference) {
+			err = fmt.Errorf("payload is for a different repository, expected %s, received %s", identity(r), p.Critical.Identity.DockerReference)
+		}
+		if err == nil {
+			return p, nil
+		}
+		errs = append(errs, err)
+	}
+	return Payload{}, fmt.Errorf("%s, %d signatures checked, last error %v: %w", r.CommonName(), len(errs), errs[len(errs)-1], ErrVerifyFailed)
+}
+
+// verifyDesc checks a single signature payload
+func verifyDesc(ctx context.Context, rc *regclient.RegClient, rRepo ref.Ref, d digest.Digest, sd types.Descriptor, pub crypto.PublicKey) (Payload, error) {
+	p := Payload{}
+	sigB64, ok := sd.Annotations[AnnotationSignature]
+	if !ok {
+		return p, fmt.Errorf("signature annotation missing on %s", sd.Digest.String())
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		return p, fmt.Errorf("failed to decode signature on %s: %w", sd.Digest.String(), err)
+	}
+	if sd.Size > payloadMax {
+		return p, fmt.Errorf("payload %s exceeds max size %d", sd.Digest.String(), payloadMax)
+	}
+	br, err := rc.BlobGet(ctx, rRepo, sd)
+	if err != nil {
+		return p, err
+	}
+	defer br.Close()
+	pBytes, err := io.ReadAll(io.LimitReader(br, payloadMax))
+	if err != nil {
+		return p, err
+	}
+	if sd.Digest != digest.FromBytes(pBytes) {
+		return p, fmt.Errorf("payload %s: %w", sd.Digest.String(), types.ErrDigestMismatch)
+	}
+	err = verifyPayload(pub, pBytes, sig)
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(pBytes, &p)
+	if err != nil {
+		return p, fmt.Errorf("failed to parse payload %s: %w", sd.Digest.String(), err)
+	}
+	if p.Critical.Type != PayloadType {
+		return p, fmt.Errorf("unexpected payload type %s", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != d {
+		return p, fmt.Errorf("payload is for a different image, expected %s, received %s", d.String(), p.Critical.Image.DockerManifestDigest.String())
+	}
+	return p, nil
+}
+
+func signPayload(key crypto.Signer, payload []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		h := sha256.Sum256(payload)
+		return ecdsa.SignASN1(rand.Reader, k, h[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, payload), nil
+	}
+	return nil, fmt.Errorf("signing key type %T: %w", key, ErrKeyUnsupported)
+}
+
+func verifyPayload(pub crypto.PublicKey, payload, sig []byte) error {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(payload)
+		if !ecdsa.VerifyASN1(k, h[:], sig) {
+			return fmt.Errorf("invalid ecdsa signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, sig) {
+			return fmt.Errorf("invalid ed25519 signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("public key type %T: %w", pub, ErrKeyUnsupported)
+}
+
+// imageDigest resolves the descriptor of the image to sign or verify
+func imageDigest(ctx context.Context, rc *regclient.RegClient, r ref.Ref) (types.Descriptor, error) {
+	m, err := rc.ManifestHead(ctx, r)
+	if err != nil || m.GetDescriptor().Digest == "" {
+		m, err = rc.ManifestGet(ctx, r)
+	}
+	if err != nil {
+		return types.Descriptor{}, fmt.Errorf("failed to get manifest %s: %w", r.CommonName(), err)
+	}
+	d := m.GetDescriptor()
+	return types.Descriptor{MediaType: d.MediaType, Digest: d.Digest, Size: d.Size}, nil
+}
+
+// identity returns the repository name included in the signature
+func identity(r ref.Ref) string {
+	if r.Scheme != "reg" {
+		return r.Path
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// identityMatch compares the identity from a payload to the repository of the reference
+func identityMatch(r ref.Ref, id string) bool {
+	if r.Scheme != "reg" {
+		return id == r.Path
+	}
+	rID, err := ref.New(id)
+	if err != nil || rID.Scheme != "reg" {
+		return false
+	}
+	return rID.Registry == r.Registry && rID.Repository == r.Repository
+}
+
+// sigTag returns the digest tag used by cosign
+func sigTag(d digest.Digest) string {
+	return d.Algorithm().String() + "-" + d.Encoded() + ".sig"
+}
+
+// sigLayers returns the payload descriptors from a signature manifest
+func sigLayers(m manifest.Manifest) []types.Descriptor {
+	var descs []types.Descriptor
+	switch mOrig := m.GetOrig().(type) {
+	case v1.Manifest:
+		descs = mOrig.Layers
+	case v1.ArtifactManifest:
+		descs = mOrig.Blobs
+	}
+	ret := []types.Descriptor{}
+	for _, d := range descs {
+		if d.MediaType == MediaTypeSimpleSigning {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,218 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestSignVerify(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	_, ecKey, ecPub := genKeys(t, "ecdsa")
+	_, edKey, edPub := genKeys(t, "ed25519")
+
+	tests := []struct {
+		name      string
+		ref       string
+		key       crypto.Signer
+		pub       crypto.PublicKey
+		signOpts  []Opts
+		verOpts   []Opts
+		expectErr error
+	}{
+		{
+			name: "ecdsa tag",
+			ref:  "ocidir://testrepo:v1",
+			key:  ecKey,
+			pub:  ecPub,
+		},
+		{
+			name:     "ed25519 referrers",
+			ref:      "ocidir://testrepo:v2",
+			key:      edKey,
+			pub:      edPub,
+			signOpts: []Opts{WithStorage(StorageReferrers), WithAnnotations(map[string]string{"build": "42"})},
+			verOpts:  []Opts{WithStorage(StorageReferrers)},
+		},
+		{
+			name:      "wrong key",
+			ref:       "ocidir://testrepo:v1",
+			pub:       edPub,
+			expectErr: ErrVerifyFailed,
+		},
+		{
+			name:      "wrong storage",
+			ref:       "ocidir://testrepo:v2",
+			pub:       edPub,
+			verOpts:   []Opts{WithStorage(StorageTag)},
+			expectErr: ErrNotSigned,
+		},
+		{
+			name:      "unsigned",
+			ref:       "ocidir://testrepo:v3",
+			pub:       ecPub,
+			expectErr: ErrNotSigned,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ref.New(tt.ref)
+			if err != nil {
+				t.Fatalf("failed to parse ref: %v", err)
+			}
+			if tt.key != nil {
+				_, err = Sign(ctx, rc, r, tt.key, tt.signOpts...)
+				if err != nil {
+					t.Fatalf("failed to sign: %v", err)
+				}
+			}
+			p, err := Verify(ctx, rc, r, tt.pub, tt.verOpts...)
+			if tt.expectErr != nil {
+				if err == nil {
+					t.Errorf("verify did not fail")
+				} else if !errors.Is(err, tt.expectErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to verify: %v", err)
+			}
+			if p.Critical.Type != PayloadType {
+				t.Errorf("unexpected payload type: %s", p.Critical.Type)
+			}
+		})
+	}
+
+	t.Run("identity", func(t *testing.T) {
+		rSigned, err := ref.New("ocidir://testrepo:v1")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		rCopy, err := ref.New("ocidir://testcopy:v1")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		_, err = Sign(ctx, rc, rSigned, ecKey)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		// copying the signature to another repository does not sign the copy
+		err = rc.ImageCopy(ctx, rSigned, rCopy, regclient.ImageWithDigestTags())
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		_, err = Verify(ctx, rc, rCopy, ecPub, WithStorage(StorageTag))
+		if !errors.Is(err, ErrVerifyFailed) {
+			t.Errorf("unexpected error verifying a different identity: %v", err)
+		}
+		p, err := Verify(ctx, rc, rCopy, ecPub, WithStorage(StorageTag), WithSkipIdentity())
+		if err != nil {
+			t.Fatalf("failed to verify with identity skipped: %v", err)
+		}
+		if p.Critical.Identity.DockerReference != identity(rSigned) {
+			t.Errorf("unexpected identity, expected %s, received %s", identity(rSigned), p.Critical.Identity.DockerReference)
+		}
+	})
+}
+
+func TestIdentityMatch(t *testing.T) {
+	tests := []struct {
+		ref    string
+		id     string
+		expect bool
+	}{
+		{ref: "registry.example.com/proj/repo:v1", id: "registry.example.com/proj/repo", expect: true},
+		{ref: "registry.example.com/proj/repo@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", id: "registry.example.com/proj/repo", expect: true},
+		{ref: "alpine:3", id: "index.docker.io/library/alpine", expect: true},
+		{ref: "registry.example.com/proj/repo:v1", id: "registry.example.com/proj/other", expect: false},
+		{ref: "registry.example.com/proj/repo:v1", id: "mirror.example.com/proj/repo", expect: false},
+		{ref: "registry.example.com/proj/repo:v1", id: "", expect: false},
+		{ref: "ocidir://testrepo:v1", id: "testrepo", expect: true},
+		{ref: "ocidir://testrepo:v1", id: "other", expect: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref+"="+tt.id, func(t *testing.T) {
+			r, err := ref.New(tt.ref)
+			if err != nil {
+				t.Fatalf("failed to parse ref: %v", err)
+			}
+			if result := identityMatch(r, tt.id); result != tt.expect {
+				t.Errorf("identity match, expected %t, received %t", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	for _, alg := range []string{"ecdsa", "ed25519"} {
+		t.Run(alg, func(t *testing.T) {
+			pems, _, _ := genKeys(t, alg)
+			key, err := LoadPrivateKey(pems[0])
+			if err != nil {
+				t.Fatalf("failed to load private key: %v", err)
+			}
+			pub, err := LoadPublicKey(pems[1])
+			if err != nil {
+				t.Fatalf("failed to load public key: %v", err)
+			}
+			sig, err := signPayload(key, []byte("hello"))
+			if err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+			if err := verifyPayload(pub, []byte("hello"), sig); err != nil {
+				t.Errorf("failed to verify: %v", err)
+			}
+		})
+	}
+	_, err := LoadPublicKey([]byte("not a key"))
+	if !errors.Is(err, ErrKeyUnsupported) {
+		t.Errorf("unexpected error loading invalid key: %v", err)
+	}
+}
+
+// genKeys returns the PEM encoded private and public key, along with the parsed keys
+func genKeys(t *testing.T, alg string) ([][]byte, crypto.Signer, crypto.PublicKey) {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	privBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return [][]byte{
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}),
+	}, key, key.Public()
+}
@@ -0,0 +1,59 @@
+package types
+
+// CallbackState is the current state of a transfer reported to a callback
+type CallbackState int
+
+const (
+	// CallbackUndef indicates an undefined state
+	CallbackUndef CallbackState = iota
+	// CallbackSkipped indicates the object already exists on the target
+	CallbackSkipped
+	// CallbackStarted indicates the transfer has started
+	CallbackStarted
+	// CallbackActive indicates bytes have been transferred
+	CallbackActive
+	// CallbackMounted indicates the blob was copied with a server side mount
+	CallbackMounted
+	// CallbackFinished indicates the transfer completed
+	CallbackFinished
+	// CallbackFailed indicates the transfer failed
+	CallbackFailed
+)
+
+// CallbackKind identifies the type of object reported to a callback
+type CallbackKind int
+
+const (
+	// CallbackManifest is a manifest or index
+	CallbackManifest CallbackKind = iota
+	// CallbackBlob is a blob (config or layer)
+	CallbackBlob
+)
+
+func (s CallbackState) String() string {
+	switch s {
+	case CallbackSkipped:
+		return "skipped"
+	case CallbackStarted:
+		return "started"
+	case CallbackActive:
+		return "active"
+	case CallbackMounted:
+		return "mounted"
+	case CallbackFinished:
+		return "finished"
+	case CallbackFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+func (k CallbackKind) String() string {
+	switch k {
+	case CallbackManifest:
+		return "manifest"
+	case CallbackBlob:
+		return "blob"
+	}
+	return "unknown"
+}
@@ -8,6 +8,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 const (
@@ -36,12 +37,50 @@ var (
 		`(` + repoPartS + `(?:` + regexp.QuoteMeta(`/`) + repoPartS + `)*)` +
 		`(?:` + regexp.QuoteMeta(`:`) + `(` + tagS + `))?` +
 		`(?:` + regexp.QuoteMeta(`@`) + `(` + digestS + `))?$`)
-	schemeRE = regexp.MustCompile(`^([a-z]+)://(.+)$`)
-	pathRE   = regexp.MustCompile(`^(` + pathS + `)` +
+	schemeRE     = regexp.MustCompile(`^([a-z]+)://(.+)$`)
+	schemeNameRE = regexp.MustCompile(`^[a-z]+$`)
+	pathRE       = regexp.MustCompile(`^(` + pathS + `)` +
 		`(?:` + regexp.QuoteMeta(`:`) + `(` + tagS + `))?` +
 		`(?:` + regexp.QuoteMeta(`@`) + `(` + digestS + `))?$`)
 )
 
+var (
+	schemeParsers   = map[string]SchemeParser{}
+	schemeParsersMu sync.RWMutex
+	schemeBuiltin   = map[string]bool{"reg": true, "ocidir": true, "ocifile": true}
+)
+
+// SchemeParser converts the portion of a reference after "scheme://" into a Ref.
+// The returned Ref should have the Scheme and Reference fields set by the parser.
+type SchemeParser func(scheme, path string) (Ref, error)
+
+// RegisterScheme adds a parser for a custom scheme to New.
+// If parser is nil, ParsePath is used, treating the reference like ocidir.
+// Built in schemes cannot be replaced.
+// Custom schemes must also be added to the regclient with regclient.WithScheme.
+func RegisterScheme(scheme string, parser SchemeParser) error {
+	if !schemeNameRE.MatchString(scheme) {
+		return fmt.Errorf("invalid scheme name \"%s\"", scheme)
+	}
+	if schemeBuiltin[scheme] {
+		return fmt.Errorf("scheme \"%s\" is built in and cannot be replaced", scheme)
+	}
+	if parser == nil {
+		parser = ParsePath
+	}
+	schemeParsersMu.Lock()
+	defer schemeParsersMu.Unlock()
+	schemeParsers[scheme] = parser
+	return nil
+}
+
+// UnregisterScheme removes a custom scheme parser added with RegisterScheme
+func UnregisterScheme(scheme string) {
+	schemeParsersMu.Lock()
+	defer schemeParsersMu.Unlock()
+	delete(schemeParsers, scheme)
+}
+
 // Ref reference to a registry/repository
 // If the tag or digest is available, it's also included in the reference.
 // Reference itself is the unparsed string.
@@ -106,20 +145,36 @@ func New(parse string) (Ref, error) {
 		}
 
 	case "ocidir", "ocifile":
-		matchPath := pathRE.FindStringSubmatch(path)
-		if matchPath == nil || len(matchPath) < 2 || matchPath[1] == "" {
-			return Ref{}, fmt.Errorf("invalid path for scheme \"%s\": %s", scheme, path)
-		}
-		ret.Path = matchPath[1]
-		if len(matchPath) > 2 && matchPath[2] != "" {
-			ret.Tag = matchPath[2]
-		}
-		if len(matchPath) > 3 && matchPath[3] != "" {
-			ret.Digest = matchPath[3]
-		}
+		return ParsePath(scheme, path)
 
 	default:
-		return Ref{}, fmt.Errorf("unhandled reference scheme \"%s\" in \"%s\"", scheme, parse)
+		schemeParsersMu.RLock()
+		parser, ok := schemeParsers[scheme]
+		schemeParsersMu.RUnlock()
+		if !ok {
+			return Ref{}, fmt.Errorf("unhandled reference scheme \"%s\" in \"%s\"", scheme, parse)
+		}
+		return parser(scheme, path)
+	}
+	return ret, nil
+}
+
+// ParsePath parses a path based reference (path:tag@digest) used by ocidir and ocifile
+func ParsePath(scheme, path string) (Ref, error) {
+	matchPath := pathRE.FindStringSubmatch(path)
+	if matchPath == nil || len(matchPath) < 2 || matchPath[1] == "" {
+		return Ref{}, fmt.Errorf("invalid path for scheme \"%s\": %s", scheme, path)
+	}
+	ret := Ref{
+		Scheme:    scheme,
+		Reference: scheme + "://" + path,
+		Path:      matchPath[1],
+	}
+	if len(matchPath) > 2 && matchPath[2] != "" {
+		ret.Tag = matchPath[2]
+	}
+	if len(matchPath) > 3 && matchPath[3] != "" {
+		ret.Digest = matchPath[3]
 	}
 	return ret, nil
 }
@@ -142,8 +197,28 @@ func (r Ref) CommonName() string {
 		if r.Digest != "" {
 			cn = cn + "@" + r.Digest
 		}
-	case "ocidir":
-		cn = fmt.Sprintf("ocidir://%s", r.Path)
+	case "ocidir", "ocifile":
+		cn = fmt.Sprintf("%s://%s", r.Scheme, r.Path)
+		if r.Tag != "" {
+			cn = cn + ":" + r.Tag
+		}
+		if r.Digest != "" {
+			cn = cn + "@" + r.Digest
+		}
+	default:
+		if !isRegistered(r.Scheme) {
+			break
+		}
+		// custom schemes output a path when defined, otherwise the registry and repository
+		cn = r.Scheme + "://"
+		if r.Path != "" {
+			cn = cn + r.Path
+		} else {
+			if r.Registry != "" {
+				cn = cn + r.Registry + "/"
+			}
+			cn = cn + r.Repository
+		}
 		if r.Tag != "" {
 			cn = cn + ":" + r.Tag
 		}
@@ -165,7 +240,7 @@ func (r Ref) IsZero() bool {
 // ToReg converts a reference to a registry like syntax
 func (r Ref) ToReg() Ref {
 	switch r.Scheme {
-	case "ocidir":
+	case "ocidir", "ocifile":
 		r.Scheme = "reg"
 		r.Registry = "localhost"
 		// clean the path to strip leading ".."
@@ -186,12 +261,15 @@ func EqualRegistry(a, b Ref) bool {
 	switch a.Scheme {
 	case "reg":
 		return a.Registry == b.Registry
-	case "ocidir":
+	case "ocidir", "ocifile":
 		return a.Path == b.Path
 	case "":
 		// both undefined
 		return true
 	default:
+		if isRegistered(a.Scheme) {
+			return a.Registry == b.Registry && a.Path == b.Path
+		}
 		return false
 	}
 }
@@ -204,12 +282,22 @@ func EqualRepository(a, b Ref) bool {
 	switch a.Scheme {
 	case "reg":
 		return a.Registry == b.Registry && a.Repository == b.Repository
-	case "ocidir":
+	case "ocidir", "ocifile":
 		return a.Path == b.Path
 	case "":
 		// both undefined
 		return true
 	default:
+		if isRegistered(a.Scheme) {
+			return a.Registry == b.Registry && a.Repository == b.Repository && a.Path == b.Path
+		}
 		return false
 	}
 }
+
+func isRegistered(scheme string) bool {
+	schemeParsersMu.RLock()
+	defer schemeParsersMu.RUnlock()
+	_, ok := schemeParsers[scheme]
+	return ok
+}
@@ -406,6 +406,14 @@ func TestCommon(t *testing.T) {
 			name: "ocidir with digest",
 			str:  "ocidir://image@sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115",
 		},
+		{
+			name: "ocifile with tag",
+			str:  "ocifile:///tmp/image.tar:tag",
+		},
+		{
+			name: "ocifile with digest",
+			str:  "ocifile://image.tar.gz@sha256:15f840677a5e245d9ea199eb9b026b1539208a5183621dced7b469f6aa678115",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -510,6 +518,36 @@ func TestEqual(t *testing.T) {
 			expectReg:  false,
 			expectRepo: false,
 		},
+		{
+			name: "ocifile eq file",
+			a: Ref{
+				Scheme: "ocifile",
+				Path:   "path/to/file.tar",
+				Tag:    "a",
+			},
+			b: Ref{
+				Scheme: "ocifile",
+				Path:   "path/to/file.tar",
+				Tag:    "b",
+			},
+			expectReg:  true,
+			expectRepo: true,
+		},
+		{
+			name: "ocidir ne ocifile",
+			a: Ref{
+				Scheme: "ocidir",
+				Path:   "path/to/file.tar",
+				Tag:    "a",
+			},
+			b: Ref{
+				Scheme: "ocifile",
+				Path:   "path/to/file.tar",
+				Tag:    "a",
+			},
+			expectReg:  false,
+			expectRepo: false,
+		},
 		{
 			name: "ne scheme",
 			a: Ref{
@@ -585,6 +623,11 @@ func TestToReg(t *testing.T) {
 			inRef:  "ocidir://test_-_hello world",
 			expect: "localhost/test-hello-world",
 		},
+		{
+			name:   "ocifile",
+			inRef:  "ocifile://test.tar",
+			expect: "localhost/test-tar",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -601,3 +644,75 @@ func TestToReg(t *testing.T) {
 	}
 
 }
+
+func TestRegisterScheme(t *testing.T) {
+	err := RegisterScheme("ocidir", nil)
+	if err == nil {
+		t.Errorf("registering a built in scheme did not fail")
+	}
+	err = RegisterScheme("Invalid", nil)
+	if err == nil {
+		t.Errorf("registering an invalid scheme name did not fail")
+	}
+	_, err = New("custom://path/to/layout:tag")
+	if err == nil {
+		t.Errorf("parsing an unregistered scheme did not fail")
+	}
+
+	// default path parser
+	err = RegisterScheme("custom", nil)
+	if err != nil {
+		t.Fatalf("failed to register scheme: %v", err)
+	}
+	defer UnregisterScheme("custom")
+	r, err := New("custom://path/to/layout:tag")
+	if err != nil {
+		t.Fatalf("failed to parse custom scheme: %v", err)
+	}
+	if r.Scheme != "custom" || r.Path != "path/to/layout" || r.Tag != "tag" {
+		t.Errorf("unexpected parse result: %#v", r)
+	}
+	if r.CommonName() != "custom://path/to/layout:tag" {
+		t.Errorf("unexpected common name: %s", r.CommonName())
+	}
+	r2 := r
+	r2.Tag = "other"
+	if !EqualRegistry(r, r2) || !EqualRepository(r, r2) {
+		t.Errorf("custom references with the same path were not equal")
+	}
+	r2.Path = "path/to/other"
+	if EqualRepository(r, r2) {
+		t.Errorf("custom references with different paths were equal")
+	}
+
+	// registry style parser
+	err = RegisterScheme("store", func(scheme, path string) (Ref, error) {
+		r, err := New(path)
+		if err != nil {
+			return r, err
+		}
+		r.Scheme = scheme
+		r.Reference = scheme + "://" + path
+		return r, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to register scheme: %v", err)
+	}
+	defer UnregisterScheme("store")
+	r, err = New("store://registry.example.com/repo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse custom scheme: %v", err)
+	}
+	if r.Registry != "registry.example.com" || r.Repository != "repo" || r.Tag != "v1" {
+		t.Errorf("unexpected parse result: %#v", r)
+	}
+	if r.CommonName() != "store://registry.example.com/repo:v1" {
+		t.Errorf("unexpected common name: %s", r.CommonName())
+	}
+
+	UnregisterScheme("store")
+	_, err = New("store://registry.example.com/repo:v1")
+	if err == nil {
+		t.Errorf("parsing an unregistered scheme did not fail")
+	}
+}